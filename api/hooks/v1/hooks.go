@@ -17,51 +17,286 @@
 package v1
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const Version = "v1"
 
+// envReference matches the ${VAR} references expanded in hooks.
+var envReference = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// OnErrorPolicy sets what happens when a hook fails.
+type OnErrorPolicy string
+
+// Policies for failing hooks. OnErrorFail is the default.
+const (
+	OnErrorFail   OnErrorPolicy = "fail"
+	OnErrorWarn   OnErrorPolicy = "warn"
+	OnErrorIgnore OnErrorPolicy = "ignore"
+)
+
 type Spec struct {
 	Version string   `json:"version"`
 	Hooks   HooksMap `json:"hooks"`
 }
 
+// HookSpec is a command to run, or a webhook to call, as a hook. Each attempt
+// at running it is limited by Timeout (0 for no limit), after which a command
+// is killed along with its process group. A failing hook is retried up to
+// Retries times, waiting Backoff before the first retry and twice as long
+// before each further one. OnError sets whether a hook that still fails after
+// that fails, or only logs a warning or nothing at all.
 type HookSpec struct {
-	Command string   `json:"command"`
-	Args    []string `json:"args"`
-	Envs    EnvsMap  `json:"envs"`
-	Workdir string   `json:"workdir"`
+	Command string          `json:"command"`
+	Args    []string        `json:"args"`
+	Envs    EnvsMap         `json:"envs"`
+	Workdir string          `json:"workdir"`
+	Webhook *WebhookSpec    `json:"webhook,omitempty"`
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	Retries int             `json:"retries,omitempty"`
+	Backoff metav1.Duration `json:"backoff,omitempty"`
+	OnError OnErrorPolicy   `json:"on-error,omitempty"`
 }
 
 type EnvsMap map[string]string
 type HooksMap map[string][]HookSpec
 
-func (h HooksMap) Run(name string, envs EnvsMap, output bool) error {
+// Run runs all hooks registered under name in order, stopping at the first
+// failure. Any hook still running when ctx is done is killed along with its
+// process group. Webhooks are sent payload (if not nil), with its hook and
+// envs set. Every attempt at running a hook is returned, with the output of
+// commands, which is also written to stdout and stderr as they run if output
+// is true.
+func (h HooksMap) Run(ctx context.Context, name string, envs EnvsMap, payload *WebhookPayload, output bool) ([]Execution, error) {
 	hooks, exists := h[name]
 	if !exists {
-		return nil
+		return nil, nil
+	}
+
+	named := WebhookPayload{}
+	if payload != nil {
+		named = *payload
 	}
+	named.Hook = name
+
+	var executions []Execution
 	for _, hook := range hooks {
-		err := hook.Run(envs, output)
+		execs, err := hook.Run(ctx, envs, &named, output)
+		for i := range execs {
+			execs[i].Hook = name
+		}
+		executions = append(executions, execs...)
 		if err != nil {
-			return err
+			return executions, err
+		}
+	}
+	return executions, nil
+}
+
+// Run runs the hook, retrying it as configured, and applies its OnError
+// policy if it still fails. Every attempt at running it is returned.
+func (h *HookSpec) Run(ctx context.Context, envs EnvsMap, payload *WebhookPayload, output bool) ([]Execution, error) {
+	executions, err := h.runWithRetries(ctx, envs, payload, output)
+	if err == nil {
+		return executions, nil
+	}
+
+	switch h.OnError {
+	case OnErrorIgnore:
+		return executions, nil
+	case OnErrorWarn:
+		log.Warnf("Ignoring failure of hook %v: %v", h, err)
+		return executions, nil
+	}
+	return executions, err
+}
+
+func (h *HookSpec) runWithRetries(ctx context.Context, envs EnvsMap, payload *WebhookPayload, output bool) ([]Execution, error) {
+	var executions []Execution
+	backoff := h.Backoff.Duration
+	for attempt := 1; ; attempt++ {
+		execution, err := h.runOnce(ctx, envs, payload, output)
+		execution.Attempt = attempt
+		executions = append(executions, execution)
+		if err == nil || attempt > h.Retries || ctx.Err() != nil {
+			return executions, err
+		}
+
+		log.Warnf("Hook %v failed (attempt %v of %v), retrying in %v: %v", h, attempt, h.Retries+1, backoff, err)
+		select {
+		case <-ctx.Done():
+			return executions, fmt.Errorf("%w: %v", ctx.Err(), err)
+		case <-time.After(backoff):
 		}
+		backoff *= 2
+	}
+}
+
+// String returns the command line or webhook URL of the hook.
+func (h *HookSpec) String() string {
+	if h.Webhook != nil {
+		return h.Webhook.URL
 	}
-	return nil
+	return strings.Join(append([]string{h.Command}, h.Args...), " ")
 }
 
-func (h *HookSpec) Run(envs EnvsMap, output bool) error {
+// runOnce makes a single attempt at running the hook.
+func (h *HookSpec) runOnce(ctx context.Context, envs EnvsMap, payload *WebhookPayload, output bool) (execution Execution, rerr error) {
+	execution = Execution{
+		ExitCode: -1,
+	}
+	defer func() {
+		if rerr != nil {
+			execution.Error = rerr.Error()
+		}
+	}()
+
+	if h.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout.Duration)
+		defer cancel()
+	}
+
+	if h.Webhook != nil && h.Command != "" {
+		return execution, fmt.Errorf("hook sets both a command and a webhook")
+	}
+
+	expanded, combined := h.expand(envs)
+	if h.Webhook != nil {
+		p := WebhookPayload{}
+		if payload != nil {
+			p = *payload
+		}
+		p.Envs = combined
+		execution.URL = h.Webhook.URL
+		err := h.Webhook.call(ctx, &p, &execution)
+		return execution, err
+	}
+
+	execution.Command = expanded.Command
+	execution.Args = expanded.Args
+	err := expanded.runCommand(ctx, combined, output, &execution)
+	return execution, err
+}
+
+// expand returns a copy of the hook with ${VAR} references in its envs
+// expanded against envs, and those in its args and workdir against the
+// combination of both. The combined envs are returned as well.
+func (h *HookSpec) expand(envs EnvsMap) (*HookSpec, EnvsMap) {
+	expanded := *h
+
+	expanded.Envs = make(EnvsMap)
+	for k, v := range h.Envs {
+		expanded.Envs[k] = envs.Expand(v)
+	}
+	combined := expanded.Envs.Combine(envs)
+
+	expanded.Args = nil
+	for _, arg := range h.Args {
+		expanded.Args = append(expanded.Args, combined.Expand(arg))
+	}
+	expanded.Workdir = combined.Expand(h.Workdir)
+
+	return &expanded, combined
+}
+
+// runCommand runs the command of the hook with envs as its environment in
+// its own process group, killing the whole group if the command is still
+// running when ctx is done.
+func (h *HookSpec) runCommand(ctx context.Context, envs EnvsMap, output bool, execution *Execution) error {
+	// Output is read through pipes of our own rather than ones created by
+	// exec, so that a background process inheriting them can't keep Wait
+	// from returning. Stdout and stderr are read separately so that they
+	// can be passed on to our own.
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("error creating output pipe: %w", err)
+	}
+	defer stdoutReader.Close()
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		stdoutWriter.Close()
+		return fmt.Errorf("error creating output pipe: %w", err)
+	}
+	defer stderrReader.Close()
+
 	cmd := exec.Command(h.Command, h.Args...)
-	cmd.Env = h.Envs.Combine(envs).Format()
+	cmd.Env = envs.Format()
 	cmd.Dir = h.Workdir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+
+	execution.Start = metav1.Now()
+	err = cmd.Start()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	captured := newBoundedBuffer(MaxOutputSize)
+	var stdout, stderr io.Writer = captured, captured
 	if output {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		stdout = io.MultiWriter(captured, os.Stdout)
+		stderr = io.MultiWriter(captured, os.Stderr)
+	}
+	var copies sync.WaitGroup
+	copies.Add(2)
+	go func() {
+		io.Copy(stdout, stdoutReader)
+		copies.Done()
+	}()
+	go func() {
+		io.Copy(stderr, stderrReader)
+		copies.Done()
+	}()
+	copied := make(chan struct{})
+	go func() {
+		copies.Wait()
+		close(copied)
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		err = <-done
+		err = fmt.Errorf("%w: %v", ctx.Err(), err)
+	}
+
+	select {
+	case <-copied:
+	case <-time.After(outputGracePeriod):
+		stdoutReader.Close()
+		stderrReader.Close()
+		<-copied
+	}
+
+	execution.Duration = metav1.Duration{Duration: time.Since(execution.Start.Time)}
+	if cmd.ProcessState != nil {
+		execution.ExitCode = cmd.ProcessState.ExitCode()
 	}
-	return cmd.Run()
+	execution.Output, execution.OutputTruncated = captured.String(), captured.truncated
+
+	return err
 }
 
 func (e1 EnvsMap) Combine(e2 EnvsMap) EnvsMap {
@@ -75,6 +310,19 @@ func (e1 EnvsMap) Combine(e2 EnvsMap) EnvsMap {
 	return combined
 }
 
+// Expand replaces each ${VAR} reference in s whose VAR is set in e with its
+// value. Other references, including $VAR, are left as they are for the
+// shell run by a hook command, if any, to expand.
+func (e EnvsMap) Expand(s string) string {
+	return envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		value, exists := e[ref[2:len(ref)-1]]
+		if !exists {
+			return ref
+		}
+		return value
+	})
+}
+
 func (e EnvsMap) Format() []string {
 	var envs []string
 	for k, v := range e {
@@ -18,12 +18,19 @@ package v1
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 )
 
@@ -60,6 +67,47 @@ func captureOutput(f func() error) (string, error) {
 	return <-out, err
 }
 
+// captureStreams is like captureOutput, but captures stdout and stderr
+// separately.
+func captureStreams(f func() error) (string, string, error) {
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		return "", "", err
+	}
+	stderrReader, stderrWriter, err := os.Pipe()
+	if err != nil {
+		return "", "", err
+	}
+
+	stdout := os.Stdout
+	stderr := os.Stderr
+	defer func() {
+		os.Stdout = stdout
+		os.Stderr = stderr
+	}()
+
+	os.Stdout = stdoutWriter
+	os.Stderr = stderrWriter
+
+	read := func(r io.Reader) chan string {
+		out := make(chan string, 1)
+		go func() {
+			var buf bytes.Buffer
+			io.Copy(&buf, r)
+			out <- buf.String()
+		}()
+		return out
+	}
+	stdoutOut := read(stdoutReader)
+	stderrOut := read(stderrReader)
+
+	err = f()
+	stdoutWriter.Close()
+	stderrWriter.Close()
+
+	return <-stdoutOut, <-stderrOut, err
+}
+
 func TestMarshallUnmarshall(t *testing.T) {
 	spec := Spec{
 		Version: "v1",
@@ -144,7 +192,8 @@ func TestRunHooks(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.Description, func(t *testing.T) {
 			output, err := captureOutput(func() error {
-				return tc.Hook.Run(EnvsMap{}, true)
+				_, err := tc.Hook.Run(context.Background(), EnvsMap{}, nil, true)
+				return err
 			})
 			if !tc.expectedFailure {
 				require.Nil(t, err, "Unexpected failure Hook.Run")
@@ -155,3 +204,205 @@ func TestRunHooks(t *testing.T) {
 		})
 	}
 }
+
+func TestRunHookTimeout(t *testing.T) {
+	hook := HookSpec{
+		Command: "/bin/sh",
+		Args:    []string{"-c", "sleep 10"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := hook.Run(ctx, EnvsMap{}, nil, false)
+	require.NotNil(t, err, "Unexpected success Hook.Run")
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "Expected deadline exceeded, got: %v", err)
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+}
+
+func TestRunHookKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	hook := HookSpec{
+		Command: "/bin/sh",
+		Args:    []string{"-c", "sleep 10 & echo $! > " + pidFile + "; wait"},
+		Timeout: metav1.Duration{Duration: 200 * time.Millisecond},
+	}
+
+	start := time.Now()
+	_, err := hook.Run(context.Background(), EnvsMap{}, nil, false)
+	require.True(t, errors.Is(err, context.DeadlineExceeded), "Expected deadline exceeded, got: %v", err)
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	pid, err := ioutil.ReadFile(pidFile)
+	require.Nil(t, err, "Unexpected failure reading pid of background process")
+	require.Eventually(t, func() bool {
+		stat, err := ioutil.ReadFile(filepath.Join("/proc", strings.TrimSpace(string(pid)), "stat"))
+		// A killed process not yet reaped by its new parent is a zombie
+		return err != nil || strings.Contains(string(stat), ") Z ")
+	}, 5*time.Second, 10*time.Millisecond, "Background process of hook still running")
+}
+
+func TestRunHookRetries(t *testing.T) {
+	testCases := []struct {
+		Description     string
+		Retries         int
+		expectedFailure bool
+	}{
+		{"Enough retries", 2, false},
+		{"Too few retries", 1, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			attempts := filepath.Join(t.TempDir(), "attempts")
+			hook := HookSpec{
+				Command: "/bin/sh",
+				Args:    []string{"-c", "echo >> " + attempts + "; [ $(wc -l < " + attempts + ") -ge 3 ]"},
+				Retries: tc.Retries,
+				Backoff: metav1.Duration{Duration: 10 * time.Millisecond},
+			}
+
+			executions, err := hook.Run(context.Background(), EnvsMap{}, nil, false)
+			require.Len(t, executions, tc.Retries+1)
+			if !tc.expectedFailure {
+				require.Nil(t, err, "Unexpected failure Hook.Run")
+			} else {
+				require.NotNil(t, err, "Unexpected success Hook.Run")
+			}
+
+			contents, err := ioutil.ReadFile(attempts)
+			require.Nil(t, err)
+			require.Equal(t, tc.Retries+1, strings.Count(string(contents), "\n"))
+		})
+	}
+}
+
+func TestRunHookOnError(t *testing.T) {
+	testCases := []struct {
+		OnError         OnErrorPolicy
+		expectedFailure bool
+	}{
+		{"", true},
+		{OnErrorFail, true},
+		{OnErrorWarn, false},
+		{OnErrorIgnore, false},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.OnError), func(t *testing.T) {
+			hooks := HooksMap{
+				"hook": []HookSpec{
+					{Command: "/bin/false", OnError: tc.OnError},
+					{Command: "/bin/true"},
+				},
+			}
+			_, err := hooks.Run(context.Background(), "hook", EnvsMap{}, nil, false)
+			if !tc.expectedFailure {
+				require.Nil(t, err, "Unexpected failure HooksMap.Run")
+			} else {
+				require.NotNil(t, err, "Unexpected success HooksMap.Run")
+			}
+		})
+	}
+}
+
+func TestRunHookExecutions(t *testing.T) {
+	hooks := HooksMap{
+		"hook": []HookSpec{
+			{
+				Command: "/bin/sh",
+				Args:    []string{"-c", "echo out; echo err >&2"},
+			},
+			{
+				Command: "/bin/sh",
+				Args:    []string{"-c", "sleep 10 & echo failing; exit 3"},
+			},
+		},
+	}
+
+	start := time.Now()
+	executions, err := hooks.Run(context.Background(), "hook", EnvsMap{}, nil, false)
+	require.NotNil(t, err, "Unexpected success HooksMap.Run")
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second), "Background process of hook kept it from returning")
+
+	require.Len(t, executions, 2)
+	require.Equal(t, "hook", executions[0].Hook)
+	require.Equal(t, 1, executions[0].Attempt)
+	require.Equal(t, 0, executions[0].ExitCode)
+	require.Equal(t, "out\nerr\n", executions[0].Output)
+	require.Empty(t, executions[0].Error)
+
+	require.Equal(t, 3, executions[1].ExitCode)
+	require.Equal(t, "failing\n", executions[1].Output)
+	require.NotEmpty(t, executions[1].Error)
+}
+
+func TestRunHookExecutionsWithOutput(t *testing.T) {
+	hook := HookSpec{
+		Command: "/bin/sh",
+		Args:    []string{"-c", "echo out; echo err >&2"},
+	}
+
+	var executions []Execution
+	stdout, stderr, err := captureStreams(func() error {
+		var err error
+		executions, err = hook.Run(context.Background(), EnvsMap{}, nil, true)
+		return err
+	})
+	require.Nil(t, err, "Unexpected failure Hook.Run")
+	require.Equal(t, "out\n", stdout)
+	require.Equal(t, "err\n", stderr)
+	require.Len(t, executions, 1)
+	require.ElementsMatch(t, []string{"out", "err"}, strings.Fields(executions[0].Output))
+}
+
+func TestRunHookOutputBounded(t *testing.T) {
+	hook := HookSpec{
+		Command: "/bin/sh",
+		Args:    []string{"-c", "head -c 100000 /dev/zero; echo end"},
+	}
+
+	executions, err := hook.Run(context.Background(), EnvsMap{}, nil, false)
+	require.Nil(t, err, "Unexpected failure Hook.Run")
+	require.Len(t, executions, 1)
+	require.True(t, executions[0].OutputTruncated)
+	require.Len(t, executions[0].Output, MaxOutputSize)
+	require.True(t, strings.HasSuffix(executions[0].Output, "end\n"))
+}
+
+func TestEnvsMapExpand(t *testing.T) {
+	envs := EnvsMap{"FOO": "foo", "BAR": "bar"}
+
+	testCases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"", ""},
+		{"${FOO}", "foo"},
+		{"${FOO}-${BAR}/${FOO}", "foo-bar/foo"},
+		{"${BAZ}", "${BAZ}"},
+		{"$FOO", "$FOO"},
+		{"${FOO", "${FOO"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Input, func(t *testing.T) {
+			require.Equal(t, tc.Expected, envs.Expand(tc.Input))
+		})
+	}
+}
+
+func TestRunHookExpandsEnvs(t *testing.T) {
+	dir := t.TempDir()
+	hook := HookSpec{
+		Command: "/bin/sh",
+		Args:    []string{"-c", `echo "${FOO};$BAR;$PWD;${BAZ}"`},
+		Envs:    EnvsMap{"BAR": "${FOO}-bar"},
+		Workdir: "${DIR}",
+	}
+
+	executions, err := hook.Run(context.Background(), EnvsMap{"FOO": "foo", "DIR": dir}, nil, false)
+	require.Nil(t, err, "Unexpected failure Hook.Run")
+	require.Len(t, executions, 1)
+	require.Equal(t, []string{"-c", `echo "foo;$BAR;$PWD;${BAZ}"`}, executions[0].Args)
+	require.Equal(t, "foo;foo-bar;"+dir+";\n", executions[0].Output)
+}
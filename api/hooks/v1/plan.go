@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"github.com/NVIDIA/mig-parted/pkg/types"
+)
+
+// Plan is the current and desired state of the GPUs selected by the MIG
+// config being applied, as found before applying it.
+type Plan struct {
+	GPUs []GPUPlan `json:"gpus"`
+}
+
+// GPUPlan is the current and desired state of a single GPU. Its current MIG
+// devices are only known if MIG mode is currently enabled on it.
+type GPUPlan struct {
+	Index             int             `json:"index"`
+	DeviceID          string          `json:"device-id"`
+	MigCapable        bool            `json:"mig-capable"`
+	CurrentMigEnabled bool            `json:"current-mig-enabled"`
+	MigEnabled        bool            `json:"mig-enabled"`
+	CurrentMigDevices types.MigConfig `json:"current-mig-devices,omitempty"`
+	MigDevices        types.MigConfig `json:"mig-devices,omitempty"`
+	MigModeChange     bool            `json:"mig-mode-change"`
+	MigDevicesChange  bool            `json:"mig-devices-change"`
+}
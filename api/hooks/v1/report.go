@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// MaxOutputSize bounds the output of a hook command kept in its
+	// Execution. Only the end of longer output is kept.
+	MaxOutputSize = 64 * 1024
+
+	// outputGracePeriod is how long to keep reading the output of a hook
+	// command after it exits, for processes it left running in the
+	// background.
+	outputGracePeriod = 100 * time.Millisecond
+)
+
+// Report is the record of all hooks run by a single invocation of
+// nvidia-mig-parted.
+type Report struct {
+	Version    string      `json:"version"`
+	Executions []Execution `json:"executions"`
+}
+
+// Execution is the record of a single attempt at running a hook command or
+// calling a hook webhook. For a webhook, the output is the response body and
+// the exit code is always -1.
+type Execution struct {
+	Hook            string          `json:"hook"`
+	Command         string          `json:"command,omitempty"`
+	Args            []string        `json:"args,omitempty"`
+	URL             string          `json:"url,omitempty"`
+	StatusCode      int             `json:"status-code,omitempty"`
+	Attempt         int             `json:"attempt"`
+	Start           metav1.Time     `json:"start"`
+	Duration        metav1.Duration `json:"duration"`
+	ExitCode        int             `json:"exit-code"`
+	Error           string          `json:"error,omitempty"`
+	Output          string          `json:"output,omitempty"`
+	OutputTruncated bool            `json:"output-truncated,omitempty"`
+}
+
+// boundedBuffer is an io.Writer keeping only the last size bytes written to
+// it. It is safe for concurrent use, so that both the stdout and stderr of a
+// hook can be written to it.
+type boundedBuffer struct {
+	mutex     sync.Mutex
+	buf       []byte
+	size      int
+	truncated bool
+}
+
+func newBoundedBuffer(size int) *boundedBuffer {
+	return &boundedBuffer{size: size}
+}
+
+func (b *boundedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.size {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.size:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *boundedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return string(b.buf)
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// AssertValid checks that the spec has a supported version, that all its
+// hooks are named in names and that each of them is valid.
+func (s *Spec) AssertValid(names []string) error {
+	if s.Version != Version {
+		return fmt.Errorf("unknown version: %q", s.Version)
+	}
+
+	known := make(map[string]bool)
+	for _, name := range names {
+		known[name] = true
+	}
+
+	for name, hooks := range s.Hooks {
+		if !known[name] {
+			return fmt.Errorf("unknown hook: %v", name)
+		}
+		for i, hook := range hooks {
+			err := hook.AssertValid()
+			if err != nil {
+				return fmt.Errorf("invalid hook '%v[%v]': %w", name, i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// AssertValid checks that the hook sets exactly one of a command or a
+// webhook, and that all its other fields have valid values.
+func (h *HookSpec) AssertValid() error {
+	if h.Command == "" && h.Webhook == nil {
+		return fmt.Errorf("one of 'command' or 'webhook' is required")
+	}
+	if h.Command != "" && h.Webhook != nil {
+		return fmt.Errorf("only one of 'command' or 'webhook' may be set")
+	}
+	if h.Webhook != nil {
+		if len(h.Args) > 0 || h.Workdir != "" {
+			return fmt.Errorf("'args' and 'workdir' may only be set with 'command'")
+		}
+		err := h.Webhook.AssertValid()
+		if err != nil {
+			return fmt.Errorf("invalid webhook: %w", err)
+		}
+	}
+
+	if h.Timeout.Duration < 0 {
+		return fmt.Errorf("negative timeout: %v", h.Timeout.Duration)
+	}
+	if h.Backoff.Duration < 0 {
+		return fmt.Errorf("negative backoff: %v", h.Backoff.Duration)
+	}
+	if h.Retries < 0 {
+		return fmt.Errorf("negative retries: %v", h.Retries)
+	}
+
+	switch h.OnError {
+	case "", OnErrorFail, OnErrorWarn, OnErrorIgnore:
+	default:
+		return fmt.Errorf("unknown on-error policy: %q", h.OnError)
+	}
+
+	return nil
+}
+
+// AssertValid checks that the webhook has an absolute http or https URL.
+func (w *WebhookSpec) AssertValid() error {
+	if w.URL == "" {
+		return fmt.Errorf("missing required field: url")
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url scheme must be http or https: %v", w.URL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url is missing a host: %v", w.URL)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSpecAssertValid(t *testing.T) {
+	names := []string{"hook0", "hook1"}
+	command := HookSpec{Command: "true"}
+	webhook := HookSpec{Webhook: &WebhookSpec{URL: "https://example.com/hook"}}
+
+	testCases := []struct {
+		Description string
+		Spec        Spec
+		Valid       bool
+	}{
+		{
+			"Empty",
+			Spec{Version: Version},
+			true,
+		},
+		{
+			"Command and webhook",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {command}, "hook1": {command, webhook}}},
+			true,
+		},
+		{
+			"Missing version",
+			Spec{Hooks: HooksMap{"hook0": {command}}},
+			false,
+		},
+		{
+			"Unknown version",
+			Spec{Version: "v2", Hooks: HooksMap{"hook0": {command}}},
+			false,
+		},
+		{
+			"Unknown hook",
+			Spec{Version: Version, Hooks: HooksMap{"hook2": {command}}},
+			false,
+		},
+		{
+			"Neither command nor webhook",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Args: []string{"arg"}}}}},
+			false,
+		},
+		{
+			"Both command and webhook",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Command: "true", Webhook: webhook.Webhook}}}},
+			false,
+		},
+		{
+			"Webhook with args",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Args: []string{"arg"}, Webhook: webhook.Webhook}}}},
+			false,
+		},
+		{
+			"Webhook without URL",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Webhook: &WebhookSpec{}}}}},
+			false,
+		},
+		{
+			"Webhook with relative URL",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Webhook: &WebhookSpec{URL: "/hook"}}}}},
+			false,
+		},
+		{
+			"Webhook with unsupported scheme",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Webhook: &WebhookSpec{URL: "ftp://example.com/hook"}}}}},
+			false,
+		},
+		{
+			"Known on-error policy",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Command: "true", OnError: OnErrorWarn}}}},
+			true,
+		},
+		{
+			"Unknown on-error policy",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Command: "true", OnError: "retry"}}}},
+			false,
+		},
+		{
+			"Negative retries",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Command: "true", Retries: -1}}}},
+			false,
+		},
+		{
+			"Negative timeout",
+			Spec{Version: Version, Hooks: HooksMap{"hook0": {{Command: "true", Timeout: metav1.Duration{Duration: -time.Second}}}}},
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			err := tc.Spec.AssertValid(names)
+			if tc.Valid {
+				require.Nil(t, err, "Unexpected failure Spec.AssertValid")
+			} else {
+				require.NotNil(t, err, "Unexpected success Spec.AssertValid")
+			}
+		})
+	}
+}
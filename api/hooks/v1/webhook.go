@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SignatureHeader is the header holding the HMAC-SHA256 signature of
+	// the body of a webhook request, as "sha256=<hex digest>".
+	SignatureHeader = "X-Mig-Parted-Signature"
+
+	// ContentType is the content type of the body of a webhook request.
+	ContentType = "application/json"
+)
+
+// WebhookSpec is a URL to POST a WebhookPayload to as a hook. Headers are
+// added to the request and, if Secret is set, the body is signed with it in
+// the SignatureHeader header. Any 2xx response is a success.
+type WebhookSpec struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Secret  string            `json:"secret,omitempty"`
+}
+
+// WebhookPayload is the body of a webhook request.
+type WebhookPayload struct {
+	Hook           string     `json:"hook"`
+	SelectedConfig string     `json:"selected-config,omitempty"`
+	Outcome        string     `json:"outcome,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	GPUs           []GPUState `json:"gpus"`
+	Plan           *Plan      `json:"plan,omitempty"`
+	Envs           EnvsMap    `json:"envs"`
+}
+
+// GPUState is the state of a GPU the hook is run for.
+type GPUState struct {
+	Index                int    `json:"index"`
+	UUID                 string `json:"uuid,omitempty"`
+	MigCapable           bool   `json:"mig-capable"`
+	MigModeChanged       bool   `json:"mig-mode-changed"`
+	MigModeChangePending bool   `json:"mig-mode-change-pending"`
+	Reset                bool   `json:"reset"`
+	RebootRequired       bool   `json:"reboot-required"`
+	MigDevicesChanged    bool   `json:"mig-devices-changed"`
+}
+
+// Sign returns the value of the SignatureHeader header for body signed with
+// secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// call POSTs payload to the webhook, recording the response in execution.
+func (w *WebhookSpec) call(ctx context.Context, payload *WebhookPayload, execution *Execution) error {
+	if payload.GPUs == nil {
+		payload.GPUs = []GPUState{}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshalling webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating webhook request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", ContentType)
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+
+	execution.Start = metav1.Now()
+	defer func() {
+		execution.Duration = metav1.Duration{Duration: time.Since(execution.Start.Time)}
+	}()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	captured := newBoundedBuffer(MaxOutputSize)
+	io.Copy(captured, resp.Body)
+	execution.StatusCode = resp.StatusCode
+	execution.Output, execution.OutputTruncated = captured.String(), captured.truncated
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRunWebhook(t *testing.T) {
+	var body []byte
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	hooks := HooksMap{
+		"hook": []HookSpec{
+			{
+				Envs: EnvsMap{"FOO": "bar"},
+				Webhook: &WebhookSpec{
+					URL:     server.URL,
+					Headers: map[string]string{"Authorization": "Bearer token"},
+					Secret:  "secret",
+				},
+			},
+		},
+	}
+	payload := &WebhookPayload{
+		SelectedConfig: "all-1g.5gb",
+		Outcome:        "success",
+		GPUs:           []GPUState{{Index: 0, UUID: "GPU-a", MigCapable: true, MigDevicesChanged: true}},
+	}
+
+	executions, err := hooks.Run(context.Background(), "hook", EnvsMap{"BAZ": "qux"}, payload, false)
+	require.Nil(t, err, "Unexpected failure HooksMap.Run")
+	require.Len(t, executions, 1)
+	require.Equal(t, server.URL, executions[0].URL)
+	require.Equal(t, http.StatusOK, executions[0].StatusCode)
+	require.Equal(t, "ok", executions[0].Output)
+
+	require.Equal(t, ContentType, header.Get("Content-Type"))
+	require.Equal(t, "Bearer token", header.Get("Authorization"))
+	require.Equal(t, Sign("secret", body), header.Get(SignatureHeader))
+
+	var received WebhookPayload
+	err = json.Unmarshal(body, &received)
+	require.Nil(t, err, "Unexpected failure parsing webhook payload")
+	require.Equal(t, "hook", received.Hook)
+	require.Equal(t, "all-1g.5gb", received.SelectedConfig)
+	require.Equal(t, payload.GPUs, received.GPUs)
+	require.Equal(t, EnvsMap{"FOO": "bar", "BAZ": "qux"}, received.Envs)
+	require.Empty(t, payload.Hook, "Payload passed to HooksMap.Run was modified")
+}
+
+func TestRunWebhookFailure(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path == "/slow" {
+			time.Sleep(time.Second)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	hook := HookSpec{
+		Webhook: &WebhookSpec{URL: server.URL},
+		Retries: 1,
+	}
+	executions, err := hook.Run(context.Background(), EnvsMap{}, nil, false)
+	require.NotNil(t, err, "Unexpected success Hook.Run")
+	require.Equal(t, 2, calls)
+	require.Len(t, executions, 2)
+	require.Equal(t, http.StatusInternalServerError, executions[1].StatusCode)
+	require.NotEmpty(t, executions[1].Error)
+
+	hook = HookSpec{
+		Webhook: &WebhookSpec{URL: server.URL + "/slow"},
+		Timeout: metav1.Duration{Duration: 100 * time.Millisecond},
+	}
+	start := time.Now()
+	_, err = hook.Run(context.Background(), EnvsMap{}, nil, false)
+	require.NotNil(t, err, "Unexpected success Hook.Run")
+	require.Less(t, int64(time.Since(start)), int64(time.Second), "Webhook was not bounded by its timeout")
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"github.com/NVIDIA/mig-parted/pkg/types"
+)
+
+const Version = "v1"
+
+// Spec holds the MIG devices of all GPUs of a node, along with where they
+// are placed on their GPU.
+type Spec struct {
+	Version string    `json:"version" yaml:"version"`
+	GPUs    []GPUSpec `json:"gpus"    yaml:"gpus"`
+}
+
+// GPUSpec holds the MIG devices of a single GPU, ordered by their placement.
+// MigDevices is empty if MIG mode is disabled on the GPU.
+type GPUSpec struct {
+	Index      int             `json:"index"       yaml:"index"`
+	UUID       string          `json:"uuid"        yaml:"uuid"`
+	Name       string          `json:"name"        yaml:"name"`
+	PCIAddress string          `json:"pci-address" yaml:"pci-address"`
+	MigEnabled bool            `json:"mig-enabled" yaml:"mig-enabled"`
+	MigDevices []MigDeviceSpec `json:"mig-devices" yaml:"mig-devices"`
+}
+
+// MigDeviceSpec describes a single MIG device: its profile, the memory
+// slices of its GPU it is placed on, and the GPU and compute instances
+// backing it.
+type MigDeviceSpec struct {
+	UUID              string           `json:"uuid"                yaml:"uuid"`
+	Profile           types.MigProfile `json:"profile"             yaml:"profile"`
+	Placement         Placement        `json:"placement"           yaml:"placement"`
+	GpuInstanceID     int              `json:"gpu-instance-id"     yaml:"gpu-instance-id"`
+	ComputeInstanceID int              `json:"compute-instance-id" yaml:"compute-instance-id"`
+	MemoryMB          uint64           `json:"memory-mb"           yaml:"memory-mb"`
+}
+
+// Placement is the range of memory slices of a GPU a MIG device is placed
+// on.
+type Placement struct {
+	Start int `json:"start" yaml:"start"`
+	Size  int `json:"size"  yaml:"size"`
+}
+
+// UUIDsByPlacement returns the UUIDs of the MIG devices of each GPU with MIG
+// mode enabled, keyed by the index of the GPU and then by the start of their
+// placement. This is the format of the original placements export.
+func (s *Spec) UUIDsByPlacement() map[int]map[int]string {
+	uuids := make(map[int]map[int]string)
+	for _, gpu := range s.GPUs {
+		if !gpu.MigEnabled {
+			continue
+		}
+		uuids[gpu.Index] = make(map[int]string)
+		for _, device := range gpu.MigDevices {
+			uuids[gpu.Index][device.Placement.Start] = device.UUID
+		}
+	}
+	return uuids
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+)
+
+func newTestSpec() Spec {
+	return Spec{
+		Version: Version,
+		GPUs: []GPUSpec{
+			{
+				Index:      0,
+				UUID:       "GPU-0",
+				PCIAddress: "0000:01:00.0",
+				MigEnabled: true,
+				MigDevices: []MigDeviceSpec{
+					{
+						UUID:              "MIG-0",
+						Profile:           "3g.20gb",
+						Placement:         Placement{Start: 0, Size: 4},
+						GpuInstanceID:     1,
+						ComputeInstanceID: 0,
+						MemoryMB:          20096,
+					},
+					{
+						UUID:              "MIG-1",
+						Profile:           "1g.5gb",
+						Placement:         Placement{Start: 6, Size: 1},
+						GpuInstanceID:     13,
+						ComputeInstanceID: 0,
+						MemoryMB:          4864,
+					},
+				},
+			},
+			{
+				Index:      1,
+				UUID:       "GPU-1",
+				PCIAddress: "0000:02:00.0",
+				MigEnabled: true,
+				MigDevices: []MigDeviceSpec{},
+			},
+			{
+				Index:      2,
+				UUID:       "GPU-2",
+				PCIAddress: "0000:03:00.0",
+				MigDevices: []MigDeviceSpec{},
+			},
+		},
+	}
+}
+
+func TestMarshallUnmarshall(t *testing.T) {
+	spec := newTestSpec()
+
+	y, err := yaml.Marshal(spec)
+	require.Nil(t, err, "Unexpected failure yaml.Marshal")
+
+	s := Spec{}
+	err = yaml.Unmarshal(y, &s)
+	require.Nil(t, err, "Unexpected failure yaml.Unmarshal")
+
+	require.Equal(t, spec, s, "spec do not match")
+}
+
+func TestUUIDsByPlacement(t *testing.T) {
+	spec := newTestSpec()
+
+	expected := map[int]map[int]string{
+		0: {0: "MIG-0", 6: "MIG-1"},
+		1: {},
+	}
+	require.Equal(t, expected, spec.UUIDsByPlacement())
+}
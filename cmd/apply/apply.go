@@ -19,14 +19,19 @@ package apply
 import (
 	"fmt"
 	"io/ioutil"
-	"reflect"
+	"os"
+	"strings"
+	"time"
 
-	hooks "github.com/NVIDIA/mig-parted/api/hooks/v1"
 	"github.com/NVIDIA/mig-parted/cmd/assert"
+	"github.com/NVIDIA/mig-parted/cmd/export"
+	"github.com/NVIDIA/mig-parted/cmd/util"
+	"github.com/NVIDIA/mig-parted/pkg/metrics"
+	migapply "github.com/NVIDIA/mig-parted/pkg/mig/apply"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/types"
 	"github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli/v2"
-
-	"sigs.k8s.io/yaml"
 )
 
 var log = logrus.New()
@@ -37,13 +42,23 @@ func GetLogger() *logrus.Logger {
 
 type Flags struct {
 	assert.Flags
-	HooksFile string
+	Force           bool
+	InUseTimeout    time.Duration
+	Timeout         time.Duration
+	ModeTimeout     time.Duration
+	ConfigTimeout   time.Duration
+	ResetTimeout    time.Duration
+	HooksTimeout    time.Duration
+	HooksReportFile string
+	ResetMethod     string
+
+	RebootRequiredFile string
+	MetricsTextfile    string
 }
 
 type Context struct {
 	assert.Context
 	Flags *Flags
-	Hooks ApplyHooks
 }
 
 func BuildCommand() *cli.Command {
@@ -95,51 +110,94 @@ func BuildCommand() *cli.Command {
 			Destination: &applyFlags.ModeOnly,
 			EnvVars:     []string{"MIG_PARTED_MODE_CHANGE_ONLY"},
 		},
+		&cli.BoolFlag{
+			Name:        "force",
+			Usage:       "Reconfigure MIG devices even if processes are still running on them",
+			Destination: &applyFlags.Force,
+			EnvVars:     []string{"MIG_PARTED_FORCE"},
+		},
+		&cli.DurationFlag{
+			Name:        "in-use-timeout",
+			Usage:       "Time to wait for running processes to exit before giving up on reconfiguring MIG devices",
+			Destination: &applyFlags.InUseTimeout,
+			EnvVars:     []string{"MIG_PARTED_IN_USE_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "Overall time limit for applying the MIG configuration (0 for no limit)",
+			Destination: &applyFlags.Timeout,
+			EnvVars:     []string{"MIG_PARTED_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "mode-timeout",
+			Usage:       "Time limit for applying the MIG mode to all GPUs, excluding the GPU reset (0 for no limit)",
+			Destination: &applyFlags.ModeTimeout,
+			EnvVars:     []string{"MIG_PARTED_MODE_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "config-timeout",
+			Usage:       "Time limit for applying the MIG device configuration to all GPUs (0 for no limit)",
+			Destination: &applyFlags.ConfigTimeout,
+			EnvVars:     []string{"MIG_PARTED_CONFIG_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "reset-timeout",
+			Usage:       "Time limit for resetting GPUs after a MIG mode change",
+			Value:       migapply.DefaultResetTimeout,
+			Destination: &applyFlags.ResetTimeout,
+			EnvVars:     []string{"MIG_PARTED_RESET_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:        "reset-method",
+			Usage:       fmt.Sprintf("How to reset GPUs after a MIG mode change, one of %v", migapply.ResetMethods),
+			Value:       string(migapply.ResetMethodAuto),
+			Destination: &applyFlags.ResetMethod,
+			EnvVars:     []string{"MIG_PARTED_RESET_METHOD"},
+		},
+		&cli.StringFlag{
+			Name:        "reboot-required-file",
+			Usage:       "File to write the GPUs needing a reboot for their MIG mode change to take effect to (removed once no reboot is required)",
+			Destination: &applyFlags.RebootRequiredFile,
+			EnvVars:     []string{"MIG_PARTED_REBOOT_REQUIRED_FILE"},
+		},
+		&cli.StringFlag{
+			Name:        "metrics-textfile",
+			Usage:       "File to write metrics to in the Prometheus text format, for the textfile collector of the node exporter (counters accumulate across invocations)",
+			Destination: &applyFlags.MetricsTextfile,
+			EnvVars:     []string{"MIG_PARTED_METRICS_TEXTFILE"},
+		},
+		&cli.DurationFlag{
+			Name:        "hooks-timeout",
+			Usage:       "Time limit for each hook to run (0 for no limit)",
+			Destination: &applyFlags.HooksTimeout,
+			EnvVars:     []string{"MIG_PARTED_HOOKS_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:        "hooks-report-file",
+			Usage:       "File to write a JSON report of all hook commands run to, including their output",
+			Destination: &applyFlags.HooksReportFile,
+			EnvVars:     []string{"MIG_PARTED_HOOKS_REPORT_FILE"},
+		},
+		&cli.StringFlag{
+			Name:        "gpus",
+			Usage:       "Comma separated list of GPU indices to operate on, e.g. '0,3' (all GPUs by default)",
+			Destination: &applyFlags.GPUs,
+			EnvVars:     []string{"MIG_PARTED_GPUS"},
+		},
 	}
 
 	return &apply
 }
 
-func ParseHooksFile(f *Flags) (*hooks.Spec, error) {
-	var err error
-	var hooksYaml []byte
-
-	hooksYaml, err = ioutil.ReadFile(f.HooksFile)
-	if err != nil {
-		return nil, fmt.Errorf("read error: %v", err)
-	}
-
-	var spec hooks.Spec
-	err = yaml.Unmarshal(hooksYaml, &spec)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal error: %v", err)
+func applyWrapper(c *cli.Context, f *Flags) error {
+	var m *metrics.Metrics
+	if f.MetricsTextfile != "" {
+		m = metrics.New()
 	}
-
-	return &spec, nil
-}
-
-func (c *Context) HooksEnvsMap() hooks.EnvsMap {
-	envs := make(hooks.EnvsMap)
-	for _, flag := range c.Context.Command.Flags {
-		fv := reflect.ValueOf(flag)
-		for fv.Kind() == reflect.Ptr {
-			fv = reflect.Indirect(fv)
-		}
-
-		value := fv.FieldByName("Destination")
-		for value.Kind() == reflect.Ptr {
-			value = reflect.Indirect(value)
-		}
-
-		for _, name := range fv.FieldByName("EnvVars").Interface().([]string) {
-			envs[name] = fmt.Sprintf("%v", value)
-		}
+	err := applyWrapperWithDefers(c, f, m)
+	if m != nil {
+		util.UpdateMetricsTextfile(c, f.MetricsTextfile, m, err)
 	}
-	return envs
-}
-
-func applyWrapper(c *cli.Context, f *Flags) error {
-	err := applyWrapperWithDefers(c, f)
 	if err != nil {
 		return err
 	}
@@ -147,7 +205,7 @@ func applyWrapper(c *cli.Context, f *Flags) error {
 	return nil
 }
 
-func applyWrapperWithDefers(c *cli.Context, f *Flags) (rerr error) {
+func applyWrapperWithDefers(c *cli.Context, f *Flags, m *metrics.Metrics) error {
 	err := assert.CheckFlags(&f.Flags)
 	if err != nil {
 		cli.ShowSubcommandHelp(c)
@@ -157,23 +215,21 @@ func applyWrapperWithDefers(c *cli.Context, f *Flags) (rerr error) {
 	log.Debugf("Parsing config file...")
 	spec, err := assert.ParseConfigFile(&f.Flags)
 	if err != nil {
-		return fmt.Errorf("error parsing config file: %v", err)
+		return types.NewError(types.ErrorCategoryInvalidConfig, -1, "error parsing config file: %v", err)
 	}
 
 	log.Debugf("Selecting specific MIG config...")
 	migConfig, err := assert.GetSelectedMigConfig(&f.Flags, spec)
 	if err != nil {
-		return fmt.Errorf("error selecting MIG config: %v", err)
+		return types.NewError(types.ErrorCategoryInvalidConfig, -1, "error selecting MIG config: %v", err)
 	}
 
-	hooksSpec := &hooks.Spec{}
-	if f.HooksFile != "" {
-		log.Debugf("Parsing Hooks file...")
-		hooksSpec, err = ParseHooksFile(f)
-		if err != nil {
-			return fmt.Errorf("error parsing hooks file: %v", err)
-		}
+	log.Debugf("Parsing Hooks file...")
+	hooks, err := util.NewHooks(c, f.HooksFile, f.HooksTimeout)
+	if err != nil {
+		return err
 	}
+	hooks.Metrics = m
 
 	context := Context{
 		Context: assert.Context{
@@ -182,62 +238,89 @@ func applyWrapperWithDefers(c *cli.Context, f *Flags) (rerr error) {
 			MigConfig: migConfig,
 		},
 		Flags: f,
-		Hooks: &applyHooks{hooksSpec.Hooks},
 	}
 
-	log.Debugf("Running apply-start hook")
-	err = context.Hooks.ApplyStart(context.HooksEnvsMap(), c.Bool("debug"))
+	resetMethod, err := migapply.ParseResetMethod(f.ResetMethod)
 	if err != nil {
-		return fmt.Errorf("error running apply-start hook: %v", err)
+		return err
 	}
 
-	defer func() {
-		log.Debugf("Running apply-exit hook")
-		err := context.Hooks.ApplyExit(context.HooksEnvsMap(), c.Bool("debug"))
-		if rerr == nil && err != nil {
-			rerr = fmt.Errorf("error running apply-exit hook: %v", err)
-			return
-		}
-		if err != nil {
-			log.Errorf("Error running apply-exit hook: %v", err)
-		}
-	}()
+	nvidiaModuleLoaded, err := util.IsNvidiaModuleLoaded()
+	if err != nil {
+		return fmt.Errorf("error checking if nvidia module loaded: %w", err)
+	}
+	log.Debugf("NVIDIA kernel module loaded: %v", nvidiaModuleLoaded)
 
-	log.Debugf("Checking current MIG mode...")
-	err = assert.AssertMigMode(&context.Context)
+	resetter, err := migapply.NewResetter(resetMethod, nvidiaModuleLoaded)
 	if err != nil {
-		log.Debugf("Running pre-apply-mode hook")
-		err := context.Hooks.PreApplyMode(context.HooksEnvsMap(), c.Bool("debug"))
-		if err != nil {
-			return fmt.Errorf("error running pre-apply-mode hook: %v", err)
-		}
+		return err
+	}
 
-		log.Debugf("Applying MIG mode change...")
-		err = ApplyMigMode(&context)
-		if err != nil {
-			return err
-		}
+	all, selected, err := util.NewGPUEnumerators(c.String("sysfs-root"), f.GPUs)
+	if err != nil {
+		return err
 	}
 
-	if f.ModeOnly {
-		return nil
+	opts := []migapply.Option{
+		migapply.WithGPUEnumerator(selected),
+		migapply.WithHooks(hooks),
+		migapply.WithSkipReset(f.SkipReset),
+		migapply.WithModeOnly(f.ModeOnly),
+		migapply.WithForce(f.Force),
+		migapply.WithInUseTimeout(f.InUseTimeout),
+		migapply.WithTimeout(f.Timeout),
+		migapply.WithModeTimeout(f.ModeTimeout),
+		migapply.WithConfigTimeout(f.ConfigTimeout),
+		migapply.WithResetTimeout(f.ResetTimeout),
+		migapply.WithResetter(metrics.InstrumentResetter(resetter, m)),
+		migapply.WithModeManager(util.NewMigModeManager(c, all, nvidiaModuleLoaded)),
+	}
+	if nvidiaModuleLoaded {
+		opts = append(opts, migapply.WithUUIDGetter(config.NewNvmlUUIDGetter()))
 	}
 
-	log.Debugf("Checking current MIG device configuration...")
-	err = assert.AssertMigConfig(&context.Context)
+	log.Debugf("Waiting for lock...")
+	unlock, err := util.LockNode(c)
 	if err != nil {
-		log.Debugf("Running pre-apply-config hook")
-		err := context.Hooks.PreApplyConfig(context.HooksEnvsMap(), c.Bool("debug"))
-		if err != nil {
-			return fmt.Errorf("error running pre-apply-config hook: %v", err)
+		return err
+	}
+	defer unlock()
+
+	defer export.WriteHooksExportFile(c, hooks)()
+
+	result, err := migapply.New(opts...).Apply(context.StopContext(), migConfig)
+	if f.HooksReportFile != "" {
+		reportErr := hooks.WriteReport(f.HooksReportFile)
+		if reportErr != nil {
+			log.Errorf("Error writing hooks report: %v", reportErr)
 		}
+	}
+	if f.RebootRequiredFile != "" && (err == nil || result.RebootRequired()) {
+		markerErr := updateRebootRequiredFile(f.RebootRequiredFile, result)
+		if markerErr != nil {
+			log.Errorf("Error updating reboot-required file: %v", markerErr)
+		}
+	}
+	return err
+}
 
-		log.Debugf("Applying MIG device configuration...")
-		err = ApplyMigConfig(&context)
-		if err != nil {
+// updateRebootRequiredFile writes the GPUs that need a reboot for their MIG
+// mode change to take effect to path, one per line with the reason why, or
+// removes path if none do.
+func updateRebootRequiredFile(path string, result *migapply.Result) error {
+	if !result.RebootRequired() {
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
 			return err
 		}
+		return nil
 	}
 
-	return nil
+	var b strings.Builder
+	for _, gpu := range result.GPUs {
+		if gpu.RebootRequired {
+			fmt.Fprintf(&b, "GPU %v: %v\n", gpu.GPU, gpu.RebootReason)
+		}
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), 0644)
 }
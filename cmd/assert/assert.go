@@ -18,6 +18,7 @@ package assert
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -25,12 +26,12 @@ import (
 
 	"github.com/NVIDIA/mig-parted/api/spec/v1"
 	"github.com/NVIDIA/mig-parted/cmd/util"
+	migassert "github.com/NVIDIA/mig-parted/pkg/mig/assert"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
 	"github.com/NVIDIA/mig-parted/pkg/types"
 	"github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli/v2"
 
-	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
-
 	"sigs.k8s.io/yaml"
 )
 
@@ -46,6 +47,9 @@ type Flags struct {
 	SkipReset      bool
 	ModeOnly       bool
 	ValidConfig    bool
+	ValidHooks     bool
+	HooksFile      string
+	GPUs           string
 }
 
 type Context struct {
@@ -54,6 +58,13 @@ type Context struct {
 	MigConfig v1.MigConfigSpecSlice
 }
 
+// StopContext returns the context that is canceled when the process is asked
+// to terminate. It is checked between GPUs so that work is never abandoned
+// half way through a single GPU.
+func (c *Context) StopContext() context.Context {
+	return c.Context.Context
+}
+
 func BuildCommand() *cli.Command {
 	// Create a flags struct to hold our flags
 	assertFlags := Flags{}
@@ -96,6 +107,25 @@ func BuildCommand() *cli.Command {
 			Destination: &assertFlags.ValidConfig,
 			EnvVars:     []string{"MIG_PARTED_VALID_CONFIG"},
 		},
+		&cli.BoolFlag{
+			Name:        "valid-hooks",
+			Usage:       "Only assert that the hooks file is valid (and the config file as well, if combined with --valid-config)",
+			Destination: &assertFlags.ValidHooks,
+			EnvVars:     []string{"MIG_PARTED_VALID_HOOKS"},
+		},
+		&cli.StringFlag{
+			Name:        "hooks-file",
+			Aliases:     []string{"k"},
+			Usage:       "Path to the hooks file to assert is valid with --valid-hooks",
+			Destination: &assertFlags.HooksFile,
+			EnvVars:     []string{"MIG_PARTED_HOOKS_FILE"},
+		},
+		&cli.StringFlag{
+			Name:        "gpus",
+			Usage:       "Comma separated list of GPU indices to operate on, e.g. '0,3' (all GPUs by default)",
+			Destination: &assertFlags.GPUs,
+			EnvVars:     []string{"MIG_PARTED_GPUS"},
+		},
 	}
 
 	return &assert
@@ -108,31 +138,50 @@ func assertWrapper(c *cli.Context, f *Flags) error {
 		return err
 	}
 
+	if f.ValidHooks {
+		log.Debugf("Parsing hooks file...")
+		_, err := util.ParseHooksFile(f.HooksFile)
+		if err != nil {
+			return types.NewError(types.ErrorCategoryInvalidConfig, -1, "error parsing hooks file: %v", err)
+		}
+		if !f.ValidConfig {
+			fmt.Println("Hooks file is valid")
+			return nil
+		}
+	}
+
 	log.Debugf("Parsing config file...")
 	spec, err := ParseConfigFile(f)
 	if err != nil {
-		return fmt.Errorf("error parsing config file: %v", err)
+		return types.NewError(types.ErrorCategoryInvalidConfig, -1, "error parsing config file: %v", err)
 	}
 
 	log.Debugf("Selecting specific MIG config...")
 	migConfig, err := GetSelectedMigConfig(f, spec)
 	if err != nil {
-		return fmt.Errorf("error selecting MIG config: %v", err)
+		return types.NewError(types.ErrorCategoryInvalidConfig, -1, "error selecting MIG config: %v", err)
 	}
 
 	if f.ValidConfig {
+		if f.ValidHooks {
+			fmt.Println("Hooks file is valid")
+		}
 		fmt.Println("Selected MIG configuration is valid")
 		return nil
 	}
 
-	context := Context{
-		Context:   c,
-		Flags:     f,
-		MigConfig: migConfig,
+	all, selected, err := util.NewGPUEnumerators(c.String("sysfs-root"), f.GPUs)
+	if err != nil {
+		return err
 	}
 
+	asserter := migassert.New(
+		migassert.WithModeManager(mode.NewPciMigModeManagerWith(all, util.PciMigModeOptions(c)...)),
+		migassert.WithGPUEnumerator(selected),
+	)
+
 	log.Debugf("Asserting MIG mode configuration...")
-	err = AssertMigMode(&context)
+	_, err = asserter.AssertMigMode(c.Context, migConfig)
 	if err != nil {
 		log.Debug(util.Capitalize(err.Error()))
 		return fmt.Errorf("Assertion failure: selected configuration not currently applied")
@@ -144,7 +193,7 @@ func assertWrapper(c *cli.Context, f *Flags) error {
 	}
 
 	log.Debugf("Asserting MIG device configuration...")
-	err = AssertMigConfig(&context)
+	_, err = asserter.AssertMigConfig(c.Context, migConfig)
 	if err != nil {
 		log.Debug(util.Capitalize(err.Error()))
 		return fmt.Errorf("Assertion failure: selected configuration not currently applied")
@@ -156,9 +205,12 @@ func assertWrapper(c *cli.Context, f *Flags) error {
 
 func CheckFlags(f *Flags) error {
 	var missing []string
-	if f.ConfigFile == "" {
+	if f.ConfigFile == "" && (!f.ValidHooks || f.ValidConfig) {
 		missing = append(missing, "config-file")
 	}
+	if f.HooksFile == "" && f.ValidHooks {
+		missing = append(missing, "hooks-file")
+	}
 	if len(missing) > 0 {
 		return fmt.Errorf("missing required flags '%v'", strings.Join(missing, ", "))
 	}
@@ -178,14 +230,14 @@ func ParseConfigFile(f *Flags) (*v1.Spec, error) {
 	} else {
 		configYaml, err = ioutil.ReadFile(f.ConfigFile)
 		if err != nil {
-			return nil, fmt.Errorf("read error: %v", err)
+			return nil, fmt.Errorf("read error: %w", err)
 		}
 	}
 
 	var spec v1.Spec
 	err = yaml.Unmarshal(configYaml, &spec)
 	if err != nil {
-		return nil, fmt.Errorf("unmarshal error: %v", err)
+		return nil, fmt.Errorf("unmarshal error: %w", err)
 	}
 
 	return &spec, nil
@@ -208,40 +260,3 @@ func GetSelectedMigConfig(f *Flags, spec *v1.Spec) (v1.MigConfigSpecSlice, error
 
 	return spec.MigConfigs[f.SelectedConfig], nil
 }
-
-func WalkSelectedMigConfigForEachGPU(migConfig v1.MigConfigSpecSlice, f func(*v1.MigConfigSpec, int, types.DeviceID) error) error {
-	nvpci := nvpci.New()
-	gpus, err := nvpci.GetGPUs()
-	if err != nil {
-		return fmt.Errorf("Error enumerating GPUs: %v", err)
-	}
-
-	for _, mc := range migConfig {
-		if mc.DeviceFilter == nil {
-			log.Debugf("Walking MigConfig for (devices=%v)", mc.Devices)
-		} else {
-			log.Debugf("Walking MigConfig for (device-filter=%v, devices=%v)", mc.DeviceFilter, mc.Devices)
-		}
-
-		for i, gpu := range gpus {
-			deviceID := types.NewDeviceID(gpu.Device, gpu.Vendor)
-
-			if !mc.MatchesDeviceFilter(deviceID) {
-				continue
-			}
-
-			if !mc.MatchesDevices(i) {
-				continue
-			}
-
-			log.Debugf("  GPU %v: %v", i, deviceID)
-
-			err = f(&mc, i, deviceID)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
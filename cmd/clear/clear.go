@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clear
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/mig-parted/cmd/export"
+	"github.com/NVIDIA/mig-parted/cmd/util"
+	migapply "github.com/NVIDIA/mig-parted/pkg/mig/apply"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+)
+
+var log = logrus.New()
+
+func GetLogger() *logrus.Logger {
+	return log
+}
+
+type Flags struct {
+	GPUs            string
+	HooksFile       string
+	HooksTimeout    time.Duration
+	HooksReportFile string
+	Force           bool
+	InUseTimeout    time.Duration
+	Timeout         time.Duration
+}
+
+func BuildCommand() *cli.Command {
+	// Create a flags struct to hold our flags
+	clearFlags := Flags{}
+
+	// Create the 'clear' command
+	clear := cli.Command{}
+	clear.Name = "clear"
+	clear.Usage = "Destroy all MIG devices on the GPUs of the node, leaving their MIG mode unchanged"
+	clear.Action = func(c *cli.Context) error {
+		return clearWrapper(c, &clearFlags)
+	}
+
+	// Setup the flags for this command
+	clear.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "gpus",
+			Usage:       "Comma separated list of GPU indices to operate on, e.g. '0,3' (all GPUs by default)",
+			Destination: &clearFlags.GPUs,
+			EnvVars:     []string{"MIG_PARTED_GPUS"},
+		},
+		&cli.StringFlag{
+			Name:        "hooks-file",
+			Aliases:     []string{"k"},
+			Usage:       "Path to the hooks file",
+			Destination: &clearFlags.HooksFile,
+			EnvVars:     []string{"MIG_PARTED_HOOKS_FILE"},
+		},
+		&cli.DurationFlag{
+			Name:        "hooks-timeout",
+			Usage:       "Time limit for each hook to run (0 for no limit)",
+			Destination: &clearFlags.HooksTimeout,
+			EnvVars:     []string{"MIG_PARTED_HOOKS_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:        "hooks-report-file",
+			Usage:       "File to write a JSON report of all hook commands run to, including their output",
+			Destination: &clearFlags.HooksReportFile,
+			EnvVars:     []string{"MIG_PARTED_HOOKS_REPORT_FILE"},
+		},
+		&cli.BoolFlag{
+			Name:        "force",
+			Usage:       "Destroy MIG devices even if processes are still running on them",
+			Destination: &clearFlags.Force,
+			EnvVars:     []string{"MIG_PARTED_FORCE"},
+		},
+		&cli.DurationFlag{
+			Name:        "in-use-timeout",
+			Usage:       "Time to wait for running processes to exit before giving up on destroying MIG devices",
+			Destination: &clearFlags.InUseTimeout,
+			EnvVars:     []string{"MIG_PARTED_IN_USE_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "Overall time limit for destroying the MIG devices (0 for no limit)",
+			Destination: &clearFlags.Timeout,
+			EnvVars:     []string{"MIG_PARTED_TIMEOUT"},
+		},
+	}
+
+	return &clear
+}
+
+func clearWrapper(c *cli.Context, f *Flags) error {
+	log.Debugf("Parsing Hooks file...")
+	hooks, err := util.NewHooks(c, f.HooksFile, f.HooksTimeout)
+	if err != nil {
+		return err
+	}
+
+	nvidiaModuleLoaded, err := util.IsNvidiaModuleLoaded()
+	if err != nil {
+		return fmt.Errorf("error checking if nvidia module loaded: %w", err)
+	}
+	if !nvidiaModuleLoaded {
+		return types.NewError(types.ErrorCategoryDriverNotLoaded, -1, "the NVIDIA kernel module must be loaded to destroy MIG devices")
+	}
+
+	all, selected, err := util.NewGPUEnumerators(c.String("sysfs-root"), f.GPUs)
+	if err != nil {
+		return err
+	}
+
+	applier := migapply.New(
+		migapply.WithGPUEnumerator(selected),
+		migapply.WithModeManager(util.NewMigModeManager(c, all, nvidiaModuleLoaded)),
+		migapply.WithHooks(hooks),
+		migapply.WithUUIDGetter(config.NewNvmlUUIDGetter()),
+		migapply.WithForce(f.Force),
+		migapply.WithInUseTimeout(f.InUseTimeout),
+		migapply.WithTimeout(f.Timeout),
+	)
+
+	log.Debugf("Waiting for lock...")
+	unlock, err := util.LockNode(c)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	defer export.WriteHooksExportFile(c, hooks)()
+
+	result, err := applier.Clear(c.Context)
+	if f.HooksReportFile != "" {
+		reportErr := hooks.WriteReport(f.HooksReportFile)
+		if reportErr != nil {
+			log.Errorf("Error writing hooks report: %v", reportErr)
+		}
+	}
+	printCleared(result)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("MIG devices cleared successfully")
+	return nil
+}
+
+// printCleared prints the MIG devices destroyed on each GPU.
+func printCleared(result *migapply.Result) {
+	for _, gpu := range result.GPUs {
+		if len(gpu.ClearedMigDevices) == 0 {
+			continue
+		}
+		fmt.Printf("GPU %v: destroyed %v\n", gpu.GPU, formatMigConfig(gpu.ClearedMigDevices))
+	}
+}
+
+func formatMigConfig(config types.MigConfig) string {
+	var profiles []string
+	for profile, count := range config {
+		if count > 0 {
+			profiles = append(profiles, fmt.Sprintf("%v x%v", profile, count))
+		}
+	}
+	sort.Strings(profiles)
+	return strings.Join(profiles, ", ")
+}
@@ -0,0 +1,445 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/cmd/assert"
+	"github.com/NVIDIA/mig-parted/cmd/export"
+	"github.com/NVIDIA/mig-parted/cmd/util"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	migassert "github.com/NVIDIA/mig-parted/pkg/mig/assert"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
+)
+
+var log = logrus.New()
+
+func GetLogger() *logrus.Logger {
+	return log
+}
+
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+
+	// LiveSide names the side of a diff holding the current MIG config of
+	// the node.
+	LiveSide = "live"
+)
+
+type Flags struct {
+	ConfigFiles     cli.StringSlice
+	SelectedConfigs cli.StringSlice
+	Live            bool
+	Inventory       string
+	OutputFormat    string
+}
+
+// Diff holds the GPUs whose MIG config differs between two sides, each
+// being a selected MIG config of a config file or the live node.
+type Diff struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	GPUs []GPUDiff `json:"gpus"`
+}
+
+// GPUDiff is the MIG config of a single GPU on each side of a diff. A side
+// is nil if no entry of its MIG config selects the GPU, in which case
+// applying it leaves the GPU as is.
+type GPUDiff struct {
+	Index    int        `json:"index"`
+	DeviceID string     `json:"device-id"`
+	From     *GPUConfig `json:"from"`
+	To       *GPUConfig `json:"to"`
+}
+
+// GPUConfig is the MIG config a side of a diff resolves to for a GPU.
+type GPUConfig struct {
+	MigEnabled bool            `json:"mig-enabled"`
+	MigDevices types.MigConfig `json:"mig-devices,omitempty"`
+}
+
+// side is a selected MIG config of a config file, or the live node if file
+// is empty.
+type side struct {
+	file   string
+	config string
+}
+
+func BuildCommand() *cli.Command {
+	// Create a flags struct to hold our flags
+	diffFlags := Flags{}
+
+	// Create the 'diff' command
+	diff := cli.Command{}
+	diff.Name = "diff"
+	diff.Usage = "Show the GPUs whose MIG configuration differs between two MIG configurations, or a MIG configuration and the node"
+	diff.Action = func(c *cli.Context) error {
+		return diffWrapper(c, &diffFlags)
+	}
+
+	// Setup the flags for this command
+	diff.Flags = []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "config-file",
+			Aliases:     []string{"f"},
+			Usage:       "Path to the configuration file of each side (once to use the same file for both)",
+			Destination: &diffFlags.ConfigFiles,
+			EnvVars:     []string{"MIG_PARTED_CONFIG_FILE"},
+		},
+		&cli.StringSliceFlag{
+			Name:        "selected-config",
+			Aliases:     []string{"c"},
+			Usage:       "The label of the mig-config of each side (once to use the same label for both)",
+			Destination: &diffFlags.SelectedConfigs,
+			EnvVars:     []string{"MIG_PARTED_SELECTED_CONFIG"},
+		},
+		&cli.BoolFlag{
+			Name:        "live",
+			Usage:       "Compare the selected mig-config against the current MIG configuration of the node",
+			Destination: &diffFlags.Live,
+			Value:       false,
+			EnvVars:     []string{"MIG_PARTED_DIFF_LIVE"},
+		},
+		&cli.StringFlag{
+			Name:        "inventory",
+			Usage:       "Comma separated list of the device IDs of the GPUs to resolve the configs on, in order of GPU index, instead of those of the node, e.g. '0x20B010DE*4,0x20B210DE*4'",
+			Destination: &diffFlags.Inventory,
+			EnvVars:     []string{"MIG_PARTED_DIFF_INVENTORY"},
+		},
+		&cli.StringFlag{
+			Name:        "output-format",
+			Aliases:     []string{"o"},
+			Usage:       "Format for the output [text | json]",
+			Destination: &diffFlags.OutputFormat,
+			Value:       TextFormat,
+			EnvVars:     []string{"MIG_PARTED_OUTPUT_FORMAT"},
+		},
+	}
+
+	return &diff
+}
+
+func diffWrapper(c *cli.Context, f *Flags) error {
+	err := CheckFlags(f)
+	if err != nil {
+		cli.ShowSubcommandHelp(c)
+		return err
+	}
+
+	var gpus enumerator.Interface
+	if f.Inventory != "" {
+		gpus, err = ParseInventory(f.Inventory)
+	} else {
+		gpus, _, err = util.NewGPUEnumerators(c.String("sysfs-root"), "")
+	}
+	if err != nil {
+		return err
+	}
+
+	from, to := getSides(f)
+
+	fromConfig, err := getMigConfig(c, &from)
+	if err != nil {
+		return err
+	}
+	toConfig, err := getMigConfig(c, &to)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Resolving MIG configs on each GPU...")
+	diff, err := NewDiff(c.Context, gpus, fromConfig, toConfig)
+	if err != nil {
+		return err
+	}
+	diff.From = from.String()
+	diff.To = to.String()
+
+	return WriteDiff(c.App.Writer, diff, f.OutputFormat)
+}
+
+func CheckFlags(f *Flags) error {
+	switch f.OutputFormat {
+	case TextFormat:
+	case JSONFormat:
+	default:
+		return fmt.Errorf("unrecognized 'output-format': %v", f.OutputFormat)
+	}
+
+	files := f.ConfigFiles.Value()
+	configs := f.SelectedConfigs.Value()
+	if len(files) == 0 {
+		return fmt.Errorf("missing required flag 'config-file'")
+	}
+	if len(files) > 2 || len(configs) > 2 {
+		return fmt.Errorf("'config-file' and 'selected-config' may each be given at most twice")
+	}
+
+	if f.Live {
+		if len(files) != 1 || len(configs) > 1 {
+			return fmt.Errorf("'live' requires a single 'config-file' and 'selected-config'")
+		}
+		if f.Inventory != "" {
+			return fmt.Errorf("'live' cannot be combined with 'inventory'")
+		}
+		return nil
+	}
+
+	if len(files) != 2 && len(configs) != 2 {
+		return fmt.Errorf("either 'live', or a second 'config-file' or 'selected-config' is required")
+	}
+	return nil
+}
+
+// getSides returns the sides of the diff set by the flags, as checked by
+// CheckFlags. A 'config-file' or 'selected-config' given once applies to
+// both sides.
+func getSides(f *Flags) (side, side) {
+	files := f.ConfigFiles.Value()
+	configs := f.SelectedConfigs.Value()
+
+	nth := func(values []string, i int) string {
+		if len(values) == 0 {
+			return ""
+		}
+		if i >= len(values) {
+			i = len(values) - 1
+		}
+		return values[i]
+	}
+
+	from := side{nth(files, 0), nth(configs, 0)}
+	if f.Live {
+		return from, side{}
+	}
+	return from, side{nth(files, 1), nth(configs, 1)}
+}
+
+func (s side) String() string {
+	if s.file == "" {
+		return LiveSide
+	}
+	return fmt.Sprintf("%s (%s)", s.file, s.config)
+}
+
+// getMigConfig returns the MIG config of a side of the diff. The selected
+// config of a side is set if it was left for its config file to pick.
+func getMigConfig(c *cli.Context, s *side) (v1.MigConfigSpecSlice, error) {
+	if s.file == "" {
+		log.Debugf("Exporting the current MIG config of the node...")
+		spec, err := export.ExportMigConfigs(&export.Context{
+			Context: c,
+			Flags:   &export.Flags{ConfigLabel: export.DefaultConfigLabel},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error exporting the current MIG config: %w", err)
+		}
+		return spec.MigConfigs[export.DefaultConfigLabel], nil
+	}
+
+	assertFlags := &assert.Flags{
+		ConfigFile:     s.file,
+		SelectedConfig: s.config,
+	}
+
+	log.Debugf("Parsing config file %v...", s.file)
+	spec, err := assert.ParseConfigFile(assertFlags)
+	if err != nil {
+		return nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "error parsing config file %v: %v", s.file, err)
+	}
+
+	log.Debugf("Selecting specific MIG config...")
+	migConfig, err := assert.GetSelectedMigConfig(assertFlags, spec)
+	if err != nil {
+		return nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "error selecting MIG config from %v: %v", s.file, err)
+	}
+	s.config = assertFlags.SelectedConfig
+
+	return migConfig, nil
+}
+
+// ParseInventory returns an enumerator for GPUs with the device IDs of a
+// comma separated list, in order of GPU index. Each device ID may be followed
+// by '*<count>' to repeat it, e.g. '0x20B010DE*4,0x20B210DE*4'.
+func ParseInventory(s string) (enumerator.Interface, error) {
+	var devices []*nvpci.NvidiaPCIDevice
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+
+		count := 1
+		if parts := strings.SplitN(field, "*", 2); len(parts) == 2 {
+			c, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil || c < 1 {
+				return nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "invalid GPU count in inventory: '%v'", field)
+			}
+			field, count = strings.TrimSpace(parts[0]), c
+		}
+
+		deviceID, err := types.NewDeviceIDFromString(field)
+		if err != nil {
+			return nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "invalid device ID in inventory: %v", err)
+		}
+
+		for i := 0; i < count; i++ {
+			devices = append(devices, &nvpci.NvidiaPCIDevice{
+				Vendor: deviceID.GetVendor(),
+				Device: deviceID.GetDevice(),
+			})
+		}
+	}
+	return enumerator.NewFake(devices...), nil
+}
+
+// ResolveMigConfig returns the MIG config that migConfig sets on each GPU
+// of gpus, keyed by GPU index, as applying it would. GPUs selected by no
+// entry of migConfig are left out, and GPUs selected by several entries get
+// the last of them.
+func ResolveMigConfig(ctx context.Context, gpus enumerator.Interface, migConfig v1.MigConfigSpecSlice) (map[int]*GPUConfig, error) {
+	resolved := make(map[int]*GPUConfig)
+	err := migassert.WalkSelectedMigConfigForEachGPU(ctx, gpus, migConfig, func(mc *v1.MigConfigSpec, i int, d types.DeviceID) error {
+		config := &GPUConfig{
+			MigEnabled: mc.MigEnabled,
+		}
+		if mc.MigEnabled {
+			config.MigDevices = types.MigConfig{}
+			for profile, count := range mc.MigDevices {
+				if count > 0 {
+					config.MigDevices[profile] = count
+				}
+			}
+		}
+		resolved[i] = config
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// NewDiff resolves two MIG configs on gpus, and returns the GPUs on which
+// they differ.
+func NewDiff(ctx context.Context, gpus enumerator.Interface, from, to v1.MigConfigSpecSlice) (*Diff, error) {
+	devices, err := gpus.GetGPUs()
+	if err != nil {
+		return nil, fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+
+	fromConfigs, err := ResolveMigConfig(ctx, gpus, from)
+	if err != nil {
+		return nil, err
+	}
+	toConfigs, err := ResolveMigConfig(ctx, gpus, to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &Diff{
+		GPUs: []GPUDiff{},
+	}
+	for _, device := range devices {
+		i := device.Index
+		if equalGPUConfigs(fromConfigs[i], toConfigs[i]) {
+			continue
+		}
+		diff.GPUs = append(diff.GPUs, GPUDiff{
+			Index:    i,
+			DeviceID: types.NewDeviceID(device.Device, device.Vendor).String(),
+			From:     fromConfigs[i],
+			To:       toConfigs[i],
+		})
+	}
+
+	return diff, nil
+}
+
+func equalGPUConfigs(a, b *GPUConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.MigEnabled != b.MigEnabled {
+		return false
+	}
+	return a.MigDevices.Equals(b.MigDevices)
+}
+
+// WriteDiff writes diff to w in the given output format.
+func WriteDiff(w io.Writer, diff *Diff, format string) error {
+	switch format {
+	case JSONFormat:
+		output, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling diff to JSON: %w", err)
+		}
+		_, err = w.Write(append(output, '\n'))
+		return err
+	case TextFormat:
+		return writeText(w, diff)
+	}
+	return fmt.Errorf("unrecognized 'output-format': %v", format)
+}
+
+func writeText(w io.Writer, diff *Diff) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "--- %s\n", diff.From)
+	fmt.Fprintf(&b, "+++ %s\n", diff.To)
+	if len(diff.GPUs) == 0 {
+		fmt.Fprintf(&b, "No differences\n")
+	}
+	for _, gpu := range diff.GPUs {
+		fmt.Fprintf(&b, "GPU %d (%s)\n", gpu.Index, gpu.DeviceID)
+		fmt.Fprintf(&b, "- %s\n", formatGPUConfig(gpu.From))
+		fmt.Fprintf(&b, "+ %s\n", formatGPUConfig(gpu.To))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func formatGPUConfig(config *GPUConfig) string {
+	if config == nil {
+		return "not configured"
+	}
+	if !config.MigEnabled {
+		return "mig-enabled: false"
+	}
+	if len(config.MigDevices) == 0 {
+		return "mig-enabled: true, mig-devices: none"
+	}
+
+	var devices []string
+	for profile, count := range config.MigDevices {
+		devices = append(devices, fmt.Sprintf("%s: %d", profile, count))
+	}
+	sort.Strings(devices)
+
+	return fmt.Sprintf("mig-enabled: true, mig-devices: {%s}", strings.Join(devices, ", "))
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+	cli "github.com/urfave/cli/v2"
+)
+
+func TestParseInventory(t *testing.T) {
+	gpus, err := ParseInventory("0x20B010DE*2, 0x20B210DE")
+	require.Nil(t, err)
+
+	devices, err := gpus.GetGPUs()
+	require.Nil(t, err)
+	require.Len(t, devices, 3)
+	for i, device := range devices {
+		require.Equal(t, i, device.Index)
+		require.Equal(t, uint16(0x10DE), device.Vendor)
+	}
+	require.Equal(t, uint16(0x20B0), devices[0].Device)
+	require.Equal(t, uint16(0x20B0), devices[1].Device)
+	require.Equal(t, uint16(0x20B2), devices[2].Device)
+
+	for _, inventory := range []string{"", "A100", "0x20B010DE*", "0x20B010DE*0", "0x20B010DE,,0x20B210DE"} {
+		_, err := ParseInventory(inventory)
+		require.NotNil(t, err, "Unexpected success parsing inventory '%v'", inventory)
+	}
+}
+
+func TestResolveMigConfig(t *testing.T) {
+	gpus, err := ParseInventory("0x20B010DE*2,0x20B210DE*2")
+	require.Nil(t, err)
+
+	migConfig := v1.MigConfigSpecSlice{
+		{
+			Devices:    "all",
+			MigEnabled: false,
+		},
+		{
+			DeviceFilter: "0x20B210DE",
+			Devices:      "all",
+			MigEnabled:   true,
+			MigDevices:   types.MigConfig{"1g.10gb": 7, "2g.20gb": 0},
+		},
+		{
+			DeviceFilter: []string{"0x20B010DE", "0x20B210DE"},
+			Devices:      []int{1, 3},
+			MigEnabled:   true,
+			MigDevices:   types.MigConfig{},
+		},
+	}
+
+	resolved, err := ResolveMigConfig(context.Background(), gpus, migConfig)
+	require.Nil(t, err)
+	require.Equal(t, map[int]*GPUConfig{
+		0: {MigEnabled: false},
+		1: {MigEnabled: true, MigDevices: types.MigConfig{}},
+		2: {MigEnabled: true, MigDevices: types.MigConfig{"1g.10gb": 7}},
+		3: {MigEnabled: true, MigDevices: types.MigConfig{}},
+	}, resolved)
+}
+
+func TestNewDiff(t *testing.T) {
+	gpus, err := ParseInventory("0x20B010DE*4")
+	require.Nil(t, err)
+
+	from := v1.MigConfigSpecSlice{
+		{
+			Devices:    "all",
+			MigEnabled: true,
+			MigDevices: types.MigConfig{"1g.5gb": 7},
+		},
+	}
+	to := v1.MigConfigSpecSlice{
+		{
+			Devices:    []int{0, 1},
+			MigEnabled: true,
+			MigDevices: types.MigConfig{"1g.5gb": 7},
+		},
+		{
+			Devices:    []int{2},
+			MigEnabled: true,
+			MigDevices: types.MigConfig{"3g.20gb": 2},
+		},
+	}
+
+	diff, err := NewDiff(context.Background(), gpus, from, to)
+	require.Nil(t, err)
+	require.Equal(t, []GPUDiff{
+		{
+			Index:    2,
+			DeviceID: "0x20B010DE",
+			From:     &GPUConfig{MigEnabled: true, MigDevices: types.MigConfig{"1g.5gb": 7}},
+			To:       &GPUConfig{MigEnabled: true, MigDevices: types.MigConfig{"3g.20gb": 2}},
+		},
+		{
+			Index:    3,
+			DeviceID: "0x20B010DE",
+			From:     &GPUConfig{MigEnabled: true, MigDevices: types.MigConfig{"1g.5gb": 7}},
+		},
+	}, diff.GPUs)
+
+	diff, err = NewDiff(context.Background(), gpus, from, from)
+	require.Nil(t, err)
+	require.Empty(t, diff.GPUs)
+}
+
+func TestWriteDiff(t *testing.T) {
+	diff := &Diff{
+		From: "a.yaml (all-1g.5gb)",
+		To:   "b.yaml (custom)",
+		GPUs: []GPUDiff{
+			{
+				Index:    0,
+				DeviceID: "0x20B010DE",
+				From:     &GPUConfig{MigEnabled: true, MigDevices: types.MigConfig{"1g.5gb": 7}},
+				To:       &GPUConfig{MigEnabled: true, MigDevices: types.MigConfig{"3g.20gb": 1, "1g.5gb": 2}},
+			},
+			{
+				Index:    1,
+				DeviceID: "0x20B010DE",
+				From:     &GPUConfig{MigEnabled: true, MigDevices: types.MigConfig{}},
+				To:       &GPUConfig{MigEnabled: false},
+			},
+			{
+				Index:    2,
+				DeviceID: "0x20B210DE",
+				To:       &GPUConfig{MigEnabled: false},
+			},
+		},
+	}
+
+	var output bytes.Buffer
+	require.Nil(t, WriteDiff(&output, diff, TextFormat))
+	require.Equal(t, `--- a.yaml (all-1g.5gb)
++++ b.yaml (custom)
+GPU 0 (0x20B010DE)
+- mig-enabled: true, mig-devices: {1g.5gb: 7}
++ mig-enabled: true, mig-devices: {1g.5gb: 2, 3g.20gb: 1}
+GPU 1 (0x20B010DE)
+- mig-enabled: true, mig-devices: none
++ mig-enabled: false
+GPU 2 (0x20B210DE)
+- not configured
++ mig-enabled: false
+`, output.String())
+
+	output.Reset()
+	require.Nil(t, WriteDiff(&output, &Diff{From: "a.yaml (x)", To: LiveSide, GPUs: []GPUDiff{}}, TextFormat))
+	require.Equal(t, "--- a.yaml (x)\n+++ live\nNo differences\n", output.String())
+
+	output.Reset()
+	require.Nil(t, WriteDiff(&output, diff, JSONFormat))
+	var parsed Diff
+	require.Nil(t, json.Unmarshal(output.Bytes(), &parsed))
+	require.Equal(t, diff.From, parsed.From)
+	require.Equal(t, diff.To, parsed.To)
+	require.Len(t, parsed.GPUs, len(diff.GPUs))
+	for i, gpu := range parsed.GPUs {
+		require.Equal(t, diff.GPUs[i].Index, gpu.Index)
+		require.Equal(t, diff.GPUs[i].DeviceID, gpu.DeviceID)
+		require.True(t, equalGPUConfigs(diff.GPUs[i].From, gpu.From))
+		require.True(t, equalGPUConfigs(diff.GPUs[i].To, gpu.To))
+	}
+}
+
+func TestCheckFlags(t *testing.T) {
+	testCases := []struct {
+		Description string
+		Files       []string
+		Configs     []string
+		Live        bool
+		Inventory   string
+		Valid       bool
+	}{
+		{"Two configs of one file", []string{"a.yaml"}, []string{"x", "y"}, false, "", true},
+		{"One config of two files", []string{"a.yaml", "b.yaml"}, []string{"x"}, false, "", true},
+		{"Two configs of two files", []string{"a.yaml", "b.yaml"}, []string{"x", "y"}, false, "", true},
+		{"Live", []string{"a.yaml"}, []string{"x"}, true, "", true},
+		{"Inventory", []string{"a.yaml"}, []string{"x", "y"}, false, "0x20B010DE", true},
+		{"No config file", nil, []string{"x", "y"}, false, "", false},
+		{"Single side", []string{"a.yaml"}, []string{"x"}, false, "", false},
+		{"Three sides", []string{"a.yaml"}, []string{"x", "y", "z"}, false, "", false},
+		{"Live with two configs", []string{"a.yaml"}, []string{"x", "y"}, true, "", false},
+		{"Live with inventory", []string{"a.yaml"}, []string{"x"}, true, "0x20B010DE", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			f := &Flags{
+				ConfigFiles:     *cli.NewStringSlice(tc.Files...),
+				SelectedConfigs: *cli.NewStringSlice(tc.Configs...),
+				Live:            tc.Live,
+				Inventory:       tc.Inventory,
+				OutputFormat:    TextFormat,
+			}
+			err := CheckFlags(f)
+			if tc.Valid {
+				require.Nil(t, err)
+			} else {
+				require.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestGetSides(t *testing.T) {
+	f := &Flags{
+		ConfigFiles:     *cli.NewStringSlice("a.yaml"),
+		SelectedConfigs: *cli.NewStringSlice("x", "y"),
+	}
+	from, to := getSides(f)
+	require.Equal(t, side{"a.yaml", "x"}, from)
+	require.Equal(t, side{"a.yaml", "y"}, to)
+
+	f = &Flags{
+		ConfigFiles:     *cli.NewStringSlice("a.yaml", "b.yaml"),
+		SelectedConfigs: *cli.NewStringSlice("x"),
+	}
+	from, to = getSides(f)
+	require.Equal(t, side{"a.yaml", "x"}, from)
+	require.Equal(t, side{"b.yaml", "x"}, to)
+
+	f = &Flags{
+		ConfigFiles: *cli.NewStringSlice("a.yaml"),
+		Live:        true,
+	}
+	from, to = getSides(f)
+	require.Equal(t, side{"a.yaml", ""}, from)
+	require.Equal(t, LiveSide, to.String())
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package export
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	placements "github.com/NVIDIA/mig-parted/api/placements/v1"
+)
+
+const (
+	CDIVersion     = "0.5.0"
+	DefaultCDIKind = "nvidia.com/gpu"
+
+	CDIDeviceNamesIndex = "index"
+	CDIDeviceNamesUUID  = "uuid"
+)
+
+var (
+	// nvidiaProcDriverPath holds one directory per GPU, named by its PCI
+	// address, with an 'information' file reporting its device minor.
+	nvidiaProcDriverPath = "/proc/driver/nvidia"
+	// migMinorsPath maps the capabilities of GPU and compute instances to
+	// the minors of their /dev/nvidia-caps/nvidia-cap* device nodes.
+	migMinorsPath = "/proc/driver/nvidia-caps/mig-minors"
+)
+
+// CDISpec is a Container Device Interface spec. Only the fields required to
+// expose device nodes to a container are supported.
+type CDISpec struct {
+	Version        string            `json:"cdiVersion"               yaml:"cdiVersion"`
+	Kind           string            `json:"kind"                     yaml:"kind"`
+	Devices        []CDIDevice       `json:"devices"                  yaml:"devices"`
+	ContainerEdits CDIContainerEdits `json:"containerEdits,omitempty" yaml:"containerEdits,omitempty"`
+}
+
+// CDIDevice is a device entry of a CDI spec.
+type CDIDevice struct {
+	Name           string            `json:"name"           yaml:"name"`
+	ContainerEdits CDIContainerEdits `json:"containerEdits" yaml:"containerEdits"`
+}
+
+// CDIContainerEdits are the edits made to a container using a CDI device.
+type CDIContainerEdits struct {
+	DeviceNodes []CDIDeviceNode `json:"deviceNodes,omitempty" yaml:"deviceNodes,omitempty"`
+}
+
+// CDIDeviceNode is a device node injected into a container.
+type CDIDeviceNode struct {
+	Path string `json:"path" yaml:"path"`
+}
+
+func exportCDISpec(ctx context.Context, f *Flags) error {
+	spec, err := exportMigPlacements(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	gpuMinors := make(map[int]int)
+	for _, gpu := range spec.GPUs {
+		if !gpu.MigEnabled {
+			continue
+		}
+		minor, err := readGPUMinor(filepath.Join(nvidiaProcDriverPath, "gpus", gpu.PCIAddress, "information"))
+		if err != nil {
+			return fmt.Errorf("error getting device minor of GPU %v: %w", gpu.Index, err)
+		}
+		gpuMinors[gpu.Index] = minor
+	}
+
+	migMinors, err := readMigMinors(migMinorsPath)
+	if err != nil {
+		return fmt.Errorf("error getting MIG capability minors: %w", err)
+	}
+
+	cdiSpec, err := NewCDISpec(spec, gpuMinors, migMinors, f)
+	if err != nil {
+		return err
+	}
+
+	err = WriteOutput(os.Stdout, cdiSpec, f)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NewCDISpec builds a CDI spec with one device per MIG device in spec. GPU
+// minors are keyed by GPU index, and MIG minors by capability as listed in
+// the mig-minors file of the NVIDIA driver (e.g. 'gpu0/gi1/access').
+func NewCDISpec(spec *placements.Spec, gpuMinors map[int]int, migMinors map[string]int, f *Flags) (*CDISpec, error) {
+	cdiSpec := &CDISpec{
+		Version: CDIVersion,
+		Kind:    f.CDIKind,
+		Devices: []CDIDevice{},
+		ContainerEdits: CDIContainerEdits{
+			DeviceNodes: []CDIDeviceNode{
+				{Path: "/dev/nvidiactl"},
+				{Path: "/dev/nvidia-uvm"},
+				{Path: "/dev/nvidia-uvm-tools"},
+			},
+		},
+	}
+
+	for _, gpu := range spec.GPUs {
+		if !gpu.MigEnabled {
+			continue
+		}
+
+		gpuMinor, exists := gpuMinors[gpu.Index]
+		if !exists {
+			return nil, fmt.Errorf("missing device minor of GPU %v", gpu.Index)
+		}
+
+		for i, device := range gpu.MigDevices {
+			giCap := fmt.Sprintf("gpu%d/gi%d/access", gpuMinor, device.GpuInstanceID)
+			ciCap := fmt.Sprintf("gpu%d/gi%d/ci%d/access", gpuMinor, device.GpuInstanceID, device.ComputeInstanceID)
+
+			var nodes []CDIDeviceNode
+			nodes = append(nodes, CDIDeviceNode{Path: fmt.Sprintf("/dev/nvidia%d", gpuMinor)})
+			for _, c := range []string{giCap, ciCap} {
+				minor, exists := migMinors[c]
+				if !exists {
+					return nil, fmt.Errorf("missing minor of MIG capability '%v' for MIG device %v", c, device.UUID)
+				}
+				nodes = append(nodes, CDIDeviceNode{Path: fmt.Sprintf("/dev/nvidia-caps/nvidia-cap%d", minor)})
+			}
+
+			name := fmt.Sprintf("%d:%d", gpu.Index, i)
+			if f.CDIDeviceNames == CDIDeviceNamesUUID {
+				name = device.UUID
+			}
+
+			cdiSpec.Devices = append(cdiSpec.Devices, CDIDevice{
+				Name: name,
+				ContainerEdits: CDIContainerEdits{
+					DeviceNodes: nodes,
+				},
+			})
+		}
+	}
+
+	return cdiSpec, nil
+}
+
+func readGPUMinor(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return -1, err
+	}
+	defer file.Close()
+	return parseGPUMinor(file)
+}
+
+// parseGPUMinor parses the 'Device Minor' field of the information file of
+// a GPU in /proc/driver/nvidia/gpus.
+func parseGPUMinor(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != "Device Minor" {
+			continue
+		}
+		minor, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return -1, fmt.Errorf("invalid device minor '%v': %w", parts[1], err)
+		}
+		return minor, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return -1, err
+	}
+	return -1, fmt.Errorf("no device minor found")
+}
+
+func readMigMinors(path string) (map[string]int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseMigMinors(file)
+}
+
+// parseMigMinors parses the mig-minors file of the NVIDIA driver, where
+// each line holds a capability and its minor (e.g. 'gpu0/gi1/access 21').
+func parseMigMinors(r io.Reader) (map[string]int, error) {
+	minors := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed line '%v'", scanner.Text())
+		}
+		minor, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid minor for '%v': %w", fields[0], err)
+		}
+		minors[fields[0]] = minor
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return minors, nil
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package export
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	placements "github.com/NVIDIA/mig-parted/api/placements/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMigMinors(t *testing.T) {
+	input := `config 1
+monitor 2
+gpu0/gi1/access 12
+gpu0/gi1/ci0/access 13
+
+gpu1/gi2/access 30
+gpu1/gi2/ci0/access 31
+`
+	minors, err := parseMigMinors(strings.NewReader(input))
+	require.Nil(t, err)
+	require.Equal(t, map[string]int{
+		"config":              1,
+		"monitor":             2,
+		"gpu0/gi1/access":     12,
+		"gpu0/gi1/ci0/access": 13,
+		"gpu1/gi2/access":     30,
+		"gpu1/gi2/ci0/access": 31,
+	}, minors)
+
+	_, err = parseMigMinors(strings.NewReader("gpu0/gi1/access\n"))
+	require.NotNil(t, err)
+
+	_, err = parseMigMinors(strings.NewReader("gpu0/gi1/access twelve\n"))
+	require.NotNil(t, err)
+}
+
+func TestParseGPUMinor(t *testing.T) {
+	input := `Model: 		 A100-SXM4-40GB
+IRQ:   		 128
+GPU UUID: 	 GPU-9e7b5f15-fb7c-4a3e-9e4d-1f2c2a5c0a31
+Video BIOS: 	 92.00.19.00.01
+Bus Type: 	 PCIe
+DMA Size: 	 47 bits
+DMA Mask: 	 0x7fffffffffff
+Bus Location: 	 0000:3b:00.0
+Device Minor: 	 3
+GPU Excluded:	 No
+`
+	minor, err := parseGPUMinor(strings.NewReader(input))
+	require.Nil(t, err)
+	require.Equal(t, 3, minor)
+
+	_, err = parseGPUMinor(strings.NewReader("Model: A100-SXM4-40GB\n"))
+	require.NotNil(t, err)
+}
+
+// cdiDeviceNameRegexp matches the names CDI allows for devices: letters,
+// digits and '-', '_', '.' and ':', starting and ending with a letter or
+// digit.
+var cdiDeviceNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.:-]*[a-zA-Z0-9])?$`)
+
+func TestNewCDISpec(t *testing.T) {
+	spec := &placements.Spec{
+		Version: placements.Version,
+		GPUs: []placements.GPUSpec{
+			{
+				Index:      0,
+				UUID:       "GPU-0",
+				MigEnabled: true,
+				MigDevices: []placements.MigDeviceSpec{
+					{UUID: "MIG-0-1-0", GpuInstanceID: 1, ComputeInstanceID: 0},
+					{UUID: "MIG-0-2-0", GpuInstanceID: 2, ComputeInstanceID: 0},
+				},
+			},
+			{
+				Index:      1,
+				UUID:       "GPU-1",
+				MigEnabled: false,
+				MigDevices: []placements.MigDeviceSpec{},
+			},
+			{
+				Index:      2,
+				UUID:       "GPU-2",
+				MigEnabled: true,
+				MigDevices: []placements.MigDeviceSpec{
+					{UUID: "MIG-2-0-0", GpuInstanceID: 0, ComputeInstanceID: 0},
+				},
+			},
+		},
+	}
+	gpuMinors := map[int]int{0: 0, 2: 3}
+	migMinors := map[string]int{
+		"gpu0/gi1/access":     12,
+		"gpu0/gi1/ci0/access": 13,
+		"gpu0/gi2/access":     21,
+		"gpu0/gi2/ci0/access": 22,
+		"gpu3/gi0/access":     30,
+		"gpu3/gi0/ci0/access": 31,
+	}
+
+	nodes := func(paths ...string) CDIContainerEdits {
+		var edits CDIContainerEdits
+		for _, p := range paths {
+			edits.DeviceNodes = append(edits.DeviceNodes, CDIDeviceNode{Path: p})
+		}
+		return edits
+	}
+
+	testCases := []struct {
+		Description string
+		DeviceNames string
+		Names       []string
+	}{
+		{
+			"Named by index",
+			CDIDeviceNamesIndex,
+			[]string{"0:0", "0:1", "2:0"},
+		},
+		{
+			"Named by UUID",
+			CDIDeviceNamesUUID,
+			[]string{"MIG-0-1-0", "MIG-0-2-0", "MIG-2-0-0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			f := &Flags{
+				OutputFormat:   CDIFormat,
+				CDIKind:        DefaultCDIKind,
+				CDIDeviceNames: tc.DeviceNames,
+			}
+			cdiSpec, err := NewCDISpec(spec, gpuMinors, migMinors, f)
+			require.Nil(t, err)
+			for _, device := range cdiSpec.Devices {
+				require.Regexp(t, cdiDeviceNameRegexp, device.Name, "Invalid CDI device name")
+			}
+			require.Equal(t, &CDISpec{
+				Version: CDIVersion,
+				Kind:    DefaultCDIKind,
+				Devices: []CDIDevice{
+					{
+						Name:           tc.Names[0],
+						ContainerEdits: nodes("/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap12", "/dev/nvidia-caps/nvidia-cap13"),
+					},
+					{
+						Name:           tc.Names[1],
+						ContainerEdits: nodes("/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap21", "/dev/nvidia-caps/nvidia-cap22"),
+					},
+					{
+						Name:           tc.Names[2],
+						ContainerEdits: nodes("/dev/nvidia3", "/dev/nvidia-caps/nvidia-cap30", "/dev/nvidia-caps/nvidia-cap31"),
+					},
+				},
+				ContainerEdits: nodes("/dev/nvidiactl", "/dev/nvidia-uvm", "/dev/nvidia-uvm-tools"),
+			}, cdiSpec)
+		})
+	}
+
+	t.Run("Missing MIG minor", func(t *testing.T) {
+		f := &Flags{CDIKind: DefaultCDIKind, CDIDeviceNames: CDIDeviceNamesIndex}
+		_, err := NewCDISpec(spec, gpuMinors, map[string]int{}, f)
+		require.NotNil(t, err)
+	})
+
+	t.Run("Missing GPU minor", func(t *testing.T) {
+		f := &Flags{CDIKind: DefaultCDIKind, CDIDeviceNames: CDIDeviceNamesIndex}
+		_, err := NewCDISpec(spec, map[int]int{0: 0}, migMinors, f)
+		require.NotNil(t, err)
+	})
+}
@@ -17,77 +17,155 @@
 package export
 
 import (
+	"context"
 	"fmt"
 	"sort"
 
 	"github.com/NVIDIA/mig-parted/api/spec/v1"
 	"github.com/NVIDIA/mig-parted/cmd/util"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
 	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
 	"github.com/NVIDIA/mig-parted/pkg/types"
-
-	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
 )
 
+// ExportMigConfigs exports the MIG config of the GPUs selected by
+// '--gpus' as a spec with a single config. With '--best-effort', GPUs whose
+// MIG config cannot be read are left out of the spec and logged instead of
+// failing the export.
 func ExportMigConfigs(c *Context) (*v1.Spec, error) {
+	spec, _, err := exportMigConfigs(c)
+	return spec, err
+}
+
+func exportMigConfigs(c *Context) (*v1.Spec, []omittedGPU, error) {
+	exported, err := exportGPUMigConfigSpecs(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	spec := v1.Spec{
+		Version: v1.Version,
+		MigConfigs: map[string]v1.MigConfigSpecSlice{
+			c.Flags.ConfigLabel: mergeMigConfigSpecs(exported.specs, exported.complete),
+		},
+	}
+
+	return &spec, exported.omitted, nil
+}
+
+// gpuMigConfigSpecs holds one spec per exported GPU, in order of GPU index,
+// with a single device and a single device filter each.
+type gpuMigConfigSpecs struct {
+	specs v1.MigConfigSpecSlice
+	// omitted holds the GPUs left out of specs in best-effort mode.
+	omitted []omittedGPU
+	// complete is set if every GPU of the node is in specs.
+	complete bool
+}
+
+// omittedGPU is a GPU whose MIG config could not be exported.
+type omittedGPU struct {
+	index int
+	err   error
+}
+
+func exportGPUMigConfigSpecs(c *Context) (*gpuMigConfigSpecs, error) {
 	nvidiaModuleLoaded, err := util.IsNvidiaModuleLoaded()
 	if err != nil {
-		return nil, fmt.Errorf("error checking if nvidia module loaded: %v", err)
+		return nil, fmt.Errorf("error checking if nvidia module loaded: %w", err)
 	}
 
-	nvpci := nvpci.New()
-	gpus, err := nvpci.GetGPUs()
+	all, selected, err := util.NewGPUEnumerators(c.String("sysfs-root"), c.Flags.GPUs)
 	if err != nil {
-		return nil, fmt.Errorf("error enumerating GPUs: %v", err)
+		return nil, err
 	}
 
-	manager := util.NewCombinedMigManager()
+	manager := util.NewCombinedMigManager(all, util.PciMigModeOptions(c.Context)...)
 
-	configSpecs := make(v1.MigConfigSpecSlice, len(gpus))
-	for i, gpu := range gpus {
-		deviceID := types.NewDeviceID(gpu.Device, gpu.Vendor)
-		deviceFilter := deviceID.String()
+	return getGPUMigConfigSpecs(c.Context.Context, all, selected, manager, nvidiaModuleLoaded, c.Flags.BestEffort)
+}
 
-		enabled := false
-		capable, err := manager.IsMigCapable(i)
-		if err != nil {
-			return nil, fmt.Errorf("error checking MIG capable: %v", err)
+// getGPUMigConfigSpecs returns the spec of each GPU enumerated by selected.
+// A GPU whose spec cannot be read fails the export, unless bestEffort is
+// set, in which case it is omitted, as long as some GPU is exported.
+func getGPUMigConfigSpecs(ctx context.Context, all, selected enumerator.Interface, manager util.CombinedMigManager, nvidiaModuleLoaded, bestEffort bool) (*gpuMigConfigSpecs, error) {
+	allGPUs, err := all.GetGPUs()
+	if err != nil {
+		return nil, fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+
+	gpus, err := selected.GetGPUs()
+	if err != nil {
+		return nil, fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+
+	exported := &gpuMigConfigSpecs{
+		specs: v1.MigConfigSpecSlice{},
+	}
+	for _, gpu := range gpus {
+		if ctx.Err() != nil {
+			return nil, types.NewContextError(gpu.Index, ctx.Err())
 		}
-		if capable {
-			m, err := manager.GetMigMode(i)
-			if err != nil {
-				return nil, fmt.Errorf("error checking MIG capable: %v", err)
-			}
-			enabled = (m == mode.Enabled)
+
+		spec, err := getGPUMigConfigSpec(ctx, gpu, manager, nvidiaModuleLoaded)
+		if err != nil && bestEffort && ctx.Err() == nil {
+			log.Warnf("Omitting GPU %v from export: %v", gpu.Index, err)
+			exported.omitted = append(exported.omitted, omittedGPU{gpu.Index, err})
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
 
-		migDevices := types.MigConfig{}
-		if enabled {
-			if !nvidiaModuleLoaded {
-				return nil, fmt.Errorf("nvidia module must be loaded in order to query MIG device state")
-			}
+		exported.specs = append(exported.specs, *spec)
+	}
+	if len(exported.specs) == 0 && len(exported.omitted) != 0 {
+		return nil, fmt.Errorf("unable to export any GPU: %w", exported.omitted[0].err)
+	}
+	exported.complete = len(exported.specs) == len(allGPUs)
 
-			migDevices, err = manager.GetMigConfig(i)
-			if err != nil {
-				return nil, fmt.Errorf("error getting MIGConfig: %v", err)
-			}
+	return exported, nil
+}
+
+func getGPUMigConfigSpec(ctx context.Context, gpu enumerator.GPU, manager util.CombinedMigManager, nvidiaModuleLoaded bool) (*v1.MigConfigSpec, error) {
+	i := gpu.Index
+
+	deviceID := types.NewDeviceID(gpu.Device, gpu.Vendor)
+	deviceFilter := deviceID.String()
+
+	enabled := false
+	capable, err := manager.IsMigCapable(ctx, i)
+	if err != nil {
+		return nil, fmt.Errorf("error checking MIG capable: %w", err)
+	}
+	if capable {
+		m, err := manager.GetMigMode(ctx, i)
+		if err != nil {
+			return nil, fmt.Errorf("error getting MIG mode: %w", err)
+		}
+		enabled = (m == mode.Enabled)
+	}
+
+	migDevices := types.MigConfig{}
+	if enabled {
+		if !nvidiaModuleLoaded {
+			return nil, types.NewError(types.ErrorCategoryDriverNotLoaded, i, "nvidia module must be loaded in order to query MIG device state")
 		}
 
-		configSpecs[i] = v1.MigConfigSpec{
-			DeviceFilter: []string{deviceFilter},
-			Devices:      []int{i},
-			MigEnabled:   enabled,
-			MigDevices:   migDevices,
+		migDevices, err = manager.GetMigConfig(ctx, i)
+		if err != nil {
+			return nil, fmt.Errorf("error getting MIGConfig: %w", err)
 		}
 	}
 
-	spec := v1.Spec{
-		Version: v1.Version,
-		MigConfigs: map[string]v1.MigConfigSpecSlice{
-			c.Flags.ConfigLabel: mergeMigConfigSpecs(configSpecs),
-		},
+	spec := &v1.MigConfigSpec{
+		DeviceFilter: []string{deviceFilter},
+		Devices:      []int{i},
+		MigEnabled:   enabled,
+		MigDevices:   migDevices,
 	}
 
-	return &spec, nil
+	return spec, nil
 }
 
 // mergeMigConfigSpecs merges the specs from a MigConfigSpecsSlice into a more
@@ -97,12 +175,14 @@ func ExportMigConfigs(c *Context) (*v1.Spec, error) {
 // that the 'interface{}' types for '.DeviceFilter' and '.Devices' are both
 // slices and not strings.
 //
-// We also know that every device on the node is represented and that each spec
-// has a single device set in '.Devices' and a single filter set in
-// '.DeviceFilter'.
+// We also know that each spec has a single device set in '.Devices' and a
+// single filter set in '.DeviceFilter'. If 'complete' is set, every device on
+// the node is represented, so that lists of devices covering every device of
+// their device filters can be replaced by 'all'. Otherwise, 'all' would also
+// select devices missing from the export, so that lists of devices are kept.
 //
 // This allows us to simplify the logic below significantly.
-func mergeMigConfigSpecs(specs v1.MigConfigSpecSlice) v1.MigConfigSpecSlice {
+func mergeMigConfigSpecs(specs v1.MigConfigSpecSlice, complete bool) v1.MigConfigSpecSlice {
 	// Merge the incoming specs by comparing their MigEnabled and MigDevices fields.
 	// For any two specs, if both of these are equal, then we merge them
 	// together and concatenate their device filter and devices lists.
@@ -150,7 +230,7 @@ OUTER:
 		for _, df := range m.DeviceFilter.([]string) {
 			specDevices = mergeAndSortIntSlices(specDevices, dfDevices[df])
 		}
-		if !equalSortedIntSlices(m.Devices.([]int), specDevices) {
+		if !complete || !equalSortedIntSlices(m.Devices.([]int), specDevices) {
 			continue
 		}
 		merged[i].Devices = "all"
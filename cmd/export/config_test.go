@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/cmd/util"
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	migassert "github.com/NVIDIA/mig-parted/pkg/mig/assert"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	a100SXM440GB = 0x20B0
+	a100SXM480GB = 0x20B2
+	t4           = 0x1EB8
+)
+
+// testMigManager manages the MIG state of the GPUs of a mock NVML server,
+// with the GPUs in incapable not being MIG capable, and those in failing
+// failing to report whether they are.
+type testMigManager struct {
+	util.CombinedMigManager
+	incapable map[int]bool
+	failing   map[int]bool
+}
+
+func newTestMigManager(server nvml.Interface) *testMigManager {
+	type modeManager = mode.Manager
+	type configManager = config.Manager
+	return &testMigManager{
+		CombinedMigManager: &struct {
+			modeManager
+			configManager
+		}{mode.NewNvmlMigModeManagerWith(server), config.NewNvmlMigConfigManagerWith(server)},
+		incapable: make(map[int]bool),
+		failing:   make(map[int]bool),
+	}
+}
+
+func (m *testMigManager) IsMigCapable(ctx context.Context, gpu int) (bool, error) {
+	if m.failing[gpu] {
+		return false, fmt.Errorf("GPU %v unreachable", gpu)
+	}
+	if m.incapable[gpu] {
+		return false, nil
+	}
+	return m.CombinedMigManager.IsMigCapable(ctx, gpu)
+}
+
+// testGPU is the state of a GPU set up before exporting.
+type testGPU struct {
+	device     uint16
+	migEnabled bool
+	migDevices types.MigConfig
+	failing    bool
+}
+
+// setupTestGPUs returns an enumerator and a manager for GPUs in the given
+// state, on a mock NVML server with as many GPUs.
+func setupTestGPUs(t *testing.T, gpus []testGPU) (enumerator.Interface, *testMigManager) {
+	server := nvml.NewMockNVMLOnLunaServer().(*nvml.MockLunaServer)
+	require.LessOrEqual(t, len(gpus), len(server.Devices))
+
+	manager := newTestMigManager(server)
+	ctx := context.Background()
+
+	var devices []*nvpci.NvidiaPCIDevice
+	for i, gpu := range gpus {
+		devices = append(devices, &nvpci.NvidiaPCIDevice{
+			Vendor: 0x10DE,
+			Device: gpu.device,
+			Class:  0x030200,
+		})
+		if gpu.device == t4 {
+			manager.incapable[i] = true
+		}
+		if gpu.migEnabled {
+			require.Nil(t, manager.SetMigMode(ctx, i, mode.Enabled))
+			require.Nil(t, manager.SetMigConfig(ctx, i, gpu.migDevices))
+		}
+		if gpu.failing {
+			manager.failing[i] = true
+		}
+	}
+
+	return enumerator.NewFake(devices...), manager
+}
+
+// requireRoundTrip exports the MIG config of the GPUs selected from all, in
+// each output format, and requires the output to select exactly the exported
+// GPUs, and asserting it on them to succeed.
+func requireRoundTrip(t *testing.T, all enumerator.Interface, indices []int, manager util.CombinedMigManager, bestEffort bool) *gpuMigConfigSpecs {
+	ctx := context.Background()
+
+	selected := enumerator.NewFiltered(all, indices)
+	exported, err := getGPUMigConfigSpecs(ctx, all, selected, manager, true, bestEffort)
+	require.Nil(t, err)
+
+	exportedIndices := []int{}
+	for _, s := range exported.specs {
+		exportedIndices = append(exportedIndices, gpuIndex(s))
+	}
+
+	for _, format := range []string{YAMLFormat, JSONFormat} {
+		f := &Flags{OutputFormat: format}
+
+		spec := v1.Spec{
+			Version: v1.Version,
+			MigConfigs: map[string]v1.MigConfigSpecSlice{
+				DefaultConfigLabel: mergeMigConfigSpecs(exported.specs, exported.complete),
+			},
+		}
+
+		var output bytes.Buffer
+		require.Nil(t, writeOmittedGPUs(&output, exported.omitted, f))
+		require.Nil(t, WriteOutput(&output, &spec, f))
+
+		var parsed v1.Spec
+		err := yaml.Unmarshal(output.Bytes(), &parsed)
+		require.Nil(t, err, "Unexpected error parsing:\n%s", output.String())
+
+		// The output must select exactly the exported GPUs of the node, as
+		// applying it would otherwise change GPUs that were not exported.
+		walked := []int{}
+		err = migassert.WalkSelectedMigConfigForEachGPU(ctx, all, parsed.MigConfigs[DefaultConfigLabel], func(mc *v1.MigConfigSpec, i int, d types.DeviceID) error {
+			walked = append(walked, i)
+			return nil
+		})
+		require.Nil(t, err)
+		require.ElementsMatch(t, exportedIndices, walked, "Unexpected GPUs selected by:\n%s", output.String())
+
+		asserter := migassert.New(
+			migassert.WithModeManager(manager),
+			migassert.WithConfigManager(manager),
+			migassert.WithGPUEnumerator(enumerator.NewFiltered(all, exportedIndices)),
+		)
+
+		_, err = asserter.AssertMigMode(ctx, parsed.MigConfigs[DefaultConfigLabel])
+		require.Nil(t, err, "Unexpected error asserting MIG mode of:\n%s", output.String())
+
+		_, err = asserter.AssertMigConfig(ctx, parsed.MigConfigs[DefaultConfigLabel])
+		require.Nil(t, err, "Unexpected error asserting MIG config of:\n%s", output.String())
+	}
+
+	return exported
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	config7x1g := types.MigConfig{"1g.5gb": 7}
+	config2x3g := types.MigConfig{"3g.20gb": 2}
+	configMixed := types.MigConfig{"1g.5gb": 2, "2g.10gb": 1, "3g.20gb": 1}
+
+	testCases := []struct {
+		Description string
+		GPUs        []testGPU
+		Indices     []int
+		BestEffort  bool
+		Omitted     []int
+	}{
+		{
+			"Single device filter, same config",
+			[]testGPU{
+				{device: a100SXM440GB, migEnabled: true, migDevices: config7x1g},
+				{device: a100SXM440GB, migEnabled: true, migDevices: config7x1g},
+			},
+			nil, false, nil,
+		},
+		{
+			"Single device filter, MIG enabled without MIG devices",
+			[]testGPU{
+				{device: a100SXM440GB, migEnabled: true, migDevices: types.MigConfig{}},
+				{device: a100SXM440GB},
+			},
+			nil, false, nil,
+		},
+		{
+			"Mixed device filters, same config",
+			[]testGPU{
+				{device: a100SXM440GB, migEnabled: true, migDevices: config2x3g},
+				{device: a100SXM480GB, migEnabled: true, migDevices: config2x3g},
+			},
+			nil, false, nil,
+		},
+		{
+			"Mixed device filters, config shared across filters",
+			[]testGPU{
+				{device: a100SXM440GB, migEnabled: true, migDevices: config7x1g},
+				{device: a100SXM480GB, migEnabled: true, migDevices: config7x1g},
+				{device: a100SXM440GB, migEnabled: true, migDevices: configMixed},
+				{device: a100SXM480GB},
+				{device: t4},
+			},
+			nil, false, nil,
+		},
+		{
+			"Mixed device filters, one config per filter",
+			[]testGPU{
+				{device: a100SXM440GB, migEnabled: true, migDevices: config7x1g},
+				{device: a100SXM480GB, migEnabled: true, migDevices: config2x3g},
+				{device: t4},
+			},
+			nil, false, nil,
+		},
+		{
+			"Selected GPUs covering a device filter",
+			[]testGPU{
+				{device: a100SXM440GB, migEnabled: true, migDevices: config7x1g},
+				{device: a100SXM440GB, migEnabled: true, migDevices: config7x1g},
+				{device: a100SXM480GB, migEnabled: true, migDevices: config7x1g},
+			},
+			[]int{0, 1}, false, nil,
+		},
+		{
+			"Best effort with a failing GPU",
+			[]testGPU{
+				{device: a100SXM440GB, migEnabled: true, migDevices: config7x1g},
+				{device: a100SXM440GB, migEnabled: true, migDevices: config7x1g, failing: true},
+				{device: a100SXM480GB},
+			},
+			nil, true, []int{1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			all, manager := setupTestGPUs(t, tc.GPUs)
+			exported := requireRoundTrip(t, all, tc.Indices, manager, tc.BestEffort)
+
+			omitted := []int{}
+			for _, gpu := range exported.omitted {
+				omitted = append(omitted, gpu.index)
+			}
+			require.ElementsMatch(t, tc.Omitted, omitted)
+		})
+	}
+}
+
+func TestExportRoundTripRandom(t *testing.T) {
+	devices := []uint16{a100SXM440GB, a100SXM480GB, t4}
+	configs := []types.MigConfig{
+		{},
+		{"1g.5gb": 7},
+		{"2g.10gb": 3},
+		{"3g.20gb": 2},
+		{"7g.40gb": 1},
+		{"1g.5gb": 2, "2g.10gb": 1, "3g.20gb": 1},
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 200; n++ {
+		gpus := make([]testGPU, 1+r.Intn(8))
+		for i := range gpus {
+			gpus[i].device = devices[r.Intn(len(devices))]
+			if gpus[i].device != t4 && r.Intn(3) > 0 {
+				gpus[i].migEnabled = true
+				gpus[i].migDevices = configs[r.Intn(len(configs))]
+			}
+			gpus[i].failing = r.Intn(8) == 0
+		}
+
+		var indices []int
+		if r.Intn(2) == 0 {
+			for i := range gpus {
+				if r.Intn(2) == 0 {
+					indices = append(indices, i)
+				}
+			}
+		}
+
+		// Failing to export every selected GPU is an error, covered by
+		// TestExportFailingGPU.
+		if !anyExported(gpus, indices) {
+			continue
+		}
+
+		t.Run(fmt.Sprintf("%v", n), func(t *testing.T) {
+			all, manager := setupTestGPUs(t, gpus)
+			requireRoundTrip(t, all, indices, manager, true)
+		})
+	}
+}
+
+// anyExported returns whether any of the GPUs selected by indices (all if
+// nil) can be exported.
+func anyExported(gpus []testGPU, indices []int) bool {
+	selected := make(map[int]bool)
+	for _, i := range indices {
+		selected[i] = true
+	}
+	for i, gpu := range gpus {
+		if (indices == nil || selected[i]) && !gpu.failing {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExportFailingGPU(t *testing.T) {
+	all, manager := setupTestGPUs(t, []testGPU{
+		{device: a100SXM440GB},
+		{device: a100SXM440GB, failing: true},
+	})
+	ctx := context.Background()
+
+	_, err := getGPUMigConfigSpecs(ctx, all, all, manager, true, false)
+	require.NotNil(t, err)
+
+	_, err = getGPUMigConfigSpecs(ctx, all, enumerator.NewFiltered(all, []int{1}), manager, true, true)
+	require.NotNil(t, err, "Expected an error with no GPU exported")
+}
+
+func TestWriteOmittedGPUs(t *testing.T) {
+	omitted := []omittedGPU{
+		{1, fmt.Errorf("error getting MIGConfig:\nGPU 1 unreachable")},
+	}
+
+	var output bytes.Buffer
+	require.Nil(t, writeOmittedGPUs(&output, omitted, &Flags{OutputFormat: YAMLFormat}))
+	require.Equal(t, "# GPU 1 omitted: error getting MIGConfig: GPU 1 unreachable\n", output.String())
+
+	output.Reset()
+	require.Nil(t, writeOmittedGPUs(&output, omitted, &Flags{OutputFormat: JSONFormat}))
+	require.Empty(t, output.String())
+}
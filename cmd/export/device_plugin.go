@@ -0,0 +1,236 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+)
+
+const (
+	DevicePluginConfigVersion  = "v1"
+	DevicePluginResourcePrefix = "nvidia.com/"
+
+	MigStrategyMixed  = "mixed"
+	MigStrategySingle = "single"
+)
+
+// DevicePluginConfig is a config file for the Kubernetes device plugin for
+// NVIDIA GPUs, setting its MIG strategy and the names of its resources.
+type DevicePluginConfig struct {
+	Version   string                `json:"version"   yaml:"version"`
+	Flags     DevicePluginFlags     `json:"flags"     yaml:"flags"`
+	Resources DevicePluginResources `json:"resources" yaml:"resources"`
+}
+
+// DevicePluginFlags holds the flags of a device plugin config.
+type DevicePluginFlags struct {
+	MigStrategy string `json:"migStrategy" yaml:"migStrategy"`
+}
+
+// DevicePluginResources holds the names the device plugin advertises full
+// GPUs and MIG devices under, the latter only with the 'mixed' strategy.
+type DevicePluginResources struct {
+	GPUs []DevicePluginResource `json:"gpus,omitempty" yaml:"gpus,omitempty"`
+	MIGs []DevicePluginResource `json:"mig,omitempty"  yaml:"mig,omitempty"`
+}
+
+// DevicePluginResource names the resource of the devices matching pattern,
+// e.g. a MIG profile. The name is prefixed with 'nvidia.com/' by the plugin.
+type DevicePluginResource struct {
+	Pattern string `json:"pattern" yaml:"pattern"`
+	Name    string `json:"name"    yaml:"name"`
+}
+
+func exportDevicePluginConfig(c *Context) error {
+	exported, err := exportGPUMigConfigSpecs(c)
+	if err != nil {
+		return err
+	}
+
+	config, err := NewDevicePluginConfig(exported.specs, c.Flags.MigStrategy)
+	if err != nil {
+		return err
+	}
+
+	err = writeOmittedGPUs(os.Stdout, exported.omitted, c.Flags)
+	if err != nil {
+		return err
+	}
+
+	err = writeDevicePluginCapacity(os.Stdout, NewDevicePluginCapacity(exported.specs, c.Flags.MigStrategy))
+	if err != nil {
+		return err
+	}
+
+	err = WriteOutput(os.Stdout, config, c.Flags)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NewDevicePluginConfig builds a device plugin config for the given MIG
+// strategy from the spec of each GPU, as returned by exportGPUMigConfigSpecs.
+//
+// With the 'mixed' strategy, GPUs with MIG mode disabled are advertised as
+// 'nvidia.com/gpu' and MIG devices as 'nvidia.com/mig-<profile>', with one
+// resource per profile in use. With the 'single' strategy, all GPUs must
+// either have MIG mode disabled, or have MIG mode enabled and the same MIG
+// devices of a single profile, which are then advertised as 'nvidia.com/gpu'.
+func NewDevicePluginConfig(specs v1.MigConfigSpecSlice, strategy string) (*DevicePluginConfig, error) {
+	config := &DevicePluginConfig{
+		Version: DevicePluginConfigVersion,
+		Flags: DevicePluginFlags{
+			MigStrategy: strategy,
+		},
+		Resources: DevicePluginResources{
+			GPUs: []DevicePluginResource{
+				{Pattern: "*", Name: "gpu"},
+			},
+		},
+	}
+
+	switch strategy {
+	case MigStrategyMixed:
+		profiles := types.MigConfig{}
+		for _, s := range specs {
+			if !s.MigEnabled {
+				continue
+			}
+			for profile, count := range s.MigDevices {
+				profiles[profile] += count
+			}
+		}
+		for _, profile := range activeProfiles(profiles) {
+			config.Resources.MIGs = append(config.Resources.MIGs, DevicePluginResource{
+				Pattern: profile,
+				Name:    "mig-" + profile,
+			})
+		}
+	case MigStrategySingle:
+		err := assertSingleStrategy(specs)
+		if err != nil {
+			return nil, fmt.Errorf("'%v' MIG strategy not possible: %w", MigStrategySingle, err)
+		}
+	default:
+		return nil, fmt.Errorf("unrecognized MIG strategy: %v", strategy)
+	}
+
+	return config, nil
+}
+
+// NewDevicePluginCapacity returns the number of devices the device plugin
+// advertises per resource with the config returned by NewDevicePluginConfig
+// for the same specs and strategy.
+func NewDevicePluginCapacity(specs v1.MigConfigSpecSlice, strategy string) map[string]int {
+	capacity := make(map[string]int)
+	for _, s := range specs {
+		if !s.MigEnabled {
+			capacity[DevicePluginResourcePrefix+"gpu"]++
+			continue
+		}
+		for profile, count := range s.MigDevices {
+			if count <= 0 {
+				continue
+			}
+			if strategy == MigStrategySingle {
+				capacity[DevicePluginResourcePrefix+"gpu"] += count
+				continue
+			}
+			capacity[DevicePluginResourcePrefix+"mig-"+string(profile)] += count
+		}
+	}
+	return capacity
+}
+
+// writeDevicePluginCapacity writes the number of devices advertised per
+// resource as a comment, which the device plugin ignores.
+func writeDevicePluginCapacity(w io.Writer, capacity map[string]int) error {
+	var resources []string
+	for resource := range capacity {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	var b strings.Builder
+	b.WriteString("# Devices advertised per resource:\n")
+	for _, resource := range resources {
+		fmt.Fprintf(&b, "#   %v: %v\n", resource, capacity[resource])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	if err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+	return nil
+}
+
+// assertSingleStrategy asserts that either all GPUs have MIG mode disabled,
+// or all GPUs have MIG mode enabled and the same MIG devices of a single
+// profile.
+func assertSingleStrategy(specs v1.MigConfigSpecSlice) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	first := specs[0]
+	for _, s := range specs {
+		if s.MigEnabled != first.MigEnabled {
+			return fmt.Errorf("GPUs %v and %v differ in MIG mode", gpuIndex(first), gpuIndex(s))
+		}
+		if !s.MigEnabled {
+			continue
+		}
+
+		profiles := activeProfiles(s.MigDevices)
+		if len(profiles) != 1 {
+			return fmt.Errorf("GPU %v has MIG devices of %v profiles, expected 1: %v", gpuIndex(s), len(profiles), profiles)
+		}
+		if !s.MigDevices.Equals(first.MigDevices) {
+			return fmt.Errorf("GPUs %v and %v have different MIG devices", gpuIndex(first), gpuIndex(s))
+		}
+	}
+
+	return nil
+}
+
+// activeProfiles returns the sorted profiles with at least one MIG device in
+// config.
+func activeProfiles(config types.MigConfig) []string {
+	var profiles []string
+	for profile, count := range config {
+		if count > 0 {
+			profiles = append(profiles, string(profile))
+		}
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// gpuIndex returns the index of the single GPU of a spec returned by
+// exportGPUMigConfigSpecs.
+func gpuIndex(s v1.MigConfigSpec) int {
+	return s.Devices.([]int)[0]
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDevicePluginConfig(t *testing.T) {
+	gpu := func(i int, enabled bool, devices types.MigConfig) v1.MigConfigSpec {
+		return v1.MigConfigSpec{
+			DeviceFilter: []string{"0x20B010DE"},
+			Devices:      []int{i},
+			MigEnabled:   enabled,
+			MigDevices:   devices,
+		}
+	}
+
+	testCases := []struct {
+		Description string
+		Specs       v1.MigConfigSpecSlice
+		Strategy    string
+		MIGs        []DevicePluginResource
+		Capacity    map[string]int
+		Error       bool
+	}{
+		{
+			"Mixed - MIG disabled",
+			v1.MigConfigSpecSlice{
+				gpu(0, false, types.MigConfig{}),
+				gpu(1, false, types.MigConfig{}),
+			},
+			MigStrategyMixed,
+			nil,
+			map[string]int{"nvidia.com/gpu": 2},
+			false,
+		},
+		{
+			"Mixed - heterogeneous",
+			v1.MigConfigSpecSlice{
+				gpu(0, true, types.MigConfig{"1g.5gb": 2, "2g.10gb": 1, "3g.20gb": 1}),
+				gpu(1, true, types.MigConfig{"1g.5gb": 7}),
+				gpu(2, false, types.MigConfig{}),
+				gpu(3, true, types.MigConfig{}),
+			},
+			MigStrategyMixed,
+			[]DevicePluginResource{
+				{Pattern: "1g.5gb", Name: "mig-1g.5gb"},
+				{Pattern: "2g.10gb", Name: "mig-2g.10gb"},
+				{Pattern: "3g.20gb", Name: "mig-3g.20gb"},
+			},
+			map[string]int{
+				"nvidia.com/gpu":         1,
+				"nvidia.com/mig-1g.5gb":  9,
+				"nvidia.com/mig-2g.10gb": 1,
+				"nvidia.com/mig-3g.20gb": 1,
+			},
+			false,
+		},
+		{
+			"Single - MIG disabled",
+			v1.MigConfigSpecSlice{
+				gpu(0, false, types.MigConfig{}),
+				gpu(1, false, types.MigConfig{}),
+			},
+			MigStrategySingle,
+			nil,
+			map[string]int{"nvidia.com/gpu": 2},
+			false,
+		},
+		{
+			"Single - identical GPUs",
+			v1.MigConfigSpecSlice{
+				gpu(0, true, types.MigConfig{"1g.5gb": 7}),
+				gpu(1, true, types.MigConfig{"1g.5gb": 7}),
+			},
+			MigStrategySingle,
+			nil,
+			map[string]int{"nvidia.com/gpu": 14},
+			false,
+		},
+		{
+			"Single - mixed MIG mode",
+			v1.MigConfigSpecSlice{
+				gpu(0, true, types.MigConfig{"1g.5gb": 7}),
+				gpu(1, false, types.MigConfig{}),
+			},
+			MigStrategySingle,
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Single - multiple profiles",
+			v1.MigConfigSpecSlice{
+				gpu(0, true, types.MigConfig{"1g.5gb": 4, "3g.20gb": 1}),
+				gpu(1, true, types.MigConfig{"1g.5gb": 4, "3g.20gb": 1}),
+			},
+			MigStrategySingle,
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Single - different counts",
+			v1.MigConfigSpecSlice{
+				gpu(0, true, types.MigConfig{"1g.5gb": 7}),
+				gpu(1, true, types.MigConfig{"1g.5gb": 3}),
+			},
+			MigStrategySingle,
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Single - no MIG devices",
+			v1.MigConfigSpecSlice{
+				gpu(0, true, types.MigConfig{}),
+			},
+			MigStrategySingle,
+			nil,
+			nil,
+			true,
+		},
+		{
+			"Unknown strategy",
+			v1.MigConfigSpecSlice{
+				gpu(0, false, types.MigConfig{}),
+			},
+			"none",
+			nil,
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			config, err := NewDevicePluginConfig(tc.Specs, tc.Strategy)
+			if tc.Error {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, DevicePluginConfigVersion, config.Version)
+			require.Equal(t, tc.Strategy, config.Flags.MigStrategy)
+			require.Equal(t, []DevicePluginResource{{Pattern: "*", Name: "gpu"}}, config.Resources.GPUs)
+			require.Equal(t, tc.MIGs, config.Resources.MIGs)
+			require.Equal(t, tc.Capacity, NewDevicePluginCapacity(tc.Specs, tc.Strategy))
+		})
+	}
+}
+
+func TestWriteDevicePluginConfig(t *testing.T) {
+	specs := v1.MigConfigSpecSlice{
+		{
+			DeviceFilter: []string{"0x20B010DE"},
+			Devices:      []int{0},
+			MigEnabled:   true,
+			MigDevices:   types.MigConfig{"1g.5gb": 7},
+		},
+		{
+			DeviceFilter: []string{"0x20B010DE"},
+			Devices:      []int{1},
+			MigEnabled:   false,
+		},
+	}
+
+	config, err := NewDevicePluginConfig(specs, MigStrategyMixed)
+	require.Nil(t, err)
+
+	var output bytes.Buffer
+	require.Nil(t, writeDevicePluginCapacity(&output, NewDevicePluginCapacity(specs, MigStrategyMixed)))
+	require.Nil(t, WriteOutput(&output, config, &Flags{OutputFormat: DevicePluginFormat}))
+	require.Equal(t, `# Devices advertised per resource:
+#   nvidia.com/gpu: 1
+#   nvidia.com/mig-1g.5gb: 7
+version: v1
+flags:
+  migStrategy: mixed
+resources:
+  gpus:
+  - pattern: '*'
+    name: gpu
+  mig:
+  - pattern: 1g.5gb
+    name: mig-1g.5gb
+`, output.String())
+}
@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
 	"github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli/v2"
 
@@ -37,6 +39,8 @@ func GetLogger() *logrus.Logger {
 const (
 	JSONFormat         = "json"
 	YAMLFormat         = "yaml"
+	CDIFormat          = "cdi"
+	DevicePluginFormat = "device-plugin"
 	DefaultConfigLabel = "current"
 )
 
@@ -44,6 +48,16 @@ type Flags struct {
 	OutputFormat string
 	ConfigLabel  string
 	Placements   bool
+
+	DetailedPlacements bool
+
+	CDIKind        string
+	CDIDeviceNames string
+
+	MigStrategy string
+
+	GPUs       string
+	BestEffort bool
 }
 
 type Context struct {
@@ -58,7 +72,7 @@ func BuildCommand() *cli.Command {
 	// Create the 'export' command
 	export := cli.Command{}
 	export.Name = "export"
-	export.Usage = "Export the MIG configuration from all GPUs in a compatible format"
+	export.Usage = "Export the MIG configuration from the GPUs of the node in a compatible format"
 	export.Action = func(c *cli.Context) error {
 		return exportWrapper(c, &exportFlags)
 	}
@@ -67,8 +81,8 @@ func BuildCommand() *cli.Command {
 	export.Flags = []cli.Flag{
 		&cli.StringFlag{
 			Name:        "output-format",
-			Aliases:     []string{"o"},
-			Usage:       "Format for the output [json | yaml]",
+			Aliases:     []string{"o", "format"},
+			Usage:       "Format for the output [json | yaml | cdi | device-plugin]",
 			Destination: &exportFlags.OutputFormat,
 			Value:       YAMLFormat,
 			EnvVars:     []string{"MIG_PARTED_OUTPUT_FORMAT"},
@@ -89,6 +103,47 @@ func BuildCommand() *cli.Command {
 			Value:       false,
 			EnvVars:     []string{"MIG_PARTED_SHOW_PLACEMENTS"},
 		},
+		&cli.BoolFlag{
+			Name:        "detailed-placements",
+			Usage:       "Output the actual placements of MIG devices along with their profile, GPU and compute instance IDs and memory, as a versioned spec",
+			Destination: &exportFlags.DetailedPlacements,
+			Value:       false,
+			EnvVars:     []string{"MIG_PARTED_DETAILED_PLACEMENTS"},
+		},
+		&cli.StringFlag{
+			Name:        "cdi-kind",
+			Usage:       "Kind of the devices in the CDI spec output with '--output-format=cdi'",
+			Destination: &exportFlags.CDIKind,
+			Value:       DefaultCDIKind,
+			EnvVars:     []string{"MIG_PARTED_CDI_KIND"},
+		},
+		&cli.StringFlag{
+			Name:        "cdi-device-names",
+			Usage:       "Name the MIG devices in the CDI spec by GPU and MIG device index (e.g. '0:3') or by UUID [index | uuid]",
+			Destination: &exportFlags.CDIDeviceNames,
+			Value:       CDIDeviceNamesIndex,
+			EnvVars:     []string{"MIG_PARTED_CDI_DEVICE_NAMES"},
+		},
+		&cli.StringFlag{
+			Name:        "mig-strategy",
+			Usage:       "MIG strategy of the device plugin config output with '--output-format=device-plugin' [mixed | single]",
+			Destination: &exportFlags.MigStrategy,
+			Value:       MigStrategyMixed,
+			EnvVars:     []string{"MIG_PARTED_MIG_STRATEGY"},
+		},
+		&cli.StringFlag{
+			Name:        "gpus",
+			Usage:       "Comma separated list of GPU indices to export, e.g. '0,3' (all GPUs by default)",
+			Destination: &exportFlags.GPUs,
+			EnvVars:     []string{"MIG_PARTED_GPUS"},
+		},
+		&cli.BoolFlag{
+			Name:        "best-effort",
+			Usage:       "Omit the GPUs whose MIG configuration cannot be read instead of failing the export, marking them with a comment in YAML output",
+			Destination: &exportFlags.BestEffort,
+			Value:       false,
+			EnvVars:     []string{"MIG_PARTED_BEST_EFFORT"},
+		},
 	}
 
 	return &export
@@ -106,11 +161,24 @@ func exportWrapper(c *cli.Context, f *Flags) error {
 		Flags:   f,
 	}
 
-	if f.Placements {
-		return exportPlacements(f)
+	if f.OutputFormat == CDIFormat {
+		return exportCDISpec(c.Context, f)
+	}
+
+	if f.OutputFormat == DevicePluginFormat {
+		return exportDevicePluginConfig(&context)
+	}
+
+	if f.Placements || f.DetailedPlacements {
+		return exportPlacements(c.Context, f)
 	}
 
-	spec, err := ExportMigConfigs(&context)
+	spec, omitted, err := exportMigConfigs(&context)
+	if err != nil {
+		return err
+	}
+
+	err = writeOmittedGPUs(os.Stdout, omitted, f)
 	if err != nil {
 		return err
 	}
@@ -127,24 +195,67 @@ func CheckFlags(f *Flags) error {
 	switch f.OutputFormat {
 	case JSONFormat:
 	case YAMLFormat:
+	case CDIFormat, DevicePluginFormat:
+		if f.Placements || f.DetailedPlacements {
+			return fmt.Errorf("'output-format' %v cannot be combined with placements", f.OutputFormat)
+		}
 	default:
 		return fmt.Errorf("unrecognized 'output-format': %v", f.OutputFormat)
 	}
+	if f.Placements && f.DetailedPlacements {
+		return fmt.Errorf("'placements' cannot be combined with 'detailed-placements'")
+	}
+	if f.BestEffort && (f.OutputFormat == CDIFormat || f.Placements || f.DetailedPlacements) {
+		return fmt.Errorf("'best-effort' cannot be combined with placements or 'output-format' %v", CDIFormat)
+	}
+	_, err := enumerator.ParseIndices(f.GPUs)
+	if err != nil {
+		return fmt.Errorf("invalid 'gpus': %w", err)
+	}
+	switch f.CDIDeviceNames {
+	case CDIDeviceNamesIndex:
+	case CDIDeviceNamesUUID:
+	default:
+		return fmt.Errorf("unrecognized 'cdi-device-names': %v", f.CDIDeviceNames)
+	}
+	switch f.MigStrategy {
+	case MigStrategyMixed:
+	case MigStrategySingle:
+	default:
+		return fmt.Errorf("unrecognized 'mig-strategy': %v", f.MigStrategy)
+	}
+	return nil
+}
+
+// writeOmittedGPUs marks the GPUs omitted from a best-effort export with a
+// comment ahead of YAML output. Other formats have no comments, so that the
+// GPUs are only logged.
+func writeOmittedGPUs(w io.Writer, omitted []omittedGPU, f *Flags) error {
+	if f.OutputFormat != YAMLFormat && f.OutputFormat != DevicePluginFormat {
+		return nil
+	}
+	for _, gpu := range omitted {
+		message := strings.Join(strings.Fields(gpu.err.Error()), " ")
+		_, err := fmt.Fprintf(w, "# GPU %v omitted: %v\n", gpu.index, message)
+		if err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+	}
 	return nil
 }
 
 func WriteOutput(w io.Writer, spec interface{}, f *Flags) error {
 	switch f.OutputFormat {
-	case YAMLFormat:
+	case YAMLFormat, CDIFormat, DevicePluginFormat:
 		output, err := yaml.Marshal(spec)
 		if err != nil {
-			return fmt.Errorf("error unmarshaling MIG config to YAML: %v", err)
+			return fmt.Errorf("error unmarshaling MIG config to YAML: %w", err)
 		}
 		w.Write(output)
 	case JSONFormat:
 		output, err := json.MarshalIndent(spec, "", "  ")
 		if err != nil {
-			return fmt.Errorf("error unmarshaling MIG config to JSON: %v", err)
+			return fmt.Errorf("error unmarshaling MIG config to JSON: %w", err)
 		}
 		w.Write(output)
 	}
@@ -195,8 +195,38 @@ func TestMergeConfigSpecs(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.Description, func(t *testing.T) {
-			merged := mergeMigConfigSpecs(tc.Input)
+			merged := mergeMigConfigSpecs(tc.Input, true)
 			require.Equal(t, tc.Output, merged)
 		})
 	}
 }
+
+func TestMergeConfigSpecsPartial(t *testing.T) {
+	input := v1.MigConfigSpecSlice{
+		{
+			DeviceFilter: []string{"A100-SXM4-40GB"},
+			Devices:      []int{0},
+			MigEnabled:   false,
+		},
+		{
+			DeviceFilter: []string{"A100-SXM4-80GB"},
+			Devices:      []int{2},
+			MigEnabled:   true,
+		},
+	}
+
+	output := v1.MigConfigSpecSlice{
+		{
+			DeviceFilter: "A100-SXM4-40GB",
+			Devices:      []int{0},
+			MigEnabled:   false,
+		},
+		{
+			DeviceFilter: "A100-SXM4-80GB",
+			Devices:      []int{2},
+			MigEnabled:   true,
+		},
+	}
+
+	require.Equal(t, output, mergeMigConfigSpecs(input, false))
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package export
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/NVIDIA/mig-parted/cmd/util"
+	cli "github.com/urfave/cli/v2"
+)
+
+// WriteHooksExportFile writes the current MIG config of the node, as
+// exported in YAML, to a temporary file passed to hooks, if there are any. The
+// returned function removes the file. Failing to export is only logged, as
+// hooks are then run without the file.
+func WriteHooksExportFile(c *cli.Context, hooks *util.Hooks) func() {
+	if hooks.Empty() {
+		return func() {}
+	}
+
+	path, err := writeExportFile(c)
+	if err != nil {
+		log.Warnf("Unable to export current MIG config for hooks: %v", err)
+		return func() {}
+	}
+
+	hooks.ExportFile = path
+	return func() {
+		hooks.ExportFile = ""
+		os.Remove(path)
+	}
+}
+
+func writeExportFile(c *cli.Context) (string, error) {
+	f := &Flags{
+		OutputFormat: YAMLFormat,
+		ConfigLabel:  DefaultConfigLabel,
+	}
+	spec, err := ExportMigConfigs(&Context{Context: c, Flags: f})
+	if err != nil {
+		return "", err
+	}
+
+	file, err := ioutil.TempFile("", "nvidia-mig-parted-export-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("error creating export file: %w", err)
+	}
+	defer file.Close()
+
+	err = WriteOutput(file, spec, f)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
@@ -1,18 +1,28 @@
 package export
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"sort"
 
+	placements "github.com/NVIDIA/mig-parted/api/placements/v1"
 	"github.com/NVIDIA/mig-parted/cmd/util"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/types"
 )
 
-func exportPlacements(f *Flags) error {
-	spec, err := exportMigPlacements()
+func exportPlacements(ctx context.Context, f *Flags) error {
+	spec, err := exportMigPlacements(ctx, f)
 	if err != nil {
 		return err
 	}
-	err = WriteOutput(os.Stdout, spec, f)
+	var output interface{} = spec.UUIDsByPlacement()
+	if f.DetailedPlacements {
+		output = spec
+	}
+	err = WriteOutput(os.Stdout, output, f)
 	if err != nil {
 		return err
 	}
@@ -20,16 +30,56 @@ func exportPlacements(f *Flags) error {
 	return nil
 }
 
-func exportMigPlacements() (map[int]map[int]string, error) {
+// exportMigPlacements returns the MIG device placements of the GPUs selected
+// by '--gpus'.
+func exportMigPlacements(ctx context.Context, f *Flags) (*placements.Spec, error) {
 	nvidiaModuleLoaded, err := util.IsNvidiaModuleLoaded()
 	if err != nil {
-		return nil, fmt.Errorf("error checking if nvidia module loaded: %v", err)
+		return nil, fmt.Errorf("error checking if nvidia module loaded: %w", err)
 	}
 	if !nvidiaModuleLoaded {
-		return nil, fmt.Errorf("nvidia module must be loaded in order to query MIG device state")
+		return nil, types.NewError(types.ErrorCategoryDriverNotLoaded, -1, "nvidia module must be loaded in order to query MIG device state")
+	}
+
+	indices, err := enumerator.ParseIndices(f.GPUs)
+	if err != nil {
+		return nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "error parsing GPU indices: %v", err)
+	}
+
+	manager := config.NewNvmlMigConfigManager()
+
+	spec, err := manager.GetMigPlacements(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	manager := util.NewCombinedMigManager()
+	return selectPlacementsGPUs(spec, indices)
+}
+
+// selectPlacementsGPUs keeps only the GPUs of spec whose index is listed. A
+// nil list of indices keeps all GPUs.
+func selectPlacementsGPUs(spec *placements.Spec, indices []int) (*placements.Spec, error) {
+	if indices == nil {
+		return spec, nil
+	}
+
+	gpus := make(map[int]placements.GPUSpec)
+	for _, gpu := range spec.GPUs {
+		gpus[gpu.Index] = gpu
+	}
+
+	selected := []placements.GPUSpec{}
+	for _, i := range indices {
+		gpu, exists := gpus[i]
+		if !exists {
+			return nil, types.NewError(types.ErrorCategoryInvalidConfig, i, "GPU index out of range: %v", i)
+		}
+		selected = append(selected, gpu)
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Index < selected[j].Index
+	})
+	spec.GPUs = selected
 
-	return manager.GetMigPlacements()
+	return spec, nil
 }
@@ -17,21 +17,52 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/NVIDIA/mig-parted/cmd/apply"
 	"github.com/NVIDIA/mig-parted/cmd/assert"
+	"github.com/NVIDIA/mig-parted/cmd/clear"
+	"github.com/NVIDIA/mig-parted/cmd/diff"
 	"github.com/NVIDIA/mig-parted/cmd/export"
+	"github.com/NVIDIA/mig-parted/cmd/reset"
+	"github.com/NVIDIA/mig-parted/cmd/status"
 	"github.com/NVIDIA/mig-parted/cmd/util"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli/v2"
 )
 
 type Flags struct {
-	Debug bool
+	Debug            bool
+	SysfsRoot        string
+	BootTimeout      time.Duration
+	BootPollInterval time.Duration
+	LockFile         string
+	LockTimeout      time.Duration
 }
 
 func main() {
+	c := newApp()
+
+	// Stop cleanly between GPUs on the first SIGTERM / SIGINT
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handleSignals(cancel)
+
+	// Run the CLI
+	err := c.RunContext(ctx, os.Args)
+	if err != nil {
+		log.Error(util.Capitalize(err.Error()))
+		os.Exit(util.ExitCode(err))
+	}
+}
+
+func newApp() *cli.App {
 	// Create a flags struct to hold our flags
 	flags := Flags{}
 
@@ -51,13 +82,50 @@ func main() {
 			Destination: &flags.Debug,
 			EnvVars:     []string{"MIG_PARTED_DEBUG"},
 		},
+		&cli.StringFlag{
+			Name:        "sysfs-root",
+			Usage:       "Directory to enumerate PCI devices from instead of " + enumerator.DefaultSysfsRoot,
+			Destination: &flags.SysfsRoot,
+			EnvVars:     []string{"MIG_PARTED_SYSFS_ROOT"},
+		},
+		&cli.DurationFlag{
+			Name:        "boot-timeout",
+			Usage:       "Time to wait for a GPU to finish booting when accessing it without the NVIDIA driver",
+			Value:       mode.WaitForBootTimeout,
+			Destination: &flags.BootTimeout,
+			EnvVars:     []string{"MIG_PARTED_BOOT_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "boot-poll-interval",
+			Usage:       "Initial interval between checks of whether a GPU has finished booting (doubles after each check)",
+			Value:       mode.WaitForBootSleepInterval,
+			Destination: &flags.BootPollInterval,
+			EnvVars:     []string{"MIG_PARTED_BOOT_POLL_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:        "lock-file",
+			Usage:       "File to lock while changing the MIG configuration of the node, so that concurrent invocations wait for each other (empty to disable)",
+			Value:       util.DefaultLockFile,
+			Destination: &flags.LockFile,
+			EnvVars:     []string{"MIG_PARTED_LOCK_FILE"},
+		},
+		&cli.DurationFlag{
+			Name:        "lock-timeout",
+			Usage:       "Time to wait for another invocation to release the lock file (0 for no limit)",
+			Destination: &flags.LockTimeout,
+			EnvVars:     []string{"MIG_PARTED_LOCK_TIMEOUT"},
+		},
 	}
 
 	// Register the subcommands with the top-level CLI
 	c.Commands = []*cli.Command{
 		apply.BuildCommand(),
 		assert.BuildCommand(),
+		clear.BuildCommand(),
+		diff.BuildCommand(),
 		export.BuildCommand(),
+		reset.BuildCommand(),
+		status.BuildCommand(),
 	}
 
 	// Set log-level for all subcommands
@@ -70,14 +138,36 @@ func main() {
 		applyLog.SetLevel(logLevel)
 		assertLog := assert.GetLogger()
 		assertLog.SetLevel(logLevel)
+		clearLog := clear.GetLogger()
+		clearLog.SetLevel(logLevel)
+		diffLog := diff.GetLogger()
+		diffLog.SetLevel(logLevel)
 		exportLog := export.GetLogger()
 		exportLog.SetLevel(logLevel)
+		resetLog := reset.GetLogger()
+		resetLog.SetLevel(logLevel)
+		statusLog := status.GetLogger()
+		statusLog.SetLevel(logLevel)
+		log.SetLevel(logLevel)
 		return nil
 	}
 
-	// Run the CLI
-	err := c.Run(os.Args)
-	if err != nil {
-		log.Fatalf(util.Capitalize(err.Error()))
-	}
+	return c
+}
+
+// handleSignals cancels the context passed to all subcommands on the first
+// SIGTERM or SIGINT received. Subcommands check this context between GPUs, so
+// the GPU currently being reconfigured is never left half way through. A
+// second signal exits immediately.
+func handleSignals(cancel context.CancelFunc) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+
+	sig := <-sigs
+	log.Warnf("Received %v, stopping after the current GPU (repeat to exit immediately)", sig)
+	cancel()
+
+	sig = <-sigs
+	log.Errorf("Received %v, exiting immediately", sig)
+	os.Exit(util.ExitCodeCanceled)
 }
@@ -0,0 +1,318 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/cmd/diff"
+	"github.com/NVIDIA/mig-parted/cmd/status"
+	"github.com/NVIDIA/mig-parted/cmd/util"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+version: v1
+mig-configs:
+  all-disabled:
+  - devices: all
+    mig-enabled: false
+    mig-devices: {}
+  all-enabled:
+  - devices: all
+    mig-enabled: true
+    mig-devices: {}
+  first-enabled:
+  - devices: [0]
+    mig-enabled: true
+    mig-devices: {}
+  - devices: [1]
+    mig-enabled: false
+    mig-devices: {}
+`
+
+func newMockA100Bar0(migEnabled bool) map[int]uint32 {
+	bar0 := map[int]uint32{
+		mode.PmcIDReg:        0x170000a1,
+		mode.BootCompleteReg: mode.BootCompleteValue,
+	}
+	if migEnabled {
+		bar0[mode.MigModeCheckReg] = mode.MigModeCheckEnabled
+	}
+	return bar0
+}
+
+func setupMockNode(t *testing.T) (string, string) {
+	root, err := enumerator.NewMockSysfs(
+		enumerator.MockGPU{Address: "0000:3b:00.0", Device: 0x20b0, Bar0: newMockA100Bar0(true)},
+		enumerator.MockGPU{Address: "0000:86:00.0", Device: 0x20b0, Bar0: newMockA100Bar0(false)},
+	)
+	require.Nil(t, err, "Unexpected failure creating mock sysfs")
+	t.Cleanup(func() {
+		os.RemoveAll(root)
+		os.Remove(root + ".lock")
+	})
+
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	err = ioutil.WriteFile(configFile, []byte(testConfig), 0644)
+	require.Nil(t, err, "Unexpected failure writing config file")
+
+	// Run commands as if the NVIDIA kernel module wasn't loaded, so that they
+	// use the mock sysfs rather than the GPUs of the host.
+	procModules := filepath.Join(t.TempDir(), "modules")
+	err = ioutil.WriteFile(procModules, []byte("ext4 737280 1 - Live 0x0000000000000000\n"), 0644)
+	require.Nil(t, err, "Unexpected failure writing kernel modules file")
+	defaultProcModules := util.ProcModules
+	util.ProcModules = procModules
+	t.Cleanup(func() {
+		util.ProcModules = defaultProcModules
+	})
+
+	return root, configFile
+}
+
+func run(root string, args ...string) error {
+	args = append([]string{"nvidia-mig-parted", "--sysfs-root", root, "--lock-file", root + ".lock"}, args...)
+	return newApp().RunContext(context.Background(), args)
+}
+
+func runWithOutput(root string, args ...string) (string, error) {
+	var output bytes.Buffer
+	app := newApp()
+	app.Writer = &output
+	args = append([]string{"nvidia-mig-parted", "--sysfs-root", root, "--lock-file", root + ".lock"}, args...)
+	err := app.RunContext(context.Background(), args)
+	return output.String(), err
+}
+
+func readReg(t *testing.T, root, address string, reg int) uint32 {
+	bar0, err := ioutil.ReadFile(filepath.Join(root, address, "resource0"))
+	require.Nil(t, err, "Unexpected failure reading bar0")
+	return binary.LittleEndian.Uint32(bar0[reg:])
+}
+
+func TestAssertModeOnly(t *testing.T) {
+	root, configFile := setupMockNode(t)
+
+	err := run(root, "assert", "--mode-only", "-f", configFile, "-c", "first-enabled")
+	require.Nil(t, err, "Unexpected failure asserting current MIG mode")
+
+	err = run(root, "assert", "--mode-only", "-f", configFile, "-c", "all-enabled")
+	require.NotNil(t, err, "Unexpected success asserting MIG mode not applied")
+
+	err = run(root, "assert", "--mode-only", "--gpus", "0", "-f", configFile, "-c", "all-enabled")
+	require.Nil(t, err, "Unexpected failure asserting MIG mode of selected GPUs")
+
+	err = run(root, "assert", "--mode-only", "--gpus", "1", "-f", configFile, "-c", "all-disabled")
+	require.Nil(t, err, "Unexpected failure asserting MIG mode of selected GPUs")
+
+	err = run(root, "assert", "--mode-only", "--gpus", "2", "-f", configFile, "-c", "all-enabled")
+	require.NotNil(t, err, "Unexpected success asserting MIG mode of nonexistent GPU")
+
+	err = run(root, "assert", "--mode-only", "--gpus", "x", "-f", configFile, "-c", "all-enabled")
+	require.True(t, errors.Is(err, types.ErrInvalidConfig), "Unexpected error: %v", err)
+	require.Equal(t, util.ExitCodeInvalidConfig, util.ExitCode(err))
+}
+
+func TestAssertValidHooks(t *testing.T) {
+	root, configFile := setupMockNode(t)
+
+	testCases := []struct {
+		Description string
+		Hooks       string
+		Valid       bool
+	}{
+		{
+			"Valid",
+			"version: v1\nhooks:\n  pre-apply-mode:\n  - command: /bin/true\n    on-error: warn\n",
+			true,
+		},
+		{
+			"Unknown hook",
+			"version: v1\nhooks:\n  pre-aply-mode:\n  - command: /bin/true\n",
+			false,
+		},
+		{
+			"Unknown field",
+			"version: v1\nhooks:\n  pre-apply-mode:\n  - comand: /bin/true\n",
+			false,
+		},
+		{
+			"Missing command",
+			"version: v1\nhooks:\n  pre-apply-mode:\n  - args: [foo]\n",
+			false,
+		},
+		{
+			"Missing version",
+			"hooks:\n  pre-apply-mode:\n  - command: /bin/true\n",
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Description, func(t *testing.T) {
+			hooksFile := filepath.Join(t.TempDir(), "hooks.yaml")
+			err := ioutil.WriteFile(hooksFile, []byte(tc.Hooks), 0644)
+			require.Nil(t, err, "Unexpected failure writing hooks file")
+
+			err = run(root, "assert", "--valid-hooks", "--hooks-file", hooksFile)
+			if tc.Valid {
+				require.Nil(t, err, "Unexpected failure asserting hooks file is valid")
+				err = run(root, "assert", "--valid-hooks", "--valid-config", "--hooks-file", hooksFile, "-f", configFile, "-c", "all-enabled")
+				require.Nil(t, err, "Unexpected failure asserting hooks and config files are valid")
+				return
+			}
+			require.NotNil(t, err, "Unexpected success asserting hooks file is valid")
+			require.Equal(t, util.ExitCodeInvalidConfig, util.ExitCode(err))
+		})
+	}
+
+	err := run(root, "assert", "--valid-hooks")
+	require.NotNil(t, err, "Unexpected success asserting missing hooks file is valid")
+}
+
+func TestApplyModeOnly(t *testing.T) {
+	root, configFile := setupMockNode(t)
+
+	err := run(root, "apply", "--mode-only", "--skip-reset", "--gpus", "1", "-f", configFile, "-c", "all-enabled")
+	require.Nil(t, err, "Unexpected failure applying MIG mode")
+
+	require.Equal(t, mode.MigModeSetEnabled, readReg(t, root, "0000:86:00.0", mode.MigModeSetReg)&mode.MigModeSetMask)
+	require.Equal(t, uint32(0), readReg(t, root, "0000:3b:00.0", mode.MigModeSetReg)&mode.MigModeSetMask)
+}
+
+func TestApplyRebootRequired(t *testing.T) {
+	root, configFile := setupMockNode(t)
+	marker := filepath.Join(t.TempDir(), "reboot-required")
+
+	// Resetting a mock GPU does not apply its pending MIG mode change
+	err := run(root, "apply", "--mode-only", "--reboot-required-file", marker, "-f", configFile, "-c", "all-enabled")
+	require.True(t, errors.Is(err, types.ErrRebootRequired), "Unexpected error: %v", err)
+	require.Equal(t, util.ExitCodeRebootRequired, util.ExitCode(err))
+
+	contents, err := ioutil.ReadFile(filepath.Join(root, "0000:86:00.0", "reset"))
+	require.Nil(t, err)
+	require.Equal(t, "1", string(contents))
+
+	contents, err = ioutil.ReadFile(marker)
+	require.Nil(t, err, "Unexpected failure reading reboot-required file")
+	require.Equal(t, "GPU 1: MIG mode change still pending after GPU reset\n", string(contents))
+
+	err = run(root, "apply", "--mode-only", "--reboot-required-file", marker, "--gpus", "0", "-f", configFile, "-c", "all-enabled")
+	require.Nil(t, err, "Unexpected failure applying MIG mode")
+
+	_, err = os.Stat(marker)
+	require.True(t, os.IsNotExist(err), "Unexpected reboot-required file after success")
+}
+
+func TestReset(t *testing.T) {
+	root, _ := setupMockNode(t)
+
+	err := run(root, "reset", "--reset-method", "flr", "--gpus", "1")
+	require.Nil(t, err, "Unexpected failure resetting GPU")
+
+	contents, err := ioutil.ReadFile(filepath.Join(root, "0000:86:00.0", "reset"))
+	require.Nil(t, err)
+	require.Equal(t, "1", string(contents))
+
+	contents, err = ioutil.ReadFile(filepath.Join(root, "0000:3b:00.0", "reset"))
+	require.Nil(t, err)
+	require.Empty(t, string(contents))
+}
+
+func TestStatus(t *testing.T) {
+	root, configFile := setupMockNode(t)
+
+	output, err := runWithOutput(root, "status")
+	require.Nil(t, err, "Unexpected failure getting status")
+	require.Contains(t, output, "GPU 0: 0x20B010DE\n  PCI address       0000:3b:00.0\n")
+	require.Contains(t, output, "GPU 1: 0x20B010DE\n  PCI address       0000:86:00.0\n")
+	require.NotContains(t, output, "Selected MIG configuration")
+
+	output, err = runWithOutput(root, "status", "-o", "json", "-f", configFile, "-c", "all-disabled")
+	require.Nil(t, err, "Unexpected failure getting status")
+
+	var parsed status.Status
+	err = json.Unmarshal([]byte(output), &parsed)
+	require.Nil(t, err, "Unexpected failure parsing status")
+	require.Len(t, parsed.GPUs, 2)
+	require.Equal(t, "Enabled", parsed.GPUs[0].MigMode)
+	require.Equal(t, "Disabled", parsed.GPUs[1].MigMode)
+	require.Equal(t, "0000:86:00.0", parsed.GPUs[1].PCIAddress)
+	require.Equal(t, "all-disabled", parsed.Config.SelectedConfig)
+	require.False(t, parsed.Config.Applied)
+	require.NotEmpty(t, parsed.Config.Reason)
+
+	output, err = runWithOutput(root, "status", "-o", "json", "-f", configFile, "-c", "first-enabled")
+	require.Nil(t, err, "Unexpected failure getting status without the NVIDIA driver")
+
+	parsed = status.Status{}
+	err = json.Unmarshal([]byte(output), &parsed)
+	require.Nil(t, err, "Unexpected failure parsing status")
+	require.False(t, parsed.Config.Applied)
+	require.True(t, parsed.Config.Unknown)
+	require.NotEmpty(t, parsed.Config.Reason)
+
+	_, err = runWithOutput(root, "status", "-f", configFile, "-c", "nonexistent")
+	require.Equal(t, util.ExitCodeInvalidConfig, util.ExitCode(err))
+
+	_, err = runWithOutput(root, "status", "-c", "all-disabled")
+	require.NotNil(t, err, "Unexpected success getting status without config file")
+}
+
+func TestDiff(t *testing.T) {
+	root, configFile := setupMockNode(t)
+
+	output, err := runWithOutput(root, "diff", "-f", configFile, "-c", "all-disabled", "-c", "first-enabled")
+	require.Nil(t, err, "Unexpected failure diffing configs")
+	require.Equal(t, fmt.Sprintf(`--- %[1]s (all-disabled)
++++ %[1]s (first-enabled)
+GPU 0 (0x20B010DE)
+- mig-enabled: false
++ mig-enabled: true, mig-devices: none
+`, configFile), output)
+
+	output, err = runWithOutput(root, "diff", "-o", "json", "--inventory", "0x20B010DE*3", "-f", configFile, "-c", "all-enabled", "-c", "first-enabled")
+	require.Nil(t, err, "Unexpected failure diffing configs")
+
+	var parsed diff.Diff
+	err = json.Unmarshal([]byte(output), &parsed)
+	require.Nil(t, err, "Unexpected failure parsing diff")
+	require.Len(t, parsed.GPUs, 2)
+	require.Equal(t, 1, parsed.GPUs[0].Index)
+	require.False(t, parsed.GPUs[0].To.MigEnabled)
+	require.Equal(t, 2, parsed.GPUs[1].Index)
+	require.Nil(t, parsed.GPUs[1].To)
+
+	_, err = runWithOutput(root, "diff", "-f", configFile, "-c", "all-disabled", "-c", "nonexistent")
+	require.Equal(t, util.ExitCodeInvalidConfig, util.ExitCode(err))
+
+	_, err = runWithOutput(root, "diff", "-f", configFile, "-c", "all-disabled")
+	require.NotNil(t, err, "Unexpected success diffing a single config")
+}
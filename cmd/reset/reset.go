@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reset
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NVIDIA/mig-parted/cmd/export"
+	"github.com/NVIDIA/mig-parted/cmd/util"
+	migapply "github.com/NVIDIA/mig-parted/pkg/mig/apply"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+)
+
+var log = logrus.New()
+
+func GetLogger() *logrus.Logger {
+	return log
+}
+
+type Flags struct {
+	GPUs            string
+	HooksFile       string
+	HooksTimeout    time.Duration
+	HooksReportFile string
+	ResetMethod     string
+	ResetTimeout    time.Duration
+	Timeout         time.Duration
+}
+
+func BuildCommand() *cli.Command {
+	// Create a flags struct to hold our flags
+	resetFlags := Flags{}
+
+	// Create the 'reset' command
+	reset := cli.Command{}
+	reset.Name = "reset"
+	reset.Usage = "Reset the GPUs of the node, applying any pending MIG mode change"
+	reset.Action = func(c *cli.Context) error {
+		return resetWrapper(c, &resetFlags)
+	}
+
+	// Setup the flags for this command
+	reset.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "gpus",
+			Usage:       "Comma separated list of GPU indices to operate on, e.g. '0,3' (all GPUs by default)",
+			Destination: &resetFlags.GPUs,
+			EnvVars:     []string{"MIG_PARTED_GPUS"},
+		},
+		&cli.StringFlag{
+			Name:        "hooks-file",
+			Aliases:     []string{"k"},
+			Usage:       "Path to the hooks file",
+			Destination: &resetFlags.HooksFile,
+			EnvVars:     []string{"MIG_PARTED_HOOKS_FILE"},
+		},
+		&cli.DurationFlag{
+			Name:        "hooks-timeout",
+			Usage:       "Time limit for each hook to run (0 for no limit)",
+			Destination: &resetFlags.HooksTimeout,
+			EnvVars:     []string{"MIG_PARTED_HOOKS_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:        "hooks-report-file",
+			Usage:       "File to write a JSON report of all hook commands run to, including their output",
+			Destination: &resetFlags.HooksReportFile,
+			EnvVars:     []string{"MIG_PARTED_HOOKS_REPORT_FILE"},
+		},
+		&cli.StringFlag{
+			Name:        "reset-method",
+			Usage:       fmt.Sprintf("How to reset GPUs, one of %v", migapply.ResetMethods),
+			Value:       string(migapply.ResetMethodAuto),
+			Destination: &resetFlags.ResetMethod,
+			EnvVars:     []string{"MIG_PARTED_RESET_METHOD"},
+		},
+		&cli.DurationFlag{
+			Name:        "reset-timeout",
+			Usage:       "Time limit for resetting GPUs",
+			Value:       migapply.DefaultResetTimeout,
+			Destination: &resetFlags.ResetTimeout,
+			EnvVars:     []string{"MIG_PARTED_RESET_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "Overall time limit for resetting the GPUs (0 for no limit)",
+			Destination: &resetFlags.Timeout,
+			EnvVars:     []string{"MIG_PARTED_TIMEOUT"},
+		},
+	}
+
+	return &reset
+}
+
+func resetWrapper(c *cli.Context, f *Flags) error {
+	log.Debugf("Parsing Hooks file...")
+	hooks, err := util.NewHooks(c, f.HooksFile, f.HooksTimeout)
+	if err != nil {
+		return err
+	}
+
+	resetMethod, err := migapply.ParseResetMethod(f.ResetMethod)
+	if err != nil {
+		return err
+	}
+
+	nvidiaModuleLoaded, err := util.IsNvidiaModuleLoaded()
+	if err != nil {
+		return fmt.Errorf("error checking if nvidia module loaded: %w", err)
+	}
+	log.Debugf("NVIDIA kernel module loaded: %v", nvidiaModuleLoaded)
+
+	resetter, err := migapply.NewResetter(resetMethod, nvidiaModuleLoaded)
+	if err != nil {
+		return err
+	}
+
+	all, selected, err := util.NewGPUEnumerators(c.String("sysfs-root"), f.GPUs)
+	if err != nil {
+		return err
+	}
+
+	opts := []migapply.Option{
+		migapply.WithGPUEnumerator(selected),
+		migapply.WithModeManager(util.NewMigModeManager(c, all, nvidiaModuleLoaded)),
+		migapply.WithHooks(hooks),
+		migapply.WithResetter(resetter),
+		migapply.WithResetTimeout(f.ResetTimeout),
+		migapply.WithTimeout(f.Timeout),
+	}
+	if nvidiaModuleLoaded {
+		opts = append(opts, migapply.WithUUIDGetter(config.NewNvmlUUIDGetter()))
+	}
+	applier := migapply.New(opts...)
+
+	log.Debugf("Waiting for lock...")
+	unlock, err := util.LockNode(c)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	defer export.WriteHooksExportFile(c, hooks)()
+
+	result, err := applier.Reset(c.Context)
+	if f.HooksReportFile != "" {
+		reportErr := hooks.WriteReport(f.HooksReportFile)
+		if reportErr != nil {
+			log.Errorf("Error writing hooks report: %v", reportErr)
+		}
+	}
+	printResets(result)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("GPUs reset successfully")
+	return nil
+}
+
+// printResets prints how each GPU was reset, and whether it still needs a
+// reboot for its MIG mode change to take effect.
+func printResets(result *migapply.Result) {
+	for _, gpu := range result.GPUs {
+		switch {
+		case gpu.ResetError != nil:
+			fmt.Printf("GPU %v: reset using %v failed: %v\n", gpu.GPU, gpu.ResetMethod, gpu.ResetError)
+		case gpu.Reset:
+			fmt.Printf("GPU %v: reset using %v\n", gpu.GPU, gpu.ResetMethod)
+		}
+		if gpu.RebootRequired {
+			fmt.Printf("GPU %v: reboot required: %v\n", gpu.GPU, gpu.RebootReason)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	placements "github.com/NVIDIA/mig-parted/api/placements/v1"
+	"github.com/NVIDIA/mig-parted/cmd/assert"
+	"github.com/NVIDIA/mig-parted/cmd/util"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	migassert "github.com/NVIDIA/mig-parted/pkg/mig/assert"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+)
+
+var log = logrus.New()
+
+func GetLogger() *logrus.Logger {
+	return log
+}
+
+const (
+	TableFormat = "table"
+	JSONFormat  = "json"
+)
+
+type Flags struct {
+	ConfigFile     string
+	SelectedConfig string
+	OutputFormat   string
+}
+
+// Status is the MIG state of all GPUs of the node, and whether a MIG config
+// is currently applied to them if one was selected.
+type Status struct {
+	GPUs   []GPUStatus   `json:"gpus"`
+	Config *ConfigStatus `json:"config,omitempty"`
+}
+
+// GPUStatus is the MIG state of a single GPU. The name and UUID of the GPU,
+// and its MIG devices, are only known if the NVIDIA driver is loaded.
+type GPUStatus struct {
+	Index          int                        `json:"index"`
+	PCIAddress     string                     `json:"pci-address"`
+	DeviceID       string                     `json:"device-id"`
+	Name           string                     `json:"name,omitempty"`
+	UUID           string                     `json:"uuid,omitempty"`
+	MigCapable     bool                       `json:"mig-capable"`
+	MigMode        string                     `json:"mig-mode,omitempty"`
+	PendingMigMode string                     `json:"pending-mig-mode,omitempty"`
+	MigDevices     []placements.MigDeviceSpec `json:"mig-devices"`
+}
+
+// ConfigStatus is whether the selected MIG config of a config file is
+// currently applied, and why not if it isn't. Whether it is applied is
+// unknown if it sets MIG devices on GPUs in the right MIG mode, but the
+// NVIDIA driver is not loaded to query them.
+type ConfigStatus struct {
+	ConfigFile     string `json:"config-file"`
+	SelectedConfig string `json:"selected-config"`
+	Applied        bool   `json:"applied"`
+	Unknown        bool   `json:"unknown,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// driverNotLoadedConfigManager is the config.Manager asserting MIG configs
+// when the NVIDIA driver is not loaded, failing to query MIG devices. Only
+// GetMigConfig is used by the asserter.
+type driverNotLoadedConfigManager struct {
+	config.Manager
+}
+
+func BuildCommand() *cli.Command {
+	// Create a flags struct to hold our flags
+	statusFlags := Flags{}
+
+	// Create the 'status' command
+	status := cli.Command{}
+	status.Name = "status"
+	status.Usage = "Show the MIG mode and MIG devices of each GPU, and whether a specific MIG configuration is currently applied"
+	status.Action = func(c *cli.Context) error {
+		return statusWrapper(c, &statusFlags)
+	}
+
+	// Setup the flags for this command
+	status.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:        "config-file",
+			Aliases:     []string{"f"},
+			Usage:       "Path to the configuration file to check against",
+			Destination: &statusFlags.ConfigFile,
+			EnvVars:     []string{"MIG_PARTED_CONFIG_FILE"},
+		},
+		&cli.StringFlag{
+			Name:        "selected-config",
+			Aliases:     []string{"c"},
+			Usage:       "The label of the mig-config from the config file to check against",
+			Destination: &statusFlags.SelectedConfig,
+			EnvVars:     []string{"MIG_PARTED_SELECTED_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:        "output-format",
+			Aliases:     []string{"o"},
+			Usage:       "Format for the output [table | json]",
+			Destination: &statusFlags.OutputFormat,
+			Value:       TableFormat,
+			EnvVars:     []string{"MIG_PARTED_OUTPUT_FORMAT"},
+		},
+	}
+
+	return &status
+}
+
+func statusWrapper(c *cli.Context, f *Flags) error {
+	err := CheckFlags(f)
+	if err != nil {
+		cli.ShowSubcommandHelp(c)
+		return err
+	}
+
+	nvidiaModuleLoaded, err := util.IsNvidiaModuleLoaded()
+	if err != nil {
+		return fmt.Errorf("error checking if nvidia module loaded: %w", err)
+	}
+	log.Debugf("NVIDIA kernel module loaded: %v", nvidiaModuleLoaded)
+
+	all, _, err := util.NewGPUEnumerators(c.String("sysfs-root"), "")
+	if err != nil {
+		return err
+	}
+
+	modeManager := util.NewMigModeManager(c, all, nvidiaModuleLoaded)
+	var configManager config.Manager
+	if nvidiaModuleLoaded {
+		configManager = config.NewNvmlMigConfigManager()
+	}
+
+	log.Debugf("Getting the MIG state of all GPUs...")
+	status, err := GetStatus(c.Context, all, modeManager, configManager)
+	if err != nil {
+		return err
+	}
+
+	if f.ConfigFile != "" {
+		log.Debugf("Checking if the selected MIG config is applied...")
+		status.Config, err = getConfigStatus(c, f, all, modeManager, configManager)
+		if err != nil {
+			return err
+		}
+	}
+
+	return WriteStatus(c.App.Writer, status, f.OutputFormat)
+}
+
+func CheckFlags(f *Flags) error {
+	switch f.OutputFormat {
+	case TableFormat:
+	case JSONFormat:
+	default:
+		return fmt.Errorf("unrecognized 'output-format': %v", f.OutputFormat)
+	}
+	if f.SelectedConfig != "" && f.ConfigFile == "" {
+		return fmt.Errorf("missing required flags 'config-file'")
+	}
+	return nil
+}
+
+// GetStatus returns the MIG state of the GPUs of gpus. The MIG devices of the
+// GPUs are only looked up if configManager is not nil, as doing so requires
+// the NVIDIA driver to be loaded.
+func GetStatus(ctx context.Context, gpus enumerator.Interface, modeManager mode.Manager, configManager config.Manager) (*Status, error) {
+	devices, err := gpus.GetGPUs()
+	if err != nil {
+		return nil, fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+
+	placementsByGPU := make(map[int]placements.GPUSpec)
+	if configManager != nil {
+		spec, err := configManager.GetMigPlacements(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting MIG devices: %w", err)
+		}
+		for _, gpu := range spec.GPUs {
+			placementsByGPU[gpu.Index] = gpu
+		}
+	}
+
+	status := &Status{
+		GPUs: []GPUStatus{},
+	}
+	for _, device := range devices {
+		i := device.Index
+		if ctx.Err() != nil {
+			return nil, types.NewContextError(i, ctx.Err())
+		}
+
+		gpu := GPUStatus{
+			Index:      i,
+			PCIAddress: device.Address,
+			DeviceID:   types.NewDeviceID(device.Device, device.Vendor).String(),
+		}
+		if p, exists := placementsByGPU[i]; exists {
+			gpu.Name = p.Name
+			gpu.UUID = p.UUID
+			gpu.MigDevices = p.MigDevices
+		}
+
+		gpu.MigCapable, err = modeManager.IsMigCapable(ctx, i)
+		if err != nil {
+			return nil, fmt.Errorf("error checking MIG capable: %w", err)
+		}
+		if gpu.MigCapable {
+			current, err := modeManager.GetMigMode(ctx, i)
+			if err != nil {
+				return nil, fmt.Errorf("error getting MIG mode: %w", err)
+			}
+			pending, err := modeManager.IsMigModeChangePending(ctx, i)
+			if err != nil {
+				return nil, fmt.Errorf("error checking for pending MIG mode change: %w", err)
+			}
+			gpu.MigMode = current.String()
+			gpu.PendingMigMode = current.String()
+			if pending {
+				gpu.PendingMigMode = toggle(current).String()
+			}
+		}
+
+		status.GPUs = append(status.GPUs, gpu)
+	}
+
+	return status, nil
+}
+
+// getConfigStatus asserts the selected MIG config of the config file of f
+// as the 'assert' command does. The MIG devices of the GPUs are only asserted
+// if configManager is not nil, as doing so requires the NVIDIA driver to be
+// loaded.
+func getConfigStatus(c *cli.Context, f *Flags, gpus enumerator.Interface, modeManager mode.Manager, configManager config.Manager) (*ConfigStatus, error) {
+	assertFlags := &assert.Flags{
+		ConfigFile:     f.ConfigFile,
+		SelectedConfig: f.SelectedConfig,
+	}
+
+	spec, err := assert.ParseConfigFile(assertFlags)
+	if err != nil {
+		return nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "error parsing config file: %v", err)
+	}
+
+	migConfig, err := assert.GetSelectedMigConfig(assertFlags, spec)
+	if err != nil {
+		return nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "error selecting MIG config: %v", err)
+	}
+
+	status := &ConfigStatus{
+		ConfigFile:     f.ConfigFile,
+		SelectedConfig: assertFlags.SelectedConfig,
+	}
+
+	if configManager == nil {
+		configManager = driverNotLoadedConfigManager{}
+	}
+
+	asserter := migassert.New(
+		migassert.WithModeManager(modeManager),
+		migassert.WithConfigManager(configManager),
+		migassert.WithGPUEnumerator(gpus),
+	)
+
+	_, err = asserter.AssertMigMode(c.Context, migConfig)
+	if err == nil {
+		_, err = asserter.AssertMigConfig(c.Context, migConfig)
+	}
+	if errors.Is(err, migassert.ErrNotApplied) {
+		status.Reason = err.Error()
+		return status, nil
+	}
+	if errors.Is(err, &types.Error{Category: types.ErrorCategoryDriverNotLoaded}) {
+		status.Unknown = true
+		status.Reason = err.Error()
+		return status, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status.Applied = true
+	return status, nil
+}
+
+// WriteStatus writes status to w in the given output format.
+func WriteStatus(w io.Writer, status *Status, format string) error {
+	switch format {
+	case JSONFormat:
+		output, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling status to JSON: %w", err)
+		}
+		_, err = w.Write(append(output, '\n'))
+		return err
+	case TableFormat:
+		return writeTable(w, status)
+	}
+	return fmt.Errorf("unrecognized 'output-format': %v", format)
+}
+
+func writeTable(w io.Writer, status *Status) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	for i, gpu := range status.GPUs {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+
+		name := gpu.DeviceID
+		if gpu.Name != "" {
+			name = fmt.Sprintf("%s (%s)", gpu.Name, gpu.DeviceID)
+		}
+		fmt.Fprintf(tw, "GPU %d: %s\n", gpu.Index, name)
+		fmt.Fprintf(tw, "  PCI address\t%s\n", gpu.PCIAddress)
+		if gpu.UUID != "" {
+			fmt.Fprintf(tw, "  UUID\t%s\n", gpu.UUID)
+		}
+		fmt.Fprintf(tw, "  MIG capable\t%v\n", gpu.MigCapable)
+		if !gpu.MigCapable {
+			continue
+		}
+		fmt.Fprintf(tw, "  MIG mode\t%s\n", gpu.MigMode)
+		fmt.Fprintf(tw, "  Pending MIG mode\t%s\n", gpu.PendingMigMode)
+
+		switch {
+		case gpu.MigDevices == nil:
+			fmt.Fprintf(tw, "  MIG devices\tunknown (NVIDIA driver not loaded)\n")
+		case len(gpu.MigDevices) == 0:
+			fmt.Fprintf(tw, "  MIG devices\tnone\n")
+		default:
+			// Flush so that the columns of MIG devices are aligned separately
+			tw.Flush()
+			fmt.Fprintf(tw, "  MIG devices:\n")
+			fmt.Fprintf(tw, "    PROFILE\tPLACEMENT\tGPU INSTANCE\tCOMPUTE INSTANCE\tUUID\n")
+			for _, d := range gpu.MigDevices {
+				fmt.Fprintf(tw, "    %s\t%d:%d\t%d\t%d\t%s\n", d.Profile, d.Placement.Start, d.Placement.Size, d.GpuInstanceID, d.ComputeInstanceID, d.UUID)
+			}
+			tw.Flush()
+		}
+	}
+
+	if status.Config != nil {
+		fmt.Fprintln(tw)
+		if status.Config.Applied {
+			fmt.Fprintf(tw, "Selected MIG configuration '%s' from %s currently applied\n", status.Config.SelectedConfig, status.Config.ConfigFile)
+		} else if status.Config.Unknown {
+			fmt.Fprintf(tw, "Unable to tell if selected MIG configuration '%s' from %s is currently applied: %s\n", status.Config.SelectedConfig, status.Config.ConfigFile, status.Config.Reason)
+		} else {
+			fmt.Fprintf(tw, "Selected MIG configuration '%s' from %s not currently applied: %s\n", status.Config.SelectedConfig, status.Config.ConfigFile, status.Config.Reason)
+		}
+	}
+
+	return tw.Flush()
+}
+
+func (driverNotLoadedConfigManager) GetMigConfig(ctx context.Context, gpu int) (types.MigConfig, error) {
+	return nil, types.NewError(types.ErrorCategoryDriverNotLoaded, gpu, "nvidia module must be loaded in order to query MIG device state")
+}
+
+func toggle(m mode.MigMode) mode.MigMode {
+	if m == mode.Enabled {
+		return mode.Disabled
+	}
+	return mode.Enabled
+}
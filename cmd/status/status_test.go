@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package status
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	placements "github.com/NVIDIA/mig-parted/api/placements/v1"
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// pendingModeManager reports a pending MIG mode change on the GPUs set in
+// pending, which the NVML mock does not model.
+type pendingModeManager struct {
+	mode.Manager
+	pending map[int]bool
+}
+
+func (m *pendingModeManager) IsMigModeChangePending(ctx context.Context, gpu int) (bool, error) {
+	return m.pending[gpu], nil
+}
+
+func TestGetStatus(t *testing.T) {
+	server := nvml.NewMockNVMLOnLunaServer().(*nvml.MockLunaServer)
+	modeManager := mode.NewNvmlMigModeManagerWith(server)
+	configManager := config.NewNvmlMigConfigManagerWith(server)
+	gpus := enumerator.NewMockGPUs(len(server.Devices))
+	ctx := context.Background()
+
+	require.Nil(t, modeManager.SetMigMode(ctx, 0, mode.Enabled))
+	require.Nil(t, configManager.SetMigConfig(ctx, 0, types.MigConfig{"3g.20gb": 1, "1g.5gb": 2}))
+
+	pending := &pendingModeManager{modeManager, map[int]bool{1: true}}
+
+	status, err := GetStatus(ctx, gpus, pending, configManager)
+	require.Nil(t, err)
+	require.Nil(t, status.Config)
+	require.Len(t, status.GPUs, len(server.Devices))
+
+	gpu := status.GPUs[0]
+	require.Equal(t, 0, gpu.Index)
+	require.Equal(t, "0x20B010DE", gpu.DeviceID)
+	require.Equal(t, "A100-SXM4-40GB", gpu.Name)
+	require.Equal(t, "GPU-abcd-0", gpu.UUID)
+	require.True(t, gpu.MigCapable)
+	require.Equal(t, "Enabled", gpu.MigMode)
+	require.Equal(t, "Enabled", gpu.PendingMigMode)
+	require.Len(t, gpu.MigDevices, 3)
+	require.Equal(t, types.MigProfile("3g.20gb"), gpu.MigDevices[0].Profile)
+	require.Equal(t, placements.Placement{Start: 0, Size: 4}, gpu.MigDevices[0].Placement)
+
+	gpu = status.GPUs[1]
+	require.Equal(t, "Disabled", gpu.MigMode)
+	require.Equal(t, "Enabled", gpu.PendingMigMode)
+	require.Equal(t, []placements.MigDeviceSpec{}, gpu.MigDevices)
+
+	status, err = GetStatus(ctx, gpus, modeManager, nil)
+	require.Nil(t, err)
+	require.Equal(t, "", status.GPUs[0].Name)
+	require.Equal(t, "", status.GPUs[0].UUID)
+	require.Nil(t, status.GPUs[0].MigDevices)
+	require.Equal(t, "Enabled", status.GPUs[0].MigMode)
+}
+
+func TestWriteStatus(t *testing.T) {
+	status := &Status{
+		GPUs: []GPUStatus{
+			{
+				Index:          0,
+				PCIAddress:     "0000:3b:00.0",
+				DeviceID:       "0x20B010DE",
+				Name:           "A100-SXM4-40GB",
+				UUID:           "GPU-0",
+				MigCapable:     true,
+				MigMode:        "Enabled",
+				PendingMigMode: "Enabled",
+				MigDevices: []placements.MigDeviceSpec{
+					{UUID: "MIG-0", Profile: "3g.20gb", Placement: placements.Placement{Start: 0, Size: 4}, GpuInstanceID: 1},
+					{UUID: "MIG-1", Profile: "1g.5gb", Placement: placements.Placement{Start: 4, Size: 1}, GpuInstanceID: 9},
+				},
+			},
+			{
+				Index:          1,
+				PCIAddress:     "0000:86:00.0",
+				DeviceID:       "0x20B010DE",
+				MigCapable:     true,
+				MigMode:        "Disabled",
+				PendingMigMode: "Enabled",
+			},
+			{
+				Index:      2,
+				PCIAddress: "0000:af:00.0",
+				DeviceID:   "0x1DB610DE",
+				MigDevices: []placements.MigDeviceSpec{},
+			},
+		},
+		Config: &ConfigStatus{
+			ConfigFile:     "config.yaml",
+			SelectedConfig: "all-1g.5gb",
+			Applied:        false,
+			Reason:         "not all GPUs match the specified config",
+		},
+	}
+
+	var b bytes.Buffer
+	require.Nil(t, WriteStatus(&b, status, TableFormat))
+	require.Equal(t, `GPU 0: A100-SXM4-40GB (0x20B010DE)
+  PCI address       0000:3b:00.0
+  UUID              GPU-0
+  MIG capable       true
+  MIG mode          Enabled
+  Pending MIG mode  Enabled
+  MIG devices:
+    PROFILE  PLACEMENT  GPU INSTANCE  COMPUTE INSTANCE  UUID
+    3g.20gb  0:4        1             0                 MIG-0
+    1g.5gb   4:1        9             0                 MIG-1
+
+GPU 1: 0x20B010DE
+  PCI address       0000:86:00.0
+  MIG capable       true
+  MIG mode          Disabled
+  Pending MIG mode  Enabled
+  MIG devices       unknown (NVIDIA driver not loaded)
+
+GPU 2: 0x1DB610DE
+  PCI address  0000:af:00.0
+  MIG capable  false
+
+Selected MIG configuration 'all-1g.5gb' from config.yaml not currently applied: not all GPUs match the specified config
+`, b.String())
+
+	b.Reset()
+	require.Nil(t, WriteStatus(&b, status, JSONFormat))
+	var parsed Status
+	require.Nil(t, json.Unmarshal(b.Bytes(), &parsed))
+	require.Equal(t, status.Config, parsed.Config)
+	require.Equal(t, status.GPUs[0], parsed.GPUs[0])
+	require.Contains(t, b.String(), `"pending-mig-mode": "Enabled"`)
+
+	b.Reset()
+	status.GPUs = nil
+	status.Config.Unknown = true
+	status.Config.Reason = "nvidia module must be loaded in order to query MIG device state"
+	require.Nil(t, WriteStatus(&b, status, TableFormat))
+	require.Equal(t, "\nUnable to tell if selected MIG configuration 'all-1g.5gb' from config.yaml is currently applied: nvidia module must be loaded in order to query MIG device state\n", b.String())
+
+	require.NotNil(t, WriteStatus(&b, status, "yaml"))
+}
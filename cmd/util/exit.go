@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"errors"
+
+	"github.com/NVIDIA/mig-parted/pkg/types"
+)
+
+// Exit codes returned by nvidia-mig-parted. Any error not carrying a more
+// specific category results in ExitCodeError.
+const (
+	ExitCodeSuccess         = 0
+	ExitCodeError           = 1
+	ExitCodeInvalidConfig   = 2
+	ExitCodeNotMigCapable   = 3
+	ExitCodeMigModeDisabled = 4
+	ExitCodeInUse           = 5
+	ExitCodeRebootRequired  = 6
+	ExitCodeDriverNotLoaded = 7
+	ExitCodePermission      = 8
+	ExitCodeTimeout         = 9
+	ExitCodeCanceled        = 10
+	ExitCodeNotBooted       = 11
+	ExitCodeMigModeEnabled  = 12
+	ExitCodeResetRequired   = 13
+)
+
+var exitCodes = map[types.ErrorCategory]int{
+	types.ErrorCategoryInvalidConfig:   ExitCodeInvalidConfig,
+	types.ErrorCategoryNotMigCapable:   ExitCodeNotMigCapable,
+	types.ErrorCategoryMigModeDisabled: ExitCodeMigModeDisabled,
+	types.ErrorCategoryInUse:           ExitCodeInUse,
+	types.ErrorCategoryRebootRequired:  ExitCodeRebootRequired,
+	types.ErrorCategoryDriverNotLoaded: ExitCodeDriverNotLoaded,
+	types.ErrorCategoryPermission:      ExitCodePermission,
+	types.ErrorCategoryTimeout:         ExitCodeTimeout,
+	types.ErrorCategoryCanceled:        ExitCodeCanceled,
+	types.ErrorCategoryNotBooted:       ExitCodeNotBooted,
+	types.ErrorCategoryMigModeEnabled:  ExitCodeMigModeEnabled,
+	types.ErrorCategoryResetRequired:   ExitCodeResetRequired,
+}
+
+// ExitCode maps an error to the exit code nvidia-mig-parted should return for
+// it, based on the category of the first *types.Error in its chain.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitCodeSuccess
+	}
+	var typed *types.Error
+	if !errors.As(err, &typed) {
+		return ExitCodeError
+	}
+	if code, exists := exitCodes[typed.Category]; exists {
+		return code
+	}
+	return ExitCodeError
+}
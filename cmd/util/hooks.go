@@ -0,0 +1,356 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	hooks "github.com/NVIDIA/mig-parted/api/hooks/v1"
+	"github.com/NVIDIA/mig-parted/pkg/metrics"
+	migapply "github.com/NVIDIA/mig-parted/pkg/mig/apply"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Names of the hooks that can be set in a hooks file.
+const (
+	ApplyStartHook      = "apply-start"
+	PreApplyModeHook    = "pre-apply-mode"
+	PostApplyModeHook   = "post-apply-mode"
+	PreApplyConfigHook  = "pre-apply-config"
+	PostApplyConfigHook = "post-apply-config"
+	PreGPUHook          = "pre-gpu"
+	PostGPUHook         = "post-gpu"
+	OnFailureHook       = "on-failure"
+	ApplyExitHook       = "apply-exit"
+)
+
+// HookNames are the names of all hooks that can be set in a hooks file.
+var HookNames = []string{
+	ApplyStartHook,
+	PreApplyModeHook,
+	PostApplyModeHook,
+	PreApplyConfigHook,
+	PostApplyConfigHook,
+	PreGPUHook,
+	PostGPUHook,
+	OnFailureHook,
+	ApplyExitHook,
+}
+
+// Environment variables describing the hook being run, set in addition to
+// those of the flags of the command.
+const (
+	HookNameEnv     = "MIG_PARTED_HOOK"
+	HookOutcomeEnv  = "MIG_PARTED_HOOK_OUTCOME"
+	HookErrorEnv    = "MIG_PARTED_HOOK_ERROR"
+	HookGPUsEnv     = "MIG_PARTED_HOOK_GPUS"
+	HookGPUUUIDsEnv = "MIG_PARTED_HOOK_GPU_UUIDS"
+
+	HookPlanEnv                 = "MIG_PARTED_HOOK_PLAN"
+	HookMigModeChangeGPUsEnv    = "MIG_PARTED_HOOK_MIG_MODE_CHANGE_GPUS"
+	HookMigDevicesChangeGPUsEnv = "MIG_PARTED_HOOK_MIG_DEVICES_CHANGE_GPUS"
+	HookExportFileEnv           = "MIG_PARTED_HOOK_EXPORT_FILE"
+)
+
+// Hooks runs the hooks from a hooks file with the flags of the command being
+// run as their environment, each bounded by Timeout (0 for no limit). Every
+// hook command or webhook run is logged and recorded in Executions, and the
+// time taken by each hook in Metrics, if set. The path of ExportFile, if set,
+// is passed to hooks as well.
+type Hooks struct {
+	hooks.HooksMap
+	Context    *cli.Context
+	Timeout    time.Duration
+	ExportFile string
+	Executions []hooks.Execution
+	Metrics    *metrics.Metrics
+}
+
+var _ migapply.Hooks = (*Hooks)(nil)
+
+// NewHooks parses the hooks file at path, if any, and returns the Hooks to run
+// from it for the command of c.
+func NewHooks(c *cli.Context, path string, timeout time.Duration) (*Hooks, error) {
+	spec := &hooks.Spec{}
+	if path != "" {
+		var err error
+		spec, err = ParseHooksFile(path)
+		if err != nil {
+			return nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "error parsing hooks file: %v", err)
+		}
+	}
+	return &Hooks{HooksMap: spec.Hooks, Context: c, Timeout: timeout}, nil
+}
+
+// ParseHooksFile reads the hooks file at path, rejecting unknown fields and
+// hooks as well as invalid values.
+func ParseHooksFile(path string) (*hooks.Spec, error) {
+	hooksYaml, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read error: %w", err)
+	}
+
+	var spec hooks.Spec
+	err = yaml.UnmarshalStrict(hooksYaml, &spec)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	err = spec.AssertValid(HookNames)
+	if err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
+
+	return &spec, nil
+}
+
+// HooksEnvsMap returns the values of the flags of the command of c, keyed by
+// their environment variables.
+func HooksEnvsMap(c *cli.Context) hooks.EnvsMap {
+	envs := make(hooks.EnvsMap)
+	for _, flag := range c.Command.Flags {
+		fv := reflect.ValueOf(flag)
+		for fv.Kind() == reflect.Ptr {
+			fv = reflect.Indirect(fv)
+		}
+
+		value := fv.FieldByName("Destination")
+		for value.Kind() == reflect.Ptr {
+			value = reflect.Indirect(value)
+		}
+
+		for _, name := range fv.FieldByName("EnvVars").Interface().([]string) {
+			envs[name] = fmt.Sprintf("%v", value)
+		}
+	}
+	return envs
+}
+
+func (h *Hooks) ApplyStart(ctx context.Context, status *migapply.HookStatus) error {
+	return h.run(ctx, ApplyStartHook, status)
+}
+
+func (h *Hooks) PreApplyMode(ctx context.Context, status *migapply.HookStatus) error {
+	return h.run(ctx, PreApplyModeHook, status)
+}
+
+func (h *Hooks) PostApplyMode(ctx context.Context, status *migapply.HookStatus) error {
+	return h.run(ctx, PostApplyModeHook, status)
+}
+
+func (h *Hooks) PreApplyConfig(ctx context.Context, status *migapply.HookStatus) error {
+	return h.run(ctx, PreApplyConfigHook, status)
+}
+
+func (h *Hooks) PostApplyConfig(ctx context.Context, status *migapply.HookStatus) error {
+	return h.run(ctx, PostApplyConfigHook, status)
+}
+
+func (h *Hooks) PreGPU(ctx context.Context, status *migapply.HookStatus) error {
+	return h.run(ctx, PreGPUHook, status)
+}
+
+func (h *Hooks) PostGPU(ctx context.Context, status *migapply.HookStatus) error {
+	return h.run(ctx, PostGPUHook, status)
+}
+
+// Empty returns whether no hooks are configured.
+func (h *Hooks) Empty() bool {
+	return len(h.HooksMap) == 0
+}
+
+func (h *Hooks) OnFailure(ctx context.Context, status *migapply.HookStatus) error {
+	return h.run(ctx, OnFailureHook, status)
+}
+
+func (h *Hooks) ApplyExit(ctx context.Context, status *migapply.HookStatus) error {
+	return h.run(ctx, ApplyExitHook, status)
+}
+
+func (h *Hooks) run(ctx context.Context, name string, status *migapply.HookStatus) error {
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+	envs := HooksEnvsMap(h.Context).Combine(HookStatusEnvsMap(name, status))
+	envs[HookExportFileEnv] = h.ExportFile
+	payload := HookStatusPayload(h.Context.String("selected-config"), status)
+	start := time.Now()
+	executions, err := h.Run(ctx, name, envs, payload, h.Context.Bool("debug"))
+	if len(executions) > 0 {
+		h.Metrics.ObserveHook(name, time.Since(start))
+	}
+	for _, execution := range executions {
+		logExecution(execution)
+	}
+	h.Executions = append(h.Executions, executions...)
+	return err
+}
+
+// logExecution logs the outcome of a hook command or webhook, and its output.
+func logExecution(execution hooks.Execution) {
+	kind := "command"
+	entry := log.WithFields(log.Fields{
+		"hook":     execution.Hook,
+		"attempt":  execution.Attempt,
+		"duration": execution.Duration.Duration,
+	})
+	if execution.URL != "" {
+		kind = "webhook"
+		entry = entry.WithFields(log.Fields{
+			"url":        execution.URL,
+			"statusCode": execution.StatusCode,
+		})
+	} else {
+		entry = entry.WithFields(log.Fields{
+			"command":  strings.Join(append([]string{execution.Command}, execution.Args...), " "),
+			"exitCode": execution.ExitCode,
+		})
+	}
+	if execution.Output != "" {
+		entry = entry.WithField("output", execution.Output)
+	}
+	if execution.Error != "" {
+		entry.WithField("error", execution.Error).Warnf("Hook %v failed", kind)
+		return
+	}
+	entry.Infof("Hook %v succeeded", kind)
+}
+
+// WriteReport writes the record of all hooks run to path as JSON.
+func (h *Hooks) WriteReport(path string) error {
+	report := hooks.Report{
+		Version:    hooks.Version,
+		Executions: h.Executions,
+	}
+	if report.Executions == nil {
+		report.Executions = []hooks.Execution{}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling hooks report: %w", err)
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// HookStatusEnvsMap returns the environment variables describing the status
+// passed to the hook name.
+func HookStatusEnvsMap(name string, status *migapply.HookStatus) hooks.EnvsMap {
+	envs := hooks.EnvsMap{
+		HookNameEnv:                 name,
+		HookOutcomeEnv:              string(status.Outcome),
+		HookErrorEnv:                "",
+		HookGPUsEnv:                 joinGPUs(status.GPUs),
+		HookGPUUUIDsEnv:             strings.Join(status.UUIDs, ","),
+		HookPlanEnv:                 "",
+		HookMigModeChangeGPUsEnv:    "",
+		HookMigDevicesChangeGPUsEnv: "",
+	}
+	if status.Err != nil {
+		envs[HookErrorEnv] = status.Err.Error()
+	}
+	if status.Plan != nil {
+		plan, err := json.Marshal(HookPlan(status.Plan))
+		if err != nil {
+			log.Warnf("Error marshaling plan for hooks: %v", err)
+		}
+		envs[HookPlanEnv] = string(plan)
+		envs[HookMigModeChangeGPUsEnv] = joinGPUs(status.Plan.MigModeChanges())
+		envs[HookMigDevicesChangeGPUsEnv] = joinGPUs(status.Plan.MigDevicesChanges())
+	}
+	return envs
+}
+
+// HookPlan returns the plan passed to hooks for plan.
+func HookPlan(plan *migapply.Plan) *hooks.Plan {
+	p := &hooks.Plan{
+		GPUs: []hooks.GPUPlan{},
+	}
+	for _, gpu := range plan.GPUs {
+		p.GPUs = append(p.GPUs, hooks.GPUPlan{
+			Index:             gpu.GPU,
+			DeviceID:          gpu.DeviceID.String(),
+			MigCapable:        gpu.MigCapable,
+			CurrentMigEnabled: gpu.CurrentMigEnabled,
+			MigEnabled:        gpu.MigEnabled,
+			CurrentMigDevices: gpu.CurrentMigDevices,
+			MigDevices:        gpu.MigDevices,
+			MigModeChange:     gpu.MigModeChange,
+			MigDevicesChange:  gpu.MigDevicesChange,
+		})
+	}
+	return p
+}
+
+// joinGPUs returns the comma separated indices of gpus.
+func joinGPUs(gpus []int) string {
+	var indices []string
+	for _, gpu := range gpus {
+		indices = append(indices, strconv.Itoa(gpu))
+	}
+	return strings.Join(indices, ",")
+}
+
+// HookStatusPayload returns the payload describing the status passed to a
+// hook, for webhooks. The hook name and envs are filled in when it is sent.
+func HookStatusPayload(selectedConfig string, status *migapply.HookStatus) *hooks.WebhookPayload {
+	payload := &hooks.WebhookPayload{
+		SelectedConfig: selectedConfig,
+		Outcome:        string(status.Outcome),
+		GPUs:           []hooks.GPUState{},
+	}
+	if status.Err != nil {
+		payload.Error = status.Err.Error()
+	}
+	if status.Plan != nil {
+		payload.Plan = HookPlan(status.Plan)
+	}
+
+	for i, gpu := range status.GPUs {
+		state := hooks.GPUState{Index: gpu}
+		if i < len(status.UUIDs) {
+			state.UUID = status.UUIDs[i]
+		}
+		for _, result := range status.Results {
+			if result.GPU != gpu {
+				continue
+			}
+			state.MigCapable = result.MigCapable
+			state.MigModeChanged = result.MigModeChanged
+			state.MigModeChangePending = result.MigModeChangePending
+			state.Reset = result.Reset
+			state.RebootRequired = result.RebootRequired
+			state.MigDevicesChanged = result.MigDevicesChanged
+		}
+		payload.GPUs = append(payload.GPUs, state)
+	}
+
+	return payload
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	hooks "github.com/NVIDIA/mig-parted/api/hooks/v1"
+	"github.com/NVIDIA/mig-parted/pkg/metrics"
+	migapply "github.com/NVIDIA/mig-parted/pkg/mig/apply"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+	cli "github.com/urfave/cli/v2"
+)
+
+func TestHooksStatusEnvs(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "envs")
+	h := &Hooks{
+		HooksMap: hooks.HooksMap{
+			PostGPUHook: []hooks.HookSpec{
+				{
+					Command: "sh",
+					Args:    []string{"-c", `echo "$MIG_PARTED_HOOK;$MIG_PARTED_HOOK_OUTCOME;$MIG_PARTED_HOOK_ERROR;$MIG_PARTED_HOOK_GPUS;$MIG_PARTED_HOOK_GPU_UUIDS" > ` + out},
+				},
+			},
+		},
+		Context: cli.NewContext(cli.NewApp(), flag.NewFlagSet("test", flag.ContinueOnError), nil),
+		Metrics: metrics.New(),
+	}
+	h.Context.Command = &cli.Command{}
+
+	status := &migapply.HookStatus{
+		Outcome: migapply.HookOutcomeFailure,
+		Err:     errors.New("something failed"),
+		GPUs:    []int{0, 3},
+		UUIDs:   []string{"GPU-a", "GPU-b"},
+	}
+	err := h.PostGPU(context.Background(), status)
+	require.Nil(t, err, "Unexpected failure running hook")
+
+	contents, err := ioutil.ReadFile(out)
+	require.Nil(t, err)
+	require.Equal(t, "post-gpu;failure;something failed;0,3;GPU-a,GPU-b\n", string(contents))
+
+	err = h.PreGPU(context.Background(), status)
+	require.Nil(t, err, "Unexpected failure running unset hook")
+
+	report := filepath.Join(t.TempDir(), "report.json")
+	err = h.WriteReport(report)
+	require.Nil(t, err, "Unexpected failure writing hooks report")
+
+	contents, err = ioutil.ReadFile(report)
+	require.Nil(t, err)
+	var parsed hooks.Report
+	err = json.Unmarshal(contents, &parsed)
+	require.Nil(t, err, "Unexpected failure parsing hooks report")
+	require.Equal(t, hooks.Version, parsed.Version)
+	require.Len(t, parsed.Executions, 1)
+	require.Equal(t, PostGPUHook, parsed.Executions[0].Hook)
+	require.Equal(t, "sh", parsed.Executions[0].Command)
+	require.Equal(t, 0, parsed.Executions[0].ExitCode)
+
+	var b bytes.Buffer
+	require.Nil(t, h.Metrics.Write(&b))
+	require.Contains(t, b.String(), `mig_parted_hook_duration_seconds_count{hook="post-gpu"} 1`)
+	require.NotContains(t, b.String(), `hook="pre-gpu"`)
+}
+
+func TestHookStatusPayload(t *testing.T) {
+	status := &migapply.HookStatus{
+		Outcome: migapply.HookOutcomeSuccess,
+		GPUs:    []int{0, 3},
+		UUIDs:   []string{"GPU-a", "GPU-b"},
+		Results: []migapply.GPUResult{
+			{GPU: 3, MigCapable: true, MigModeChanged: true, Reset: true},
+		},
+	}
+
+	payload := HookStatusPayload("all-1g.5gb", status)
+	require.Equal(t, &hooks.WebhookPayload{
+		SelectedConfig: "all-1g.5gb",
+		Outcome:        "success",
+		GPUs: []hooks.GPUState{
+			{Index: 0, UUID: "GPU-a"},
+			{Index: 3, UUID: "GPU-b", MigCapable: true, MigModeChanged: true, Reset: true},
+		},
+	}, payload)
+}
+
+func TestHookStatusPlanEnvs(t *testing.T) {
+	status := &migapply.HookStatus{
+		GPUs: []int{0, 1},
+		Plan: &migapply.Plan{
+			GPUs: []migapply.GPUPlan{
+				{GPU: 0, MigCapable: true, MigEnabled: true, MigDevices: types.MigConfig{"1g.5gb": 7}, MigModeChange: true, MigDevicesChange: true},
+				{GPU: 1, MigCapable: true, CurrentMigEnabled: true, MigEnabled: true, MigDevices: types.MigConfig{"1g.5gb": 7}, MigDevicesChange: true},
+				{GPU: 2, MigCapable: true, CurrentMigEnabled: true, MigModeChange: true},
+			},
+		},
+	}
+
+	envs := HookStatusEnvsMap(PreApplyModeHook, status)
+	require.Equal(t, "0,2", envs[HookMigModeChangeGPUsEnv])
+	require.Equal(t, "0,1", envs[HookMigDevicesChangeGPUsEnv])
+
+	var plan hooks.Plan
+	err := json.Unmarshal([]byte(envs[HookPlanEnv]), &plan)
+	require.Nil(t, err, "Unexpected failure parsing plan")
+	require.Equal(t, HookPlan(status.Plan), &plan)
+	require.Len(t, plan.GPUs, 3)
+	require.True(t, plan.GPUs[1].CurrentMigEnabled)
+
+	envs = HookStatusEnvsMap(PreApplyModeHook, &migapply.HookStatus{})
+	require.Empty(t, envs[HookPlanEnv])
+	require.Empty(t, envs[HookMigModeChangeGPUsEnv])
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	cli "github.com/urfave/cli/v2"
+)
+
+const (
+	// DefaultLockFile is the file locked while changing the MIG configuration
+	// of the node, so that concurrent invocations don't interleave.
+	DefaultLockFile = "/run/nvidia-mig-parted.lock"
+
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// Lock takes an exclusive lock on the file at path, creating it if needed,
+// and returns the function releasing it. If another process holds the lock,
+// Lock waits for it until timeout (0 for no limit) or until ctx is canceled.
+// An empty path disables locking.
+func Lock(ctx context.Context, path string, timeout time.Duration) (func(), error) {
+	if path == "" {
+		return func() {}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+	unlock := func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return unlock, nil
+		}
+		if err != syscall.EWOULDBLOCK {
+			file.Close()
+			return nil, fmt.Errorf("error locking %v: %w", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, types.NewContextError(-1, ctx.Err())
+		case <-expired:
+			file.Close()
+			return nil, types.NewError(types.ErrorCategoryTimeout, -1, "timed out after %v waiting for lock on %v held by another process", timeout, path)
+		case <-ticker.C:
+		}
+	}
+}
+
+// LockNode takes the lock set by the global flags of nvidia-mig-parted.
+func LockNode(c *cli.Context) (func(), error) {
+	return Lock(c.Context, c.String("lock-file"), c.Duration("lock-timeout"))
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nvidia-mig-parted.lock")
+
+	unlock, err := Lock(context.Background(), path, 0)
+	require.Nil(t, err, "Unexpected failure taking lock")
+
+	_, err = Lock(context.Background(), path, 200*time.Millisecond)
+	require.True(t, errors.Is(err, types.ErrTimeout), "Unexpected error taking held lock: %v", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Lock(ctx, path, 0)
+	require.True(t, errors.Is(err, types.ErrCanceled), "Unexpected error taking held lock: %v", err)
+
+	unlock()
+
+	unlock, err = Lock(context.Background(), path, 200*time.Millisecond)
+	require.Nil(t, err, "Unexpected failure taking released lock")
+	unlock()
+
+	unlock, err = Lock(context.Background(), "", 0)
+	require.Nil(t, err, "Unexpected failure with locking disabled")
+	unlock()
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+
+	"github.com/NVIDIA/mig-parted/pkg/metrics"
+	log "github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+)
+
+// UpdateMetricsTextfile records the outcome err of applying a MIG config in
+// m, adds the counters and histograms already in the textfile at path to it,
+// and writes it back to path along with the current state of the GPUs.
+// Failures are only logged, as they must not change the outcome of applying.
+func UpdateMetricsTextfile(c *cli.Context, path string, m *metrics.Metrics, err error) {
+	m.ObserveApply(err)
+
+	// The textfile is read and written back by every invocation, so they
+	// must not interleave. The context of c is not used, as it is canceled
+	// when stopping on a signal, which must still be recorded.
+	unlock, lockErr := Lock(context.Background(), path+".lock", c.Duration("lock-timeout"))
+	if lockErr != nil {
+		log.Errorf("Error locking metrics textfile: %v", lockErr)
+		return
+	}
+	defer unlock()
+
+	readErr := m.ReadTextfile(path)
+	if readErr != nil {
+		log.Warnf("Discarding previous metrics: %v", readErr)
+	}
+
+	all, _, enumErr := NewGPUEnumerators(c.String("sysfs-root"), "")
+	if enumErr == nil {
+		manager := NewCombinedMigManager(all, PciMigModeOptions(c)...)
+		states, collectErr := metrics.CollectGPUStates(context.Background(), all, manager)
+		if collectErr != nil {
+			log.Warnf("Unable to collect the MIG state of GPUs for metrics: %v", collectErr)
+		}
+		m.SetGPUStates(states)
+	}
+
+	writeErr := m.WriteTextfile(path)
+	if writeErr != nil {
+		log.Errorf("Error writing metrics textfile: %v", writeErr)
+	}
+}
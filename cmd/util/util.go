@@ -19,11 +19,13 @@ package util
 import (
 	"fmt"
 	"io/ioutil"
-	"os/exec"
 	"strings"
 
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
 	"github.com/NVIDIA/mig-parted/pkg/mig/config"
 	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	cli "github.com/urfave/cli/v2"
 )
 
 type CombinedMigManager interface {
@@ -31,42 +33,65 @@ type CombinedMigManager interface {
 	config.Manager
 }
 
-func NewCombinedMigManager() CombinedMigManager {
+func NewCombinedMigManager(gpus enumerator.Interface, opts ...mode.PciOption) CombinedMigManager {
 	type modeManager = mode.Manager
 	type configManager = config.Manager
 	return &struct {
 		modeManager
 		configManager
-	}{mode.NewPciMigModeManager(), config.NewNvmlMigConfigManager()}
+	}{mode.NewPciMigModeManagerWith(gpus, opts...), config.NewNvmlMigConfigManager()}
 }
 
-func Any(set []bool) bool {
-	for _, s := range set {
-		if s {
-			return true
-		}
+// PciMigModeOptions returns the options of the PCI MIG mode manager set by the
+// global flags of nvidia-mig-parted.
+func PciMigModeOptions(c *cli.Context) []mode.PciOption {
+	return []mode.PciOption{
+		mode.WithBootTimeout(c.Duration("boot-timeout")),
+		mode.WithBootPollInterval(c.Duration("boot-poll-interval")),
 	}
-	return false
 }
 
-func CountTrue(set []bool) int {
-	count := 0
-	for _, s := range set {
-		if s {
-			count++
-		}
+// NewMigModeManager returns the MIG mode manager for the GPUs of all: one
+// going through NVML if the NVIDIA kernel module is loaded, and one accessing
+// the GPUs over PCI otherwise.
+func NewMigModeManager(c *cli.Context, all enumerator.Interface, nvidiaModuleLoaded bool) mode.Manager {
+	if nvidiaModuleLoaded {
+		return mode.NewNvmlMigModeManager()
 	}
-	return count
+	return mode.NewPciMigModeManagerWith(all, PciMigModeOptions(c)...)
+}
+
+// NewGPUEnumerators returns an enumerator for all GPUs of the node, and one
+// for the subset of them selected by the comma separated list of indices in
+// selected (all GPUs if empty). GPUs are read from the sysfs PCI devices
+// directory at sysfsRoot, or the default one if empty.
+func NewGPUEnumerators(sysfsRoot string, selected string) (enumerator.Interface, enumerator.Interface, error) {
+	indices, err := enumerator.ParseIndices(selected)
+	if err != nil {
+		return nil, nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "error parsing GPU indices: %v", err)
+	}
+
+	all := enumerator.New()
+	if sysfsRoot != "" {
+		all = enumerator.NewSysfs(sysfsRoot)
+	}
+
+	return all, enumerator.NewFiltered(all, indices), nil
 }
 
 func Capitalize(s string) string {
 	return strings.ToUpper(s[0:1]) + s[1:]
 }
 
+// ProcModules is the file listing the loaded kernel modules. It is only
+// changed by tests, to run commands as if the NVIDIA kernel module was (or
+// wasn't) loaded.
+var ProcModules = "/proc/modules"
+
 func IsNvidiaModuleLoaded() (bool, error) {
-	modules, err := ioutil.ReadFile("/proc/modules")
+	modules, err := ioutil.ReadFile(ProcModules)
 	if err != nil {
-		return false, fmt.Errorf("unable to read /proc/modules: %v", err)
+		return false, fmt.Errorf("unable to read %v: %v", ProcModules, err)
 	}
 	for _, line := range strings.Split(strings.TrimSpace(string(modules)), "\n") {
 		fields := strings.Fields(line)
@@ -76,14 +101,3 @@ func IsNvidiaModuleLoaded() (bool, error) {
 	}
 	return false, nil
 }
-
-func NvidiaSmiReset(gpus ...string) (string, error) {
-	var cmd *exec.Cmd
-	if len(gpus) == 0 {
-		return "", fmt.Errorf("no gpus specified")
-	} else {
-		cmd = exec.Command("nvidia-smi", "-r", "-i", strings.Join(gpus, ","))
-	}
-	output, err := cmd.CombinedOutput()
-	return string(output), err
-}
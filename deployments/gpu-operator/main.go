@@ -17,11 +17,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/exec"
 	"sync"
+	"time"
 
+	"github.com/NVIDIA/mig-parted/cmd/util"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/metrics"
 	log "github.com/sirupsen/logrus"
 	cli "github.com/urfave/cli/v2"
 
@@ -38,6 +44,15 @@ const (
 
 	DefaultReconfigureScript = "/usr/bin/reconfigure-mig.sh"
 	DefaultHostRootMount     = "/host"
+	DefaultMetricsTextfile   = "/run/nvidia-mig-manager/metrics.prom"
+
+	// MetricsTextfileEnv sets the metrics textfile nvidia-mig-parted writes
+	// to when run by the reconfigure script.
+	MetricsTextfileEnv = "MIG_PARTED_METRICS_TEXTFILE"
+
+	// MetricsLockTimeout bounds how long collecting the state of the GPUs
+	// for metrics waits for another nvidia-mig-parted invocation changing it.
+	MetricsLockTimeout = time.Minute
 )
 
 var (
@@ -47,6 +62,10 @@ var (
 	reconfigureScriptFlag string
 	withRebootFlag        bool
 	hostRootMountFlag     string
+	metricsAddressFlag    string
+	metricsTextfileFlag   string
+
+	cachedGPUStates GPUStates
 )
 
 type SyncableMigConfig struct {
@@ -81,6 +100,43 @@ func (m *SyncableMigConfig) Get() string {
 	return m.lastRead
 }
 
+// GPUStates caches the MIG state of the GPUs of the node, so that serving
+// metrics doesn't query the GPUs on every scrape.
+type GPUStates struct {
+	mutex  sync.Mutex
+	states []metrics.GPUState
+}
+
+// Update collects the MIG state of the GPUs while holding the lock
+// nvidia-mig-parted takes when changing it. The previous state is kept if the
+// lock can't be taken.
+func (s *GPUStates) Update() {
+	unlock, err := util.Lock(context.Background(), util.DefaultLockFile, MetricsLockTimeout)
+	if err != nil {
+		log.Warnf("Unable to lock the node to collect the MIG state of GPUs: %s", err)
+		return
+	}
+	defer unlock()
+
+	gpus := enumerator.New()
+	manager := util.NewCombinedMigManager(gpus)
+	states, err := metrics.CollectGPUStates(context.Background(), gpus, manager)
+	if err != nil {
+		log.Warnf("Error collecting the MIG state of GPUs: %s", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.states = states
+}
+
+// Get returns the MIG state of the GPUs as of the last call to Update.
+func (s *GPUStates) Get() []metrics.GPUState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.states
+}
+
 func main() {
 	c := cli.NewApp()
 	c.Before = validateFlags
@@ -134,6 +190,20 @@ func main() {
 			Destination: &withRebootFlag,
 			EnvVars:     []string{"WITH_REBOOT"},
 		},
+		&cli.StringFlag{
+			Name:        "metrics-address",
+			Value:       "",
+			Usage:       "address to serve metrics on at /metrics, e.g. ':9101' (disabled if empty)",
+			Destination: &metricsAddressFlag,
+			EnvVars:     []string{"METRICS_ADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:        "metrics-textfile",
+			Value:       DefaultMetricsTextfile,
+			Usage:       "file nvidia-mig-parted writes the metrics of each reconfiguration to, served along with the current state of the GPUs",
+			Destination: &metricsTextfileFlag,
+			EnvVars:     []string{"METRICS_TEXTFILE"},
+		},
 	}
 
 	err := c.Run(os.Args)
@@ -165,6 +235,11 @@ func start(c *cli.Context) error {
 		return fmt.Errorf("error building kubernetes clientset from config: %s", err)
 	}
 
+	if metricsAddressFlag != "" {
+		cachedGPUStates.Update()
+		go serveMetrics()
+	}
+
 	migConfig := NewSyncableMigConfig()
 
 	stop := ContinuouslySyncMigConfigChanges(clientset, migConfig)
@@ -175,6 +250,9 @@ func start(c *cli.Context) error {
 		value := migConfig.Get()
 		log.Infof("Updating to MIG config: %s", value)
 		err := runScript(value)
+		if metricsAddressFlag != "" {
+			cachedGPUStates.Update()
+		}
 		if err != nil {
 			log.Errorf("Error: %s", err)
 			continue
@@ -193,11 +271,41 @@ func runScript(migConfigValue string) error {
 		args = append(args, "-r")
 	}
 	cmd := exec.Command(reconfigureScriptFlag, args...)
+	if metricsAddressFlag != "" {
+		cmd.Env = append(os.Environ(), MetricsTextfileEnv+"="+metricsTextfileFlag)
+	}
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
 
+func serveMetrics() {
+	log.Infof("Serving metrics on %s/metrics", metricsAddressFlag)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handleMetrics)
+	err := http.ListenAndServe(metricsAddressFlag, mux)
+	log.Errorf("Error serving metrics: %s", err)
+}
+
+// handleMetrics serves the counters and histograms written by
+// nvidia-mig-parted for the reconfigurations done so far, along with the
+// state of the GPUs collected at startup and after the last reconfiguration.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	m := metrics.New()
+
+	err := m.ReadTextfile(metricsTextfileFlag)
+	if err != nil {
+		log.Warnf("Error reading metrics of reconfigurations: %s", err)
+	}
+	m.SetGPUStates(cachedGPUStates.Get())
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	err = m.Write(w)
+	if err != nil {
+		log.Warnf("Error writing metrics: %s", err)
+	}
+}
+
 func ContinuouslySyncMigConfigChanges(clientset *kubernetes.Clientset, migConfig *SyncableMigConfig) chan struct{} {
 	listWatch := cache.NewListWatchFromClient(
 		clientset.CoreV1().RESTClient(),
@@ -8,6 +8,10 @@ MIG_CONFIG_FILE=""
 NDP_ORIGINAL_STATE="true"
 DCGM_ORIGINAL_STATE="true"
 
+# Exit code of nvidia-mig-parted when a MIG mode change only takes effect
+# after a reboot
+EXIT_CODE_REBOOT_REQUIRED="6"
+
 function usage() {
   echo "USAGE:"
   echo "    ${0} -h "
@@ -15,7 +19,7 @@ function usage() {
   echo ""
   echo "OPTIONS:"
   echo "    -h                   Display this help message"
-  echo "    -r                   Automatically reboot the node if changing the MIG mode fails for any reason"
+  echo "    -r                   Automatically reboot the node if changing the MIG mode requires it"
   echo "    -n <node>            The kubernetes node to change the MIG configuration on"
   echo "    -f <config>          The mig-parted configuration section"
   echo "    -m <host-root-mount> Target path where host root directory is mounted"
@@ -178,13 +182,14 @@ kubectl wait --for=delete pod \
 	-l app=nvidia-dcgm-exporter
 
 echo "Applying the MIG mode change from the selected config to the node"
-echo "If the -r option was passed, the node will be automatically rebooted if this is not successful"
+echo "If the -r option was passed, the node will be automatically rebooted if this requires a reboot"
 
 cat << EOF | nvidia-mig-parted -d apply --mode-only -f -
 ${MIG_CONFIG_FILE}
 EOF
 
-if [ "${?}" != "0" ] && [ "${WITH_REBOOT}" = "true" ]; then
+APPLY_MODE_EXIT_CODE="${?}"
+if [ "${APPLY_MODE_EXIT_CODE}" = "${EXIT_CODE_REBOOT_REQUIRED}" ] && [ "${WITH_REBOOT}" = "true" ]; then
 	echo "Changing the 'nvidia.com/mig.config.state' node label to 'rebooting'"
 	kubectl label --overwrite  \
 		node ${NODE_NAME} \
@@ -197,6 +202,14 @@ if [ "${?}" != "0" ] && [ "${WITH_REBOOT}" = "true" ]; then
 	chroot ${HOST_ROOT_MOUNT} reboot
 	exit 0
 fi
+if [ "${APPLY_MODE_EXIT_CODE}" = "${EXIT_CODE_REBOOT_REQUIRED}" ]; then
+	echo "A reboot is required for the MIG mode change to take effect"
+	exit_failed
+fi
+if [ "${APPLY_MODE_EXIT_CODE}" != "0" ]; then
+	echo "Unable to apply the MIG mode change"
+	exit_failed
+fi
 
 echo "Applying the selected MIG config to the node"
 
@@ -1,2 +1,3 @@
 export MIG_PARTED_CONFIG_FILE=/etc/nvidia-mig-manager/config.yaml
 export MIG_PARTED_HOOKS_FILE=/etc/nvidia-mig-manager/hooks.yaml
+export MIG_PARTED_REBOOT_REQUIRED_FILE=/var/lib/nvidia-mig-manager/reboot_required
@@ -20,9 +20,17 @@ source ${CURRDIR}/utils.sh
 
 : "${MIG_PARTED_CONFIG_FILE:=${CURRDIR}/config.yaml}"
 : "${MIG_PARTED_SELECTED_CONFIG:?Environment variable must be set before calling this script}"
+: "${MIG_PARTED_REBOOT_REQUIRED_FILE:=/var/lib/nvidia-mig-manager/reboot_required}"
 
 export MIG_PARTED_CONFIG_FILE
 export MIG_PARTED_SELECTED_CONFIG
+export MIG_PARTED_REBOOT_REQUIRED_FILE
+
+mkdir -p "$(dirname "${MIG_PARTED_REBOOT_REQUIRED_FILE}")"
+
+# Exit code of nvidia-mig-parted when a MIG mode change only takes effect
+# after a reboot
+EXIT_CODE_REBOOT_REQUIRED=6
 
 set -x
 
@@ -31,30 +39,24 @@ nvidia-mig-parted assert --mode-only
 
 # If it is not, then go through the process of applying it
 if [ "${?}" != 0 ]; then
-	# Apply MIG mode, without issuing a GPU reset
-	nvidia-mig-parted apply --mode-only --skip-reset
-	if [ "${?}" != 0 ]; then
-		(set +x; echo "Error applying MIG mode")
-		exit 1
-	fi
+	# Apply MIG mode and reset the GPUs whose MIG mode changed
+	nvidia-mig-parted apply --mode-only
+	exit_code="${?}"
 
-	# If GPU reset is not available (e.g. GPU passthrough virtualization),
-	# then issue a reboot. The reboot will only occur once. If the MIG mode is
-	# still not applied after reboot, this script will error out.
-	nvidia-mig-manager::service::assert_gpu_reset_available
-	if [ "${?}" != 0 ]; then
+	# If the MIG mode change did not take effect after the GPU reset (e.g.
+	# GPU passthrough virtualization), then issue a reboot. The reboot will
+	# only occur once. If the MIG mode is still not applied after reboot,
+	# this script will error out.
+	if [ "${exit_code}" == "${EXIT_CODE_REBOOT_REQUIRED}" ]; then
 		(set +x;
-		echo "GPU reset capabilities are not available"
+		echo "MIG mode change requires a reboot to take effect"
+		cat "${MIG_PARTED_REBOOT_REQUIRED_FILE}"
 		echo "Attempting reboot")
 		nvidia-mig-manager::service::reboot
 		exit "${?}"
 	fi
-
-	# Since the desired MIG mode is already applied, the
-	# following will just do a GPU reset under the hood
-	nvidia-mig-parted apply --mode-only
-	if [ "${?}" != 0 ]; then
-		(set +x; echo "Error issuing GPU reset")
+	if [ "${exit_code}" != 0 ]; then
+		(set +x; echo "Error applying MIG mode")
 		exit 1
 	fi
 fi
@@ -48,6 +48,15 @@ const (
 	ERROR_UNKNOWN                 = nvml.ERROR_UNKNOWN
 )
 
+const (
+	NVLINK_MAX_LINKS = nvml.NVLINK_MAX_LINKS
+)
+
+const (
+	FEATURE_DISABLED = EnableState(nvml.FEATURE_DISABLED)
+	FEATURE_ENABLED  = EnableState(nvml.FEATURE_ENABLED)
+)
+
 const (
 	DEVICE_MIG_ENABLE  = nvml.DEVICE_MIG_ENABLE
 	DEVICE_MIG_DISABLE = nvml.DEVICE_MIG_DISABLE
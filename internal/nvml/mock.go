@@ -16,6 +16,12 @@
 
 package nvml
 
+import (
+	"fmt"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
 type MockLunaServer struct {
 	Devices [8]Device
 }
@@ -24,8 +30,15 @@ type MockA100Device struct {
 	GpuInstances       map[*MockA100GpuInstance]struct{}
 	GpuInstanceCounter uint32
 	Uuid               string
+	Name               string
 	MaxMigDevices      int
 	InstanceId         int
+	ComputeInstanceId  int
+	ComputeProcesses   []ProcessInfo
+	PciBusId           string
+	NvLinkPeers        []string
+	Drained            bool
+	Removed            bool
 }
 type MockA100GpuInstance struct {
 	Info                   GpuInstanceInfo
@@ -34,6 +47,7 @@ type MockA100GpuInstance struct {
 }
 type MockA100ComputeInstance struct {
 	Info ComputeInstanceInfo
+	Uuid string
 }
 
 var _ Interface = (*MockLunaServer)(nil)
@@ -280,8 +294,18 @@ var MockA100MIGProfiles = struct {
 	},
 }
 
+// MockA100Placements are the placements GPU instances of each profile can be
+// created at on an A100, in the order they are tried.
+var MockA100Placements = map[int][]nvml.GpuInstancePlacement{
+	GPU_INSTANCE_PROFILE_1_SLICE: {{Start: 0, Size: 1}, {Start: 1, Size: 1}, {Start: 2, Size: 1}, {Start: 3, Size: 1}, {Start: 4, Size: 1}, {Start: 5, Size: 1}, {Start: 6, Size: 1}},
+	GPU_INSTANCE_PROFILE_2_SLICE: {{Start: 0, Size: 2}, {Start: 2, Size: 2}, {Start: 4, Size: 2}},
+	GPU_INSTANCE_PROFILE_3_SLICE: {{Start: 0, Size: 4}, {Start: 4, Size: 4}},
+	GPU_INSTANCE_PROFILE_4_SLICE: {{Start: 0, Size: 4}},
+	GPU_INSTANCE_PROFILE_7_SLICE: {{Start: 0, Size: 8}},
+}
+
 func NewMockNVMLOnLunaServer() Interface {
-	return &MockLunaServer{
+	server := &MockLunaServer{
 		Devices: [8]Device{
 			NewMockA100Device(),
 			NewMockA100Device(),
@@ -293,6 +317,11 @@ func NewMockNVMLOnLunaServer() Interface {
 			NewMockA100Device(),
 		},
 	}
+	for i, d := range server.Devices {
+		d.(*MockA100Device).PciBusId = fmt.Sprintf("00000000:%02X:00.0", i+1)
+		d.(*MockA100Device).Uuid = fmt.Sprintf("GPU-abcd-%d", i)
+	}
+	return server
 }
 
 func NewMockA100Device() Device {
@@ -300,6 +329,7 @@ func NewMockA100Device() Device {
 		GpuInstances:       make(map[*MockA100GpuInstance]struct{}),
 		GpuInstanceCounter: 0,
 		Uuid:               "GPU-abcd",
+		Name:               "A100-SXM4-40GB",
 		MaxMigDevices:      7,
 		InstanceId:         0,
 	}
@@ -342,6 +372,9 @@ func (d *MockA100Device) GetPciInfo() (PciInfo, Return) {
 	p := PciInfo{
 		PciDeviceId: 0x20B010DE,
 	}
+	for i := 0; i < len(d.PciBusId) && i < len(p.BusId)-1; i++ {
+		p.BusId[i] = int8(d.PciBusId[i])
+	}
 	return p, MockReturn(SUCCESS)
 }
 
@@ -367,10 +400,15 @@ func (d *MockA100Device) GetGpuInstanceProfileInfo(giProfileId int) (GpuInstance
 }
 
 func (d *MockA100Device) CreateGpuInstance(info *GpuInstanceProfileInfo) (GpuInstance, Return) {
+	placement, ret := d.freePlacement(int(info.Id))
+	if ret.Value() != SUCCESS {
+		return nil, ret
+	}
 	giInfo := GpuInstanceInfo{
 		Device:    d,
 		Id:        d.GpuInstanceCounter,
 		ProfileId: info.Id,
+		Placement: placement,
 	}
 	d.GpuInstanceCounter++
 	gi := NewMockA100GpuInstance(giInfo)
@@ -423,6 +461,7 @@ func (gi *MockA100GpuInstance) CreateComputeInstance(info *ComputeInstanceProfil
 	}
 	gi.ComputeInstanceCounter++
 	ci := NewMockA100ComputeInstance(ciInfo)
+	ci.(*MockA100ComputeInstance).Uuid = fmt.Sprintf("MIG-%s-%d-%d", gi.Info.Device.(*MockA100Device).Uuid, gi.Info.Id, ciInfo.Id)
 	gi.ComputeInstances[ci.(*MockA100ComputeInstance)] = struct{}{}
 	return ci, MockReturn(SUCCESS)
 }
@@ -1,35 +1,167 @@
 package nvml
 
-import "fmt"
+import (
+	"sort"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
 
 func (d *MockA100Device) GetMaxMigDeviceCount() (int, Return) {
 	return d.MaxMigDevices, MockReturn(SUCCESS)
 }
 
+// GetMigDeviceHandleByIndex returns a handle to the MIG device backed by the
+// compute instance at Index, with compute instances ordered by the IDs of
+// their GPU instance and then their own.
 func (d *MockA100Device) GetMigDeviceHandleByIndex(Index int) (Device, Return) {
-	if Index < d.MaxMigDevices {
-		migDevice := NewMockA100Device()
-		migDevice.(*MockA100Device).Uuid = fmt.Sprintf("MIG-abcd-%d", Index)
-		return migDevice, MockReturn(SUCCESS)
+	if Index < 0 || Index >= d.MaxMigDevices {
+		return nil, MockReturn(ERROR_INVALID_ARGUMENT)
+	}
+	cis := d.computeInstances()
+	if Index >= len(cis) {
+		return nil, MockReturn(ERROR_NOT_FOUND)
+	}
+	ci := cis[Index]
+	migDevice := &MockA100Device{
+		MigMode:           d.MigMode,
+		Uuid:              ci.Uuid,
+		InstanceId:        int(ci.Info.GpuInstance.(*MockA100GpuInstance).Info.Id),
+		ComputeInstanceId: int(ci.Info.Id),
+		PciBusId:          d.PciBusId,
+	}
+	return migDevice, MockReturn(SUCCESS)
+}
+
+// computeInstances returns all compute instances of the device, ordered by the
+// IDs of their GPU instance and then their own.
+func (d *MockA100Device) computeInstances() []*MockA100ComputeInstance {
+	var cis []*MockA100ComputeInstance
+	for gi := range d.GpuInstances {
+		for ci := range gi.ComputeInstances {
+			cis = append(cis, ci)
+		}
 	}
-	return nil, MockReturn(ERROR_INVALID_ARGUMENT)
+	sort.Slice(cis, func(i, j int) bool {
+		gi := cis[i].Info.GpuInstance.(*MockA100GpuInstance).Info.Id
+		gj := cis[j].Info.GpuInstance.(*MockA100GpuInstance).Info.Id
+		if gi != gj {
+			return gi < gj
+		}
+		return cis[i].Info.Id < cis[j].Info.Id
+	})
+	return cis
+}
+
+// freePlacement returns the first placement a GPU instance of the given
+// profile can be created at without overlapping existing GPU instances.
+func (d *MockA100Device) freePlacement(giProfileId int) (nvml.GpuInstancePlacement, Return) {
+	placements, exists := MockA100Placements[giProfileId]
+	if !exists {
+		return nvml.GpuInstancePlacement{}, MockReturn(ERROR_NOT_SUPPORTED)
+	}
+OUTER:
+	for _, p := range placements {
+		for gi := range d.GpuInstances {
+			q := gi.Info.Placement
+			if p.Start < q.Start+q.Size && q.Start < p.Start+p.Size {
+				continue OUTER
+			}
+		}
+		return p, MockReturn(SUCCESS)
+	}
+	return nvml.GpuInstancePlacement{}, MockReturn(ERROR_INSUFFICIENT_RESOURCES)
 }
 
 func (d *MockA100Device) GetUUID() (string, Return) {
 	return d.Uuid, MockReturn(SUCCESS)
 }
 
+func (d *MockA100Device) GetName() (string, Return) {
+	return d.Name, MockReturn(SUCCESS)
+}
+
 func (d *MockA100Device) GetGpuInstanceId() (int, Return) {
 	return d.InstanceId, MockReturn(SUCCESS)
 }
 
 func (d *MockA100Device) GetGpuInstanceById(Id int) (GpuInstance, Return) {
-	if len(d.GpuInstances) == 0 {
-		return nil, MockReturn(ERROR_NOT_FOUND)
+	for gi := range d.GpuInstances {
+		if int(gi.Info.Id) == Id {
+			return gi, MockReturn(SUCCESS)
+		}
+	}
+	return nil, MockReturn(ERROR_NOT_FOUND)
+}
+
+func (d *MockA100Device) GetComputeInstanceId() (int, Return) {
+	return d.ComputeInstanceId, MockReturn(SUCCESS)
+}
+
+func (d *MockA100Device) GetComputeRunningProcesses() ([]ProcessInfo, Return) {
+	return d.ComputeProcesses, MockReturn(SUCCESS)
+}
+
+func (d *MockA100Device) GetNvLinkState(Link int) (EnableState, Return) {
+	if Link < 0 || Link >= NVLINK_MAX_LINKS {
+		return FEATURE_DISABLED, MockReturn(ERROR_INVALID_ARGUMENT)
+	}
+	if Link >= len(d.NvLinkPeers) {
+		return FEATURE_DISABLED, MockReturn(ERROR_NOT_SUPPORTED)
+	}
+	return FEATURE_ENABLED, MockReturn(SUCCESS)
+}
+
+func (d *MockA100Device) GetNvLinkRemotePciInfo(Link int) (PciInfo, Return) {
+	var p PciInfo
+	if Link < 0 || Link >= len(d.NvLinkPeers) {
+		return p, MockReturn(ERROR_INVALID_ARGUMENT)
+	}
+	for i := 0; i < len(d.NvLinkPeers[Link]) && i < len(p.BusId)-1; i++ {
+		p.BusId[i] = int8(d.NvLinkPeers[Link][i])
+	}
+	return p, MockReturn(SUCCESS)
+}
+
+func (n *MockLunaServer) findDevice(PciInfo *PciInfo) *MockA100Device {
+	for _, d := range n.Devices {
+		info, _ := d.GetPciInfo()
+		if info.Address() == PciInfo.Address() {
+			return d.(*MockA100Device)
+		}
 	}
-	var gi *MockA100GpuInstance
-	for gi = range d.GpuInstances {
-		break
+	return nil
+}
+
+func (n *MockLunaServer) DeviceModifyDrainState(PciInfo *PciInfo, NewState EnableState) Return {
+	d := n.findDevice(PciInfo)
+	if d == nil || d.Removed {
+		return MockReturn(ERROR_NOT_FOUND)
+	}
+	d.Drained = (NewState == FEATURE_ENABLED)
+	return MockReturn(SUCCESS)
+}
+
+func (n *MockLunaServer) DeviceRemoveGpu(PciInfo *PciInfo) Return {
+	d := n.findDevice(PciInfo)
+	if d == nil || d.Removed {
+		return MockReturn(ERROR_NOT_FOUND)
+	}
+	if !d.Drained {
+		return MockReturn(ERROR_IN_USE)
+	}
+	d.Removed = true
+	return MockReturn(SUCCESS)
+}
+
+func (n *MockLunaServer) DeviceDiscoverGpus() (PciInfo, Return) {
+	var info PciInfo
+	for _, d := range n.Devices {
+		d := d.(*MockA100Device)
+		if d.Removed {
+			d.Removed = false
+			d.Drained = false
+			info, _ = d.GetPciInfo()
+		}
 	}
-	return gi, MockReturn(SUCCESS)
+	return info, MockReturn(SUCCESS)
 }
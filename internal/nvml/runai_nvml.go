@@ -1,9 +1,61 @@
 package nvml
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
 )
 
+func (n *nvmlLib) DeviceModifyDrainState(PciInfo *PciInfo, NewState EnableState) Return {
+	r := nvml.DeviceModifyDrainState((*nvml.PciInfo)(PciInfo), nvml.EnableState(NewState))
+	return nvmlReturn(r)
+}
+
+func (n *nvmlLib) DeviceRemoveGpu(PciInfo *PciInfo) Return {
+	r := nvml.DeviceRemoveGpu((*nvml.PciInfo)(PciInfo))
+	return nvmlReturn(r)
+}
+
+func (n *nvmlLib) DeviceDiscoverGpus() (PciInfo, Return) {
+	p, r := nvml.DeviceDiscoverGpus()
+	return PciInfo(p), nvmlReturn(r)
+}
+
+func (d nvmlDevice) GetNvLinkState(Link int) (EnableState, Return) {
+	state, r := nvml.Device(d).GetNvLinkState(Link)
+	return EnableState(state), nvmlReturn(r)
+}
+
+func (d nvmlDevice) GetNvLinkRemotePciInfo(Link int) (PciInfo, Return) {
+	p, r := nvml.Device(d).GetNvLinkRemotePciInfo(Link)
+	return PciInfo(p), nvmlReturn(r)
+}
+
+// Address converts the PCI bus ID reported by NVML (e.g. "00000000:3B:00.0")
+// into the form used by sysfs (e.g. "0000:3b:00.0").
+func (p PciInfo) Address() string {
+	var b strings.Builder
+	for _, c := range p.BusId {
+		if c == 0 {
+			break
+		}
+		b.WriteByte(byte(c))
+	}
+
+	busID := strings.ToLower(b.String())
+	if busID == "" {
+		return fmt.Sprintf("%04x:%02x:%02x.0", p.Domain, p.Bus, p.Device)
+	}
+
+	parts := strings.SplitN(busID, ":", 2)
+	if len(parts) == 2 && len(parts[0]) > 4 {
+		busID = parts[0][len(parts[0])-4:] + ":" + parts[1]
+	}
+
+	return busID
+}
+
 func (d nvmlDevice) GetMaxMigDeviceCount() (int, Return) {
 	count, r := nvml.Device(d).GetMaxMigDeviceCount()
 	return count, nvmlReturn(r)
@@ -19,6 +71,11 @@ func (d nvmlDevice) GetUUID() (string, Return) {
 	return uuid, nvmlReturn(r)
 }
 
+func (d nvmlDevice) GetName() (string, Return) {
+	name, r := nvml.Device(d).GetName()
+	return name, nvmlReturn(r)
+}
+
 func (d nvmlDevice) GetGpuInstanceId() (int, Return) {
 	id, r := nvml.Device(d).GetGpuInstanceId()
 	return id, nvmlReturn(r)
@@ -28,3 +85,17 @@ func (d nvmlDevice) GetGpuInstanceById(Id int) (GpuInstance, Return) {
 	gi, r := nvml.Device(d).GetGpuInstanceById(Id)
 	return nvmlGpuInstance(gi), nvmlReturn(r)
 }
+
+func (d nvmlDevice) GetComputeInstanceId() (int, Return) {
+	id, r := nvml.Device(d).GetComputeInstanceId()
+	return id, nvmlReturn(r)
+}
+
+func (d nvmlDevice) GetComputeRunningProcesses() ([]ProcessInfo, Return) {
+	nvmlProcesses, r := nvml.Device(d).GetComputeRunningProcesses()
+	var processes []ProcessInfo
+	for _, p := range nvmlProcesses {
+		processes = append(processes, ProcessInfo(p))
+	}
+	return processes, nvmlReturn(r)
+}
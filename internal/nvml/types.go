@@ -25,6 +25,9 @@ type Interface interface {
 	Shutdown() Return
 	DeviceGetCount() (int, Return)
 	DeviceGetHandleByIndex(Index int) (Device, Return)
+	DeviceModifyDrainState(PciInfo *PciInfo, NewState EnableState) Return
+	DeviceRemoveGpu(PciInfo *PciInfo) Return
+	DeviceDiscoverGpus() (PciInfo, Return)
 }
 
 type Device interface {
@@ -37,8 +40,13 @@ type Device interface {
 	GetMaxMigDeviceCount() (int, Return)
 	GetMigDeviceHandleByIndex(Index int) (Device, Return)
 	GetUUID() (string, Return)
+	GetName() (string, Return)
 	GetGpuInstanceId() (int, Return)
 	GetGpuInstanceById(Id int) (GpuInstance, Return)
+	GetComputeInstanceId() (int, Return)
+	GetComputeRunningProcesses() ([]ProcessInfo, Return)
+	GetNvLinkState(Link int) (EnableState, Return)
+	GetNvLinkRemotePciInfo(Link int) (PciInfo, Return)
 }
 
 type GpuInstance interface {
@@ -69,5 +77,7 @@ type ComputeInstanceInfo struct {
 }
 
 type PciInfo nvml.PciInfo
+type EnableState nvml.EnableState
+type ProcessInfo nvml.ProcessInfo
 type GpuInstanceProfileInfo nvml.GpuInstanceProfileInfo
 type ComputeInstanceProfileInfo nvml.ComputeInstanceProfileInfo
@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package enumerator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
+)
+
+// GPU is a GPU found on the node.
+type GPU struct {
+	// Index identifies the GPU to the MIG mode and config managers, and in
+	// the 'devices' field of a MIG config. It is the position of the GPU in
+	// PCI bus order among all GPUs of the node, regardless of any filtering.
+	Index int
+	*nvpci.NvidiaPCIDevice
+}
+
+// Interface enumerates the GPUs of a node, in increasing order of Index.
+type Interface interface {
+	GetGPUs() ([]GPU, error)
+}
+
+type nvpciEnumerator struct {
+	nvpci nvpci.Interface
+}
+
+type fakeEnumerator struct {
+	gpus []GPU
+}
+
+type filteredEnumerator struct {
+	Interface
+	indices map[int]bool
+}
+
+var _ Interface = (*nvpciEnumerator)(nil)
+var _ Interface = (*fakeEnumerator)(nil)
+var _ Interface = (*filteredEnumerator)(nil)
+
+// New returns an Interface enumerating the GPUs on the PCI bus of the node.
+func New() Interface {
+	return NewNvpci(nvpci.New())
+}
+
+// NewNvpci returns an Interface enumerating the GPUs found by nvpci.
+func NewNvpci(p nvpci.Interface) Interface {
+	return &nvpciEnumerator{p}
+}
+
+// NewFake returns an Interface enumerating the given devices, e.g. for tests.
+func NewFake(devices ...*nvpci.NvidiaPCIDevice) Interface {
+	return &fakeEnumerator{toGPUs(devices)}
+}
+
+// NewFiltered returns an Interface enumerating only those GPUs of e whose
+// index is listed. A nil list of indices selects all GPUs.
+func NewFiltered(e Interface, indices []int) Interface {
+	if indices == nil {
+		return e
+	}
+	f := &filteredEnumerator{e, make(map[int]bool)}
+	for _, i := range indices {
+		f.indices[i] = true
+	}
+	return f
+}
+
+func (e *nvpciEnumerator) GetGPUs() ([]GPU, error) {
+	devices, err := e.nvpci.GetGPUs()
+	if err != nil {
+		return nil, err
+	}
+	return toGPUs(devices), nil
+}
+
+func (e *fakeEnumerator) GetGPUs() ([]GPU, error) {
+	return e.gpus, nil
+}
+
+func (e *filteredEnumerator) GetGPUs() ([]GPU, error) {
+	gpus, err := e.Interface.GetGPUs()
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []GPU
+	found := make(map[int]bool)
+	for _, gpu := range gpus {
+		if e.indices[gpu.Index] {
+			filtered = append(filtered, gpu)
+			found[gpu.Index] = true
+		}
+	}
+
+	for i := range e.indices {
+		if !found[i] {
+			return nil, fmt.Errorf("GPU index out of range: %v", i)
+		}
+	}
+
+	return filtered, nil
+}
+
+// ParseIndices parses a comma separated list of GPU indices, e.g. "0,3". An
+// empty string or "all" selects all GPUs and returns nil.
+func ParseIndices(s string) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "all" {
+		return nil, nil
+	}
+
+	seen := make(map[int]bool)
+	indices := []int{}
+	for _, field := range strings.Split(s, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("invalid GPU index: '%v'", field)
+		}
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
+	return indices, nil
+}
+
+func toGPUs(devices []*nvpci.NvidiaPCIDevice) []GPU {
+	gpus := make([]GPU, len(devices))
+	for i, d := range devices {
+		gpus[i] = GPU{i, d}
+	}
+	return gpus
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package enumerator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
+)
+
+func TestParseIndices(t *testing.T) {
+	testCases := []struct {
+		input           string
+		expected        []int
+		expectedFailure bool
+	}{
+		{"", nil, false},
+		{"all", nil, false},
+		{"0", []int{0}, false},
+		{"3,0", []int{0, 3}, false},
+		{" 1, 2 ,1", []int{1, 2}, false},
+		{"0,a", nil, true},
+		{"-1", nil, true},
+		{"0,,1", nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			indices, err := ParseIndices(tc.input)
+			if tc.expectedFailure {
+				require.NotNil(t, err, "Unexpected success from ParseIndices")
+				return
+			}
+			require.Nil(t, err, "Unexpected failure from ParseIndices")
+			require.Equal(t, tc.expected, indices)
+		})
+	}
+}
+
+func TestFiltered(t *testing.T) {
+	all := NewFake(
+		&nvpci.NvidiaPCIDevice{Address: "0000:00:01.0"},
+		&nvpci.NvidiaPCIDevice{Address: "0000:00:02.0"},
+		&nvpci.NvidiaPCIDevice{Address: "0000:00:03.0"},
+		&nvpci.NvidiaPCIDevice{Address: "0000:00:04.0"},
+	)
+
+	gpus, err := NewFiltered(all, nil).GetGPUs()
+	require.Nil(t, err)
+	require.Len(t, gpus, 4)
+
+	gpus, err = NewFiltered(all, []int{0, 3}).GetGPUs()
+	require.Nil(t, err)
+	require.Len(t, gpus, 2)
+	require.Equal(t, 0, gpus[0].Index)
+	require.Equal(t, "0000:00:01.0", gpus[0].Address)
+	require.Equal(t, 3, gpus[1].Index)
+	require.Equal(t, "0000:00:04.0", gpus[1].Address)
+
+	_, err = NewFiltered(all, []int{4}).GetGPUs()
+	require.NotNil(t, err, "Unexpected success filtering out of range GPU")
+}
+
+func TestSysfs(t *testing.T) {
+	root, err := NewMockSysfs(
+		MockGPU{Address: "0000:86:00.0", Device: 0x20b0},
+		MockGPU{Address: "0000:3b:00.0", Device: 0x20b2, Bar0: map[int]uint32{0: 0x170000a1}},
+	)
+	require.Nil(t, err, "Unexpected failure creating mock sysfs")
+	defer os.RemoveAll(root)
+
+	// A non-NVIDIA device is skipped
+	other := filepath.Join(root, "0000:00:1f.0")
+	require.Nil(t, os.MkdirAll(other, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(other, "vendor"), []byte("0x8086\n"), 0644))
+
+	gpus, err := NewSysfs(root).GetGPUs()
+	require.Nil(t, err, "Unexpected failure from GetGPUs")
+	require.Len(t, gpus, 2)
+
+	require.Equal(t, 0, gpus[0].Index)
+	require.Equal(t, "0000:3b:00.0", gpus[0].Address)
+	require.Equal(t, uint16(0x20b2), gpus[0].Device)
+	require.Equal(t, uint16(0x10de), gpus[0].Vendor)
+	require.True(t, gpus[0].Is3DController())
+	require.Equal(t, 1, gpus[1].Index)
+	require.Equal(t, "0000:86:00.0", gpus[1].Address)
+
+	bar0, err := gpus[0].Resources[0].OpenReadOnly()
+	require.Nil(t, err, "Unexpected failure opening bar0")
+	defer bar0.Close()
+	require.Equal(t, uint32(0x170000a1), bar0.Read32(0))
+}
+
+func TestNvml(t *testing.T) {
+	gpus, err := NewNvmlWith(nvml.NewMockNVMLOnLunaServer()).GetGPUs()
+	require.Nil(t, err, "Unexpected failure from GetGPUs")
+	require.Len(t, gpus, 8)
+	for i, gpu := range gpus {
+		require.Equal(t, i, gpu.Index)
+		require.Equal(t, uint16(0x20b0), gpu.Device)
+		require.Equal(t, uint16(0x10de), gpu.Vendor)
+	}
+
+	var info nvml.PciInfo
+	for i, c := range "00000000:3B:00.0" {
+		info.BusId[i] = int8(c)
+	}
+	require.Equal(t, "0000:3b:00.0", info.Address())
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package enumerator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
+)
+
+// MockBar0Size is the size of the bar0 MMIO resource of each mock GPU.
+const MockBar0Size = 16 * 1024 * 1024
+
+// NewMockGPUs returns an Interface enumerating count A100-SXM4-40GB GPUs,
+// e.g. to pair with the GPUs of the NVML mock in tests.
+func NewMockGPUs(count int) Interface {
+	var gpus []*nvpci.NvidiaPCIDevice
+	for i := 0; i < count; i++ {
+		gpus = append(gpus, &nvpci.NvidiaPCIDevice{
+			Vendor: 0x10DE,
+			Device: 0x20B0,
+			Class:  0x030200,
+		})
+	}
+	return NewFake(gpus...)
+}
+
+// MockGPU describes a GPU to create in a mock sysfs tree.
+type MockGPU struct {
+	Address string
+	Device  uint16
+	// Bar0 holds the initial 32-bit values of registers in bar0, by offset.
+	Bar0 map[int]uint32
+	// ResetMethod is the initial content of the reset_method file of the
+	// GPU. The file is not created if empty.
+	ResetMethod string
+}
+
+// NewMockSysfs creates a mock sysfs PCI devices directory in a new temporary
+// directory and returns its path. Each GPU gets a sparse file backing its
+// bar0 MMIO resource, so that it can be mapped just like a real one. The
+// caller is responsible for removing the directory.
+func NewMockSysfs(gpus ...MockGPU) (root string, rerr error) {
+	root, err := ioutil.TempDir("", "mig-parted-sysfs")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if rerr != nil {
+			os.RemoveAll(root)
+		}
+	}()
+
+	for _, gpu := range gpus {
+		err := createMockGPU(root, gpu)
+		if err != nil {
+			return "", fmt.Errorf("error creating mock GPU %v: %v", gpu.Address, err)
+		}
+	}
+
+	return root, nil
+}
+
+func createMockGPU(root string, gpu MockGPU) error {
+	devicePath := filepath.Join(root, gpu.Address)
+	err := os.MkdirAll(devicePath, 0755)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		"vendor":   fmt.Sprintf("0x%04x\n", pciNvidiaVendorID),
+		"class":    fmt.Sprintf("0x%06x\n", pci3dControllerClass),
+		"device":   fmt.Sprintf("0x%04x\n", gpu.Device),
+		"resource": fmt.Sprintf("0x%016x 0x%016x 0x%016x\n", 0xc2000000, 0xc2000000+MockBar0Size-1, 0x40200),
+		"reset":    "",
+	}
+	if gpu.ResetMethod != "" {
+		files["reset_method"] = gpu.ResetMethod + "\n"
+	}
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(devicePath, name), []byte(contents), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	config := make([]byte, 256)
+	binary.LittleEndian.PutUint16(config[0:], pciNvidiaVendorID)
+	binary.LittleEndian.PutUint16(config[2:], gpu.Device)
+	err = ioutil.WriteFile(filepath.Join(devicePath, "config"), config, 0644)
+	if err != nil {
+		return err
+	}
+
+	bar0, err := os.Create(filepath.Join(devicePath, "resource0"))
+	if err != nil {
+		return err
+	}
+	defer bar0.Close()
+
+	err = bar0.Truncate(MockBar0Size)
+	if err != nil {
+		return err
+	}
+
+	for offset, value := range gpu.Bar0 {
+		data := make([]byte, 4)
+		binary.LittleEndian.PutUint32(data, value)
+		_, err := bar0.WriteAt(data, int64(offset))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
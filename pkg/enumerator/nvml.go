@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package enumerator
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
+)
+
+type nvmlEnumerator struct {
+	nvml nvml.Interface
+}
+
+var _ Interface = (*nvmlEnumerator)(nil)
+
+// NewNvml returns an Interface enumerating the GPUs known to NVML. It
+// requires the NVIDIA driver to be loaded. The devices it returns carry no
+// MMIO resources, so they cannot be used with the PCI mode manager.
+func NewNvml() Interface {
+	return NewNvmlWith(nvml.New())
+}
+
+// NewNvmlWith returns an Interface enumerating the GPUs known to the given
+// NVML interface, e.g. a mock of it in tests.
+func NewNvmlWith(nvmlLib nvml.Interface) Interface {
+	return &nvmlEnumerator{nvmlLib}
+}
+
+func (e *nvmlEnumerator) GetGPUs() ([]GPU, error) {
+	ret := e.nvml.Init()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, fmt.Errorf("error initializing NVML: %v", ret)
+	}
+	defer e.nvml.Shutdown()
+
+	count, ret := e.nvml.DeviceGetCount()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting device count: %v", ret)
+	}
+
+	var devices []*nvpci.NvidiaPCIDevice
+	for i := 0; i < count; i++ {
+		device, ret := e.nvml.DeviceGetHandleByIndex(i)
+		if ret.Value() != nvml.SUCCESS {
+			return nil, fmt.Errorf("error getting device handle for GPU %v: %v", i, ret)
+		}
+
+		info, ret := device.GetPciInfo()
+		if ret.Value() != nvml.SUCCESS {
+			return nil, fmt.Errorf("error getting PCI info for GPU %v: %v", i, ret)
+		}
+
+		address := info.Address()
+		devices = append(devices, &nvpci.NvidiaPCIDevice{
+			Path:    filepath.Join(DefaultSysfsRoot, address),
+			Address: address,
+			Vendor:  uint16(info.PciDeviceId & 0xFFFF),
+			Class:   pci3dControllerClass,
+			Device:  uint16(info.PciDeviceId >> 16),
+		})
+	}
+
+	return toGPUs(devices), nil
+}
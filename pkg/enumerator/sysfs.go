@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package enumerator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
+)
+
+const (
+	// DefaultSysfsRoot is where the PCI devices of the node are found.
+	DefaultSysfsRoot = "/sys/bus/pci/devices"
+
+	pciNvidiaVendorID     uint16 = 0x10de
+	pciVgaControllerClass uint32 = 0x030000
+	pci3dControllerClass  uint32 = 0x030200
+)
+
+type sysfsEnumerator struct {
+	root string
+}
+
+var _ Interface = (*sysfsEnumerator)(nil)
+
+// NewSysfs returns an Interface enumerating the NVIDIA GPUs found in a sysfs
+// PCI devices directory rooted at root, e.g. a host sysfs mounted into a
+// container, or a mock tree created by NewMockSysfs.
+func NewSysfs(root string) Interface {
+	return &sysfsEnumerator{root}
+}
+
+func (e *sysfsEnumerator) GetGPUs() ([]GPU, error) {
+	entries, err := ioutil.ReadDir(e.root)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read PCI bus devices: %v", err)
+	}
+
+	var devices []*nvpci.NvidiaPCIDevice
+	for _, entry := range entries {
+		device, err := e.readDevice(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if device == nil {
+			continue
+		}
+		if device.Class != pciVgaControllerClass && device.Class != pci3dControllerClass {
+			continue
+		}
+		devices = append(devices, device)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return addressToID(devices[i].Address) < addressToID(devices[j].Address)
+	})
+
+	return toGPUs(devices), nil
+}
+
+// readDevice reads the PCI device at the given address, returning nil if it
+// is not an NVIDIA device.
+func (e *sysfsEnumerator) readDevice(address string) (*nvpci.NvidiaPCIDevice, error) {
+	devicePath := filepath.Join(e.root, address)
+
+	vendor, err := readHex(filepath.Join(devicePath, "vendor"), 16)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read PCI device vendor id for %s: %v", address, err)
+	}
+	if uint16(vendor) != pciNvidiaVendorID {
+		return nil, nil
+	}
+
+	class, err := readHex(filepath.Join(devicePath, "class"), 32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read PCI device class for %s: %v", address, err)
+	}
+
+	device, err := readHex(filepath.Join(devicePath, "device"), 16)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read PCI device id for %s: %v", address, err)
+	}
+
+	resource, err := ioutil.ReadFile(filepath.Join(devicePath, "resource"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read PCI resource file for %s: %v", address, err)
+	}
+
+	resources := make(map[int]*nvpci.MemoryResource)
+	for i, line := range strings.Split(strings.TrimSpace(string(resource)), "\n") {
+		values := strings.Fields(line)
+		if len(values) != 3 {
+			return nil, fmt.Errorf("unexpected number of entries in line '%d' of resource file for %s", i, address)
+		}
+
+		start, _ := strconv.ParseUint(values[0], 0, 64)
+		end, _ := strconv.ParseUint(values[1], 0, 64)
+		flags, _ := strconv.ParseUint(values[2], 0, 64)
+
+		if (end - start) != 0 {
+			resources[i] = &nvpci.MemoryResource{
+				Start: uintptr(start),
+				End:   uintptr(end),
+				Flags: flags,
+				Path:  filepath.Join(devicePath, fmt.Sprintf("resource%d", i)),
+			}
+		}
+	}
+
+	return &nvpci.NvidiaPCIDevice{
+		Path:      devicePath,
+		Address:   address,
+		Vendor:    uint16(vendor),
+		Class:     uint32(class),
+		Device:    uint16(device),
+		Config:    &nvpci.ConfigSpace{Path: filepath.Join(devicePath, "config")},
+		Resources: resources,
+	}, nil
+}
+
+func readHex(path string, bitSize int) (uint64, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(contents)), 0, bitSize)
+}
+
+func addressToID(address string) uint64 {
+	address = strings.ReplaceAll(address, ":", "")
+	address = strings.ReplaceAll(address, ".", "")
+	id, _ := strconv.ParseUint(address, 16, 64)
+	return id
+}
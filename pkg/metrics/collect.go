@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/apply"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+)
+
+// GPUState is the MIG state of a single GPU.
+type GPUState struct {
+	GPU               int
+	MigCapable        bool
+	MigEnabled        bool
+	MigPendingEnabled bool
+	MigDevices        types.MigConfig
+}
+
+// Manager queries the MIG state of GPUs. It is implemented by the combination
+// of a mode.Manager and a config.Manager.
+type Manager interface {
+	IsMigCapable(ctx context.Context, gpu int) (bool, error)
+	GetMigMode(ctx context.Context, gpu int) (mode.MigMode, error)
+	IsMigModeChangePending(ctx context.Context, gpu int) (bool, error)
+	GetMigConfig(ctx context.Context, gpu int) (types.MigConfig, error)
+}
+
+// CollectGPUStates queries the MIG state of all GPUs of gpus. The MIG devices
+// of a GPU are only queried if MIG mode is enabled on it.
+func CollectGPUStates(ctx context.Context, gpus enumerator.Interface, manager Manager) ([]GPUState, error) {
+	devices, err := gpus.GetGPUs()
+	if err != nil {
+		return nil, fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+
+	var states []GPUState
+	for _, device := range devices {
+		i := device.Index
+		if ctx.Err() != nil {
+			return nil, types.NewContextError(i, ctx.Err())
+		}
+
+		state := GPUState{
+			GPU:        i,
+			MigDevices: types.MigConfig{},
+		}
+
+		state.MigCapable, err = manager.IsMigCapable(ctx, i)
+		if err != nil {
+			return nil, fmt.Errorf("error checking MIG capable: %w", err)
+		}
+		if !state.MigCapable {
+			states = append(states, state)
+			continue
+		}
+
+		m, err := manager.GetMigMode(ctx, i)
+		if err != nil {
+			return nil, fmt.Errorf("error getting MIG mode: %w", err)
+		}
+		state.MigEnabled = (m == mode.Enabled)
+
+		pending, err := manager.IsMigModeChangePending(ctx, i)
+		if err != nil {
+			return nil, fmt.Errorf("error checking for pending MIG mode change: %w", err)
+		}
+		state.MigPendingEnabled = (state.MigEnabled != pending)
+
+		if state.MigEnabled {
+			state.MigDevices, err = manager.GetMigConfig(ctx, i)
+			if err != nil {
+				return nil, fmt.Errorf("error getting MIG config: %w", err)
+			}
+		}
+
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// InstrumentResetter returns an apply.Resetter recording how long each reset
+// by r takes in m.
+func InstrumentResetter(r apply.Resetter, m *Metrics) apply.Resetter {
+	if m == nil {
+		return r
+	}
+	return &resetter{r, m}
+}
+
+type resetter struct {
+	apply.Resetter
+	metrics *Metrics
+}
+
+func (r *resetter) Reset(ctx context.Context, gpus []enumerator.GPU, pending map[int]bool) ([]apply.ResetResult, error) {
+	start := time.Now()
+	results, err := r.Resetter.Reset(ctx, gpus, pending)
+	if len(results) > 0 {
+		r.metrics.ObserveReset(string(results[0].Method), time.Since(start))
+	}
+	return results, err
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics records the state of the GPUs of a node and what was done
+// to them while applying MIG configurations, and writes it in the Prometheus
+// text exposition format, either to be scraped or as a textfile for the
+// textfile collector of the node exporter.
+package metrics
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/mig-parted/pkg/types"
+)
+
+// Namespace prefixes the names of all metrics.
+const Namespace = "mig_parted"
+
+// Names of all metrics.
+const (
+	GPUMigModeName        = Namespace + "_gpu_mig_mode"
+	GPUMigModePendingName = Namespace + "_gpu_mig_mode_pending"
+	GPUMigDevicesName     = Namespace + "_gpu_mig_devices"
+	ApplyAttemptsName     = Namespace + "_apply_attempts_total"
+	ApplyFailuresName     = Namespace + "_apply_failures_total"
+	HookDurationName      = Namespace + "_hook_duration_seconds"
+	ResetDurationName     = Namespace + "_reset_duration_seconds"
+)
+
+// DurationBuckets are the upper bounds in seconds of the buckets of all
+// duration histograms. Hooks and GPU resets take from well under a second to
+// several minutes.
+var DurationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600}
+
+// Metrics holds the state of the GPUs of a node, along with counters and
+// histograms of what was done to them. It is safe for concurrent use. All
+// methods of a nil *Metrics do nothing, so that recording metrics can be
+// disabled by not creating any.
+type Metrics struct {
+	mutex sync.Mutex
+
+	gpus           []GPUState
+	applyAttempts  float64
+	applyFailures  map[string]float64
+	hookDurations  map[string]*histogram
+	resetDurations map[string]*histogram
+}
+
+// histogram counts observations in DurationBuckets. counts holds cumulative
+// counts, one per bucket.
+type histogram struct {
+	counts []float64
+	count  float64
+	sum    float64
+}
+
+// New creates empty Metrics.
+func New() *Metrics {
+	return &Metrics{
+		applyFailures:  make(map[string]float64),
+		hookDurations:  make(map[string]*histogram),
+		resetDurations: make(map[string]*histogram),
+	}
+}
+
+// SetGPUStates replaces the state of the GPUs of the node.
+func (m *Metrics) SetGPUStates(states []GPUState) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.gpus = append([]GPUState{}, states...)
+	sort.SliceStable(m.gpus, func(i, j int) bool {
+		return m.gpus[i].GPU < m.gpus[j].GPU
+	})
+}
+
+// ObserveApply counts an attempt at applying a MIG configuration, and a
+// failure in the category of err if it is not nil.
+func (m *Metrics) ObserveApply(err error) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.applyAttempts++
+	if err != nil {
+		m.applyFailures[ErrorCategory(err)]++
+	}
+}
+
+// ObserveHook records how long running the hook name took.
+func (m *Metrics) ObserveHook(name string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	observe(m.hookDurations, name, d.Seconds())
+}
+
+// ObserveReset records how long resetting GPUs using method took.
+func (m *Metrics) ObserveReset(method string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	if method == "" {
+		method = "unknown"
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	observe(m.resetDurations, method, d.Seconds())
+}
+
+// ErrorCategory returns the name of the category of the first *types.Error
+// in the chain of err, as used to label failures.
+func ErrorCategory(err error) string {
+	var typed *types.Error
+	if errors.As(err, &typed) {
+		return typed.Category.String()
+	}
+	return types.ErrorCategoryUnknown.String()
+}
+
+func observe(histograms map[string]*histogram, label string, value float64) {
+	h := histograms[label]
+	if h == nil {
+		h = newHistogram()
+		histograms[label] = h
+	}
+	for i, bound := range DurationBuckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]float64, len(DurationBuckets)),
+	}
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/apply"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, m *Metrics) string {
+	var b bytes.Buffer
+	require.Nil(t, m.Write(&b))
+	return b.String()
+}
+
+func TestWrite(t *testing.T) {
+	m := New()
+	m.SetGPUStates([]GPUState{
+		{GPU: 1, MigCapable: true, MigEnabled: false, MigPendingEnabled: true, MigDevices: types.MigConfig{}},
+		{GPU: 0, MigCapable: true, MigEnabled: true, MigPendingEnabled: true, MigDevices: types.MigConfig{"1g.5gb": 2, "3g.20gb": 1}},
+		{GPU: 2, MigCapable: false, MigDevices: types.MigConfig{}},
+	})
+	m.ObserveApply(nil)
+	m.ObserveApply(types.NewError(types.ErrorCategoryInUse, 0, "in use"))
+	m.ObserveApply(fmt.Errorf("wrapped: %w", types.NewError(types.ErrorCategoryInUse, 1, "in use")))
+	m.ObserveApply(fmt.Errorf("untyped"))
+	m.ObserveHook("apply-start", 300*time.Millisecond)
+	m.ObserveHook("apply-start", 2*time.Second)
+	m.ObserveReset("flr", 20*time.Second)
+
+	output := write(t, m)
+	for _, line := range []string{
+		`# TYPE mig_parted_gpu_mig_mode gauge`,
+		`mig_parted_gpu_mig_mode{gpu="0"} 1`,
+		`mig_parted_gpu_mig_mode{gpu="1"} 0`,
+		`mig_parted_gpu_mig_mode_pending{gpu="0"} 1`,
+		`mig_parted_gpu_mig_mode_pending{gpu="1"} 1`,
+		`mig_parted_gpu_mig_devices{gpu="0",profile="1g.5gb"} 2`,
+		`mig_parted_gpu_mig_devices{gpu="0",profile="3g.20gb"} 1`,
+		`# TYPE mig_parted_apply_attempts_total counter`,
+		`mig_parted_apply_attempts_total 4`,
+		`mig_parted_apply_failures_total{category="in-use"} 2`,
+		`mig_parted_apply_failures_total{category="unknown"} 1`,
+		`# TYPE mig_parted_hook_duration_seconds histogram`,
+		`mig_parted_hook_duration_seconds_bucket{hook="apply-start",le="0.1"} 0`,
+		`mig_parted_hook_duration_seconds_bucket{hook="apply-start",le="0.5"} 1`,
+		`mig_parted_hook_duration_seconds_bucket{hook="apply-start",le="5"} 2`,
+		`mig_parted_hook_duration_seconds_bucket{hook="apply-start",le="+Inf"} 2`,
+		`mig_parted_hook_duration_seconds_sum{hook="apply-start"} 2.3`,
+		`mig_parted_hook_duration_seconds_count{hook="apply-start"} 2`,
+		`mig_parted_reset_duration_seconds_bucket{method="flr",le="10"} 0`,
+		`mig_parted_reset_duration_seconds_bucket{method="flr",le="30"} 1`,
+		`mig_parted_reset_duration_seconds_count{method="flr"} 1`,
+	} {
+		require.Contains(t, strings.Split(output, "\n"), line)
+	}
+	require.NotContains(t, output, `gpu="2"`)
+}
+
+func TestReadAccumulates(t *testing.T) {
+	first := New()
+	first.SetGPUStates([]GPUState{{GPU: 0, MigCapable: true, MigEnabled: true, MigDevices: types.MigConfig{"7g.40gb": 1}}})
+	first.ObserveApply(types.NewError(types.ErrorCategoryTimeout, -1, "timed out"))
+	first.ObserveHook("pre-gpu", time.Second)
+	first.ObserveReset("nvml", time.Second)
+
+	second := New()
+	second.ObserveApply(nil)
+	second.ObserveHook("pre-gpu", 3*time.Second)
+	second.ObserveHook("post-gpu", time.Second)
+
+	require.Nil(t, second.Read(strings.NewReader(write(t, first))))
+
+	expected := New()
+	expected.ObserveApply(types.NewError(types.ErrorCategoryTimeout, -1, "timed out"))
+	expected.ObserveApply(nil)
+	expected.ObserveHook("pre-gpu", time.Second)
+	expected.ObserveHook("pre-gpu", 3*time.Second)
+	expected.ObserveHook("post-gpu", time.Second)
+	expected.ObserveReset("nvml", time.Second)
+
+	// The state of GPUs is not carried over
+	require.Equal(t, write(t, expected), write(t, second))
+}
+
+func TestReadIgnoresOtherMetrics(t *testing.T) {
+	input := strings.Join([]string{
+		`# HELP mig_parted_apply_attempts_total Number of attempts.`,
+		`# TYPE mig_parted_apply_attempts_total counter`,
+		`mig_parted_apply_attempts_total 2`,
+		`mig_parted_apply_attempts_total_extra{x="y" 1`,
+		`mig_parted_hook_duration_seconds_total{hook="pre-gpu"} 1 1600000000000`,
+		`node_cpu_seconds_total{cpu="0"} NaN`,
+	}, "\n")
+
+	m := New()
+	require.Nil(t, m.Read(strings.NewReader(input)))
+	require.Contains(t, strings.Split(write(t, m), "\n"), "mig_parted_apply_attempts_total 2")
+	require.NotContains(t, write(t, m), `hook="pre-gpu"`)
+}
+
+func TestReadInvalid(t *testing.T) {
+	for _, input := range []string{
+		`mig_parted_apply_attempts_total`,
+		`mig_parted_apply_attempts_total one`,
+		`mig_parted_apply_failures_total{category="in-use} 1`,
+		`mig_parted_apply_failures_total{category} 1`,
+	} {
+		require.NotNil(t, New().Read(strings.NewReader(input)), "Expected error reading %q", input)
+	}
+}
+
+func TestTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mig-parted-metrics-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "textfile", "mig-parted.prom")
+
+	for i := 1; i <= 3; i++ {
+		m := New()
+		m.ObserveApply(nil)
+		m.ObserveHook("pre-gpu", 2*time.Second)
+		m.ObserveReset("flr", 20*time.Second)
+		require.Nil(t, m.ReadTextfile(path))
+		require.Nil(t, m.WriteTextfile(path))
+
+		content, err := ioutil.ReadFile(path)
+		require.Nil(t, err)
+		lines := strings.Split(string(content), "\n")
+		for _, line := range []string{
+			fmt.Sprintf(`mig_parted_apply_attempts_total %d`, i),
+			`mig_parted_hook_duration_seconds_bucket{hook="pre-gpu",le="1"} 0`,
+			fmt.Sprintf(`mig_parted_hook_duration_seconds_bucket{hook="pre-gpu",le="5"} %d`, i),
+			fmt.Sprintf(`mig_parted_hook_duration_seconds_bucket{hook="pre-gpu",le="+Inf"} %d`, i),
+			fmt.Sprintf(`mig_parted_hook_duration_seconds_sum{hook="pre-gpu"} %d`, 2*i),
+			fmt.Sprintf(`mig_parted_hook_duration_seconds_count{hook="pre-gpu"} %d`, i),
+			fmt.Sprintf(`mig_parted_reset_duration_seconds_bucket{method="flr",le="30"} %d`, i),
+			fmt.Sprintf(`mig_parted_reset_duration_seconds_sum{method="flr"} %d`, 20*i),
+			fmt.Sprintf(`mig_parted_reset_duration_seconds_count{method="flr"} %d`, i),
+		} {
+			require.Contains(t, lines, line)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.SetGPUStates([]GPUState{{GPU: 0}})
+	m.ObserveApply(nil)
+	m.ObserveHook("apply-start", time.Second)
+	m.ObserveReset("flr", time.Second)
+	require.Nil(t, m.Write(ioutil.Discard))
+	require.Nil(t, m.Read(strings.NewReader("")))
+}
+
+// pendingManager reports a pending MIG mode change on the GPUs set in pending,
+// which the NVML mock does not model.
+type pendingManager struct {
+	Manager
+	pending map[int]bool
+}
+
+func (m *pendingManager) IsMigModeChangePending(ctx context.Context, gpu int) (bool, error) {
+	return m.pending[gpu], nil
+}
+
+func TestCollectGPUStates(t *testing.T) {
+	server := nvml.NewMockNVMLOnLunaServer().(*nvml.MockLunaServer)
+	type modeManager = mode.Manager
+	type configManager = config.Manager
+	nvmlManager := &struct {
+		modeManager
+		configManager
+	}{mode.NewNvmlMigModeManagerWith(server), config.NewNvmlMigConfigManagerWith(server)}
+	gpus := enumerator.NewMockGPUs(len(server.Devices))
+	ctx := context.Background()
+
+	require.Nil(t, nvmlManager.SetMigMode(ctx, 0, mode.Enabled))
+	require.Nil(t, nvmlManager.SetMigMode(ctx, 1, mode.Enabled))
+	require.Nil(t, nvmlManager.SetMigConfig(ctx, 0, types.MigConfig{"3g.20gb": 2}))
+
+	manager := &pendingManager{nvmlManager, map[int]bool{1: true, 2: true}}
+	states, err := CollectGPUStates(ctx, gpus, manager)
+	require.Nil(t, err)
+	require.Len(t, states, len(server.Devices))
+
+	require.Equal(t, GPUState{GPU: 0, MigCapable: true, MigEnabled: true, MigPendingEnabled: true, MigDevices: types.MigConfig{"3g.20gb": 2}}, states[0])
+	require.Equal(t, GPUState{GPU: 1, MigCapable: true, MigEnabled: true, MigPendingEnabled: false, MigDevices: types.MigConfig{}}, states[1])
+	require.Equal(t, GPUState{GPU: 2, MigCapable: true, MigEnabled: false, MigPendingEnabled: true, MigDevices: types.MigConfig{}}, states[2])
+	require.Equal(t, GPUState{GPU: 3, MigCapable: true, MigEnabled: false, MigPendingEnabled: false, MigDevices: types.MigConfig{}}, states[3])
+}
+
+type mockResetter struct {
+	method apply.ResetMethod
+}
+
+func (r *mockResetter) Reset(ctx context.Context, gpus []enumerator.GPU, pending map[int]bool) ([]apply.ResetResult, error) {
+	var results []apply.ResetResult
+	for _, gpu := range gpus {
+		if pending[gpu.Index] {
+			results = append(results, apply.ResetResult{GPU: gpu.Index, Method: r.method})
+		}
+	}
+	return results, nil
+}
+
+func TestInstrumentResetter(t *testing.T) {
+	inner := &mockResetter{method: apply.ResetMethodSbr}
+	require.Equal(t, inner, InstrumentResetter(inner, nil))
+
+	m := New()
+	r := InstrumentResetter(inner, m)
+	gpus, err := enumerator.NewMockGPUs(2).GetGPUs()
+	require.Nil(t, err)
+
+	_, err = r.Reset(context.Background(), gpus, map[int]bool{})
+	require.Nil(t, err)
+	require.NotContains(t, write(t, m), `method="sbr"`)
+
+	results, err := r.Reset(context.Background(), gpus, map[int]bool{0: true, 1: true})
+	require.Nil(t, err)
+	require.Len(t, results, 2)
+	require.Contains(t, write(t, m), `mig_parted_reset_duration_seconds_count{method="sbr"} 1`)
+}
@@ -0,0 +1,343 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/mig-parted/pkg/types"
+)
+
+// ContentType is the content type of the Prometheus text exposition format
+// written by Write.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Write writes all metrics to w in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	if m == nil {
+		return nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	b := bufio.NewWriter(w)
+
+	header(b, GPUMigModeName, "gauge", "Whether MIG mode is currently enabled on a MIG capable GPU.")
+	for _, gpu := range m.gpus {
+		if gpu.MigCapable {
+			sample(b, GPUMigModeName, boolValue(gpu.MigEnabled), "gpu", strconv.Itoa(gpu.GPU))
+		}
+	}
+
+	header(b, GPUMigModePendingName, "gauge", "Whether MIG mode will be enabled on a MIG capable GPU once it is reset.")
+	for _, gpu := range m.gpus {
+		if gpu.MigCapable {
+			sample(b, GPUMigModePendingName, boolValue(gpu.MigPendingEnabled), "gpu", strconv.Itoa(gpu.GPU))
+		}
+	}
+
+	header(b, GPUMigDevicesName, "gauge", "Number of MIG devices on a GPU, by profile.")
+	for _, gpu := range m.gpus {
+		var profiles []string
+		for profile := range gpu.MigDevices {
+			profiles = append(profiles, string(profile))
+		}
+		sort.Strings(profiles)
+		for _, profile := range profiles {
+			count := gpu.MigDevices[types.MigProfile(profile)]
+			sample(b, GPUMigDevicesName, float64(count), "gpu", strconv.Itoa(gpu.GPU), "profile", profile)
+		}
+	}
+
+	header(b, ApplyAttemptsName, "counter", "Number of attempts at applying a MIG configuration.")
+	sample(b, ApplyAttemptsName, m.applyAttempts)
+
+	header(b, ApplyFailuresName, "counter", "Number of failed attempts at applying a MIG configuration, by category of error.")
+	for _, category := range sortedKeys(m.applyFailures) {
+		sample(b, ApplyFailuresName, m.applyFailures[category], "category", category)
+	}
+
+	header(b, HookDurationName, "histogram", "Time taken to run a hook, by hook.")
+	writeHistograms(b, HookDurationName, "hook", m.hookDurations)
+
+	header(b, ResetDurationName, "histogram", "Time taken to reset GPUs after a MIG mode change, by reset method.")
+	writeHistograms(b, ResetDurationName, "method", m.resetDurations)
+
+	return b.Flush()
+}
+
+// Read adds the counters and histograms written by Write to r to m, so that
+// they keep accumulating across invocations writing the same textfile. Only
+// the lines of these metrics are parsed, and only in the form Write writes
+// them: this is not a parser of the Prometheus text exposition format. The
+// state of GPUs is not read, as it is only valid at the time it was written.
+func (m *Metrics) Read(r io.Reader) error {
+	if m == nil {
+		return nil
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !isSampleOf(line, ApplyAttemptsName, ApplyFailuresName, HookDurationName, ResetDurationName) {
+			continue
+		}
+
+		name, labels, value, err := parseSample(line)
+		if err != nil {
+			return fmt.Errorf("error parsing '%v': %w", line, err)
+		}
+
+		switch name {
+		case ApplyAttemptsName:
+			m.applyAttempts += value
+		case ApplyFailuresName:
+			m.applyFailures[labels["category"]] += value
+		case HookDurationName + "_bucket", HookDurationName + "_sum", HookDurationName + "_count":
+			readHistogram(m.hookDurations, strings.TrimPrefix(name, HookDurationName), labels["hook"], labels, value)
+		case ResetDurationName + "_bucket", ResetDurationName + "_sum", ResetDurationName + "_count":
+			readHistogram(m.resetDurations, strings.TrimPrefix(name, ResetDurationName), labels["method"], labels, value)
+		}
+	}
+	return scanner.Err()
+}
+
+// WriteTextfile writes all metrics to path, for the textfile collector of
+// the node exporter. The file is replaced atomically so that it is never
+// read half written.
+func (m *Metrics) WriteTextfile(path string) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("error creating directory of metrics textfile: %w", err)
+	}
+
+	file, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating metrics textfile: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	err = m.Write(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error writing metrics textfile: %w", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("error writing metrics textfile: %w", err)
+	}
+	err = os.Chmod(file.Name(), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing metrics textfile: %w", err)
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// ReadTextfile reads the counters and histograms of the textfile at path, if
+// it exists (see Read).
+func (m *Metrics) ReadTextfile(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening metrics textfile: %w", err)
+	}
+	defer file.Close()
+
+	err = m.Read(file)
+	if err != nil {
+		return fmt.Errorf("error reading metrics textfile: %w", err)
+	}
+	return nil
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// sample writes a single sample of the metric name, with labels given as
+// alternating names and values.
+func sample(w io.Writer, name string, value float64, labels ...string) {
+	io.WriteString(w, name)
+	if len(labels) > 0 {
+		var pairs []string
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+		}
+		io.WriteString(w, "{"+strings.Join(pairs, ",")+"}")
+	}
+	fmt.Fprintf(w, " %s\n", formatValue(value))
+}
+
+func writeHistograms(w io.Writer, name, label string, histograms map[string]*histogram) {
+	for _, key := range sortedHistogramKeys(histograms) {
+		h := histograms[key]
+		for i, bound := range DurationBuckets {
+			sample(w, name+"_bucket", h.counts[i], label, key, "le", formatValue(bound))
+		}
+		sample(w, name+"_bucket", h.count, label, key, "le", "+Inf")
+		sample(w, name+"_sum", h.sum, label, key)
+		sample(w, name+"_count", h.count, label, key)
+	}
+}
+
+// isSampleOf returns whether line is a sample of one of the metrics names.
+// Histograms are named without the suffix of their samples.
+func isSampleOf(line string, names ...string) bool {
+	for _, name := range names {
+		rest := strings.TrimPrefix(line, name)
+		if rest == line {
+			continue
+		}
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if strings.HasPrefix(rest, suffix) {
+				rest = strings.TrimPrefix(rest, suffix)
+				break
+			}
+		}
+		if rest == "" || rest[0] == '{' || rest[0] == ' ' {
+			return true
+		}
+	}
+	return false
+}
+
+// readHistogram adds a bucket, sum or count sample (as given by suffix) of
+// the histogram with the given label value to histograms. Buckets not in
+// DurationBuckets are dropped.
+func readHistogram(histograms map[string]*histogram, suffix, key string, labels map[string]string, value float64) {
+	h := histograms[key]
+	if h == nil {
+		h = newHistogram()
+		histograms[key] = h
+	}
+
+	switch suffix {
+	case "_sum":
+		h.sum += value
+	case "_count":
+		h.count += value
+	case "_bucket":
+		bound, err := strconv.ParseFloat(labels["le"], 64)
+		if err != nil {
+			return
+		}
+		for i, b := range DurationBuckets {
+			if b == bound {
+				h.counts[i] += value
+			}
+		}
+	}
+}
+
+// parseSample parses a sample line as written by sample. Label values must be
+// quoted as by strconv.Quote, and timestamps are not supported.
+func parseSample(line string) (string, map[string]string, float64, error) {
+	labels := make(map[string]string)
+
+	end := strings.IndexAny(line, "{ ")
+	if end < 0 {
+		return "", nil, 0, fmt.Errorf("missing value")
+	}
+	name, rest := line[:end], line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		rest = rest[1:]
+		for !strings.HasPrefix(rest, "}") {
+			eq := strings.Index(rest, "=")
+			if eq < 0 {
+				return "", nil, 0, fmt.Errorf("malformed labels")
+			}
+			label := strings.TrimPrefix(rest[:eq], ",")
+			value, err := quotedPrefix(rest[eq+1:])
+			if err != nil {
+				return "", nil, 0, fmt.Errorf("malformed value of label '%v': %w", label, err)
+			}
+			rest = rest[eq+1+len(value):]
+			labels[label], _ = strconv.Unquote(value)
+			rest = strings.TrimPrefix(rest, ",")
+		}
+		rest = rest[1:]
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(rest), 64)
+	if err != nil {
+		return "", nil, 0, fmt.Errorf("malformed value: %w", err)
+	}
+
+	return name, labels, value, nil
+}
+
+// quotedPrefix returns the double quoted string at the start of s, quotes
+// included.
+func quotedPrefix(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", fmt.Errorf("missing opening quote")
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return s[:i+1], nil
+		}
+	}
+	return "", fmt.Errorf("missing closing quote")
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]float64) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedHistogramKeys(m map[string]*histogram) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,346 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"time"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/assert"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultResetTimeout is the default time limit for resetting GPUs, which has
+// been seen to hang indefinitely on unhealthy GPUs.
+const DefaultResetTimeout = 5 * time.Minute
+
+const inUsePollInterval = time.Second
+
+// Applier applies a MIG configuration to the GPUs of a node.
+type Applier struct {
+	modeManager   mode.Manager
+	configManager config.Manager
+	gpus          enumerator.Interface
+	hooks         Hooks
+	resetter      Resetter
+	uuidGetter    config.UUIDGetter
+
+	skipReset     bool
+	modeOnly      bool
+	force         bool
+	inUseTimeout  time.Duration
+	timeout       time.Duration
+	modeTimeout   time.Duration
+	configTimeout time.Duration
+	resetTimeout  time.Duration
+}
+
+// Option configures an Applier.
+type Option func(*Applier)
+
+// GPUResult holds what was done to a single GPU while applying a MIG
+// configuration.
+type GPUResult struct {
+	GPU                  int
+	DeviceID             types.DeviceID
+	MigCapable           bool
+	MigModeChanged       bool
+	MigModeChangePending bool
+	Reset                bool
+	ResetMethod          ResetMethod
+	ResetError           error
+	RebootRequired       bool
+	RebootReason         string
+	MigDevicesChanged    bool
+	ClearedMigDevices    types.MigConfig
+	Processes            []config.Process
+}
+
+// Result holds what was done to all GPUs visited while applying a MIG
+// configuration, in the order they were first visited.
+type Result struct {
+	GPUs []GPUResult
+
+	// Plan holds the changes found to be needed before applying, if they
+	// could be found. It is only set by Apply, and only if it runs hooks.
+	Plan *Plan
+
+	// UUIDs of the GPUs passed to hooks
+	uuids map[int]string
+}
+
+// WithModeManager sets the mode.Manager used to query and change the MIG mode
+// of each GPU. It defaults to a PCI based manager.
+func WithModeManager(m mode.Manager) Option {
+	return func(a *Applier) {
+		a.modeManager = m
+	}
+}
+
+// WithConfigManager sets the config.Manager used to query and change the MIG
+// devices of each GPU. It defaults to an NVML based manager.
+func WithConfigManager(m config.Manager) Option {
+	return func(a *Applier) {
+		a.configManager = m
+	}
+}
+
+// WithGPUEnumerator sets how the GPUs of the node are enumerated, and which
+// of them are reconfigured. It defaults to all GPUs on the PCI bus.
+func WithGPUEnumerator(gpus enumerator.Interface) Option {
+	return func(a *Applier) {
+		a.gpus = gpus
+	}
+}
+
+// WithHooks sets the hooks run while applying. No hooks are run by default.
+func WithHooks(hooks Hooks) Option {
+	return func(a *Applier) {
+		a.hooks = hooks
+	}
+}
+
+// WithUUIDGetter sets how the UUIDs of the GPUs passed to hooks are looked
+// up. By default no UUIDs are passed to hooks, as looking them up requires the
+// NVIDIA driver to be loaded.
+func WithUUIDGetter(g config.UUIDGetter) Option {
+	return func(a *Applier) {
+		a.uuidGetter = g
+	}
+}
+
+// WithResetter sets how GPUs are reset after a MIG mode change. It defaults
+// to a PCIe function level reset (see NewResetter).
+func WithResetter(r Resetter) Option {
+	return func(a *Applier) {
+		a.resetter = r
+	}
+}
+
+// WithSkipReset skips resetting GPUs after a MIG mode change.
+func WithSkipReset(skip bool) Option {
+	return func(a *Applier) {
+		a.skipReset = skip
+	}
+}
+
+// WithModeOnly only applies the MIG mode, not the MIG devices.
+func WithModeOnly(modeOnly bool) Option {
+	return func(a *Applier) {
+		a.modeOnly = modeOnly
+	}
+}
+
+// WithForce reconfigures MIG devices even if processes are running on them.
+func WithForce(force bool) Option {
+	return func(a *Applier) {
+		a.force = force
+	}
+}
+
+// WithInUseTimeout sets how long to wait for processes running on GPUs to
+// exit before giving up on reconfiguring their MIG devices.
+func WithInUseTimeout(timeout time.Duration) Option {
+	return func(a *Applier) {
+		a.inUseTimeout = timeout
+	}
+}
+
+// WithTimeout sets an overall time limit for applying. 0 means no limit.
+func WithTimeout(timeout time.Duration) Option {
+	return func(a *Applier) {
+		a.timeout = timeout
+	}
+}
+
+// WithModeTimeout sets a time limit for applying the MIG mode to all GPUs,
+// excluding the GPU reset. 0 means no limit.
+func WithModeTimeout(timeout time.Duration) Option {
+	return func(a *Applier) {
+		a.modeTimeout = timeout
+	}
+}
+
+// WithConfigTimeout sets a time limit for applying the MIG devices to all
+// GPUs. 0 means no limit.
+func WithConfigTimeout(timeout time.Duration) Option {
+	return func(a *Applier) {
+		a.configTimeout = timeout
+	}
+}
+
+// WithResetTimeout sets a time limit for resetting GPUs after a MIG mode
+// change. It defaults to DefaultResetTimeout; 0 means no limit.
+func WithResetTimeout(timeout time.Duration) Option {
+	return func(a *Applier) {
+		a.resetTimeout = timeout
+	}
+}
+
+// New creates an Applier with the given options.
+func New(opts ...Option) *Applier {
+	a := &Applier{
+		resetTimeout: DefaultResetTimeout,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.modeManager == nil {
+		a.modeManager = mode.NewPciMigModeManager()
+	}
+	if a.configManager == nil {
+		a.configManager = config.NewNvmlMigConfigManager()
+	}
+	if a.gpus == nil {
+		a.gpus = enumerator.New()
+	}
+	if a.hooks == nil {
+		a.hooks = noopHooks{}
+	}
+	if a.resetter == nil {
+		a.resetter = NewFlrResetter()
+	}
+	return a
+}
+
+// Asserter returns an assert.Asserter sharing the managers and GPU enumerator
+// of the Applier.
+func (a *Applier) Asserter() *assert.Asserter {
+	return assert.New(
+		assert.WithModeManager(a.modeManager),
+		assert.WithConfigManager(a.configManager),
+		assert.WithGPUEnumerator(a.gpus),
+	)
+}
+
+// Apply applies migConfig to the GPUs of the node, changing the MIG mode and
+// MIG devices of each GPU only where they differ from it.
+//
+// Canceling ctx stops Apply between GPUs; the GPU currently being worked on is
+// always left in a consistent state. The time spent on each GPU is instead
+// bounded by the timeouts of the Applier.
+func (a *Applier) Apply(ctx context.Context, migConfig v1.MigConfigSpecSlice) (*Result, error) {
+	deadline, cancel := withTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	result := &Result{}
+	a.plan(deadline, migConfig, result)
+	err := a.runHooks(deadline, result, func() error {
+		return a.apply(ctx, deadline, migConfig, result)
+	})
+	return result, err
+}
+
+func (a *Applier) apply(ctx, deadline context.Context, migConfig v1.MigConfigSpecSlice, result *Result) error {
+	asserter := a.Asserter()
+
+	log.Debugf("Checking current MIG mode...")
+	_, err := asserter.AssertMigMode(ctx, migConfig)
+	if err != nil {
+		log.Debugf("Applying MIG mode change...")
+		err = a.applyMigMode(ctx, deadline, migConfig, result)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.modeOnly {
+		return nil
+	}
+
+	log.Debugf("Checking current MIG device configuration...")
+	_, err = asserter.AssertMigConfig(ctx, migConfig)
+	if err != nil {
+		log.Debugf("Applying MIG device configuration...")
+		err = a.applyMigConfig(ctx, deadline, migConfig, result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ApplyMigMode applies only the MIG mode of migConfig to the GPUs of the node,
+// resetting them if necessary. No hooks are run.
+func (a *Applier) ApplyMigMode(ctx context.Context, migConfig v1.MigConfigSpecSlice) (*Result, error) {
+	deadline, cancel := withTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	result := &Result{}
+	err := a.withoutHooks().applyMigMode(ctx, deadline, migConfig, result)
+	return result, err
+}
+
+// ApplyMigConfig applies only the MIG devices of migConfig to the GPUs of the
+// node. The MIG mode of each GPU must already match migConfig. No hooks are
+// run.
+func (a *Applier) ApplyMigConfig(ctx context.Context, migConfig v1.MigConfigSpecSlice) (*Result, error) {
+	deadline, cancel := withTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	result := &Result{}
+	err := a.withoutHooks().applyMigConfig(ctx, deadline, migConfig, result)
+	return result, err
+}
+
+// RebootRequired returns whether a MIG mode change on any GPU only takes
+// effect after a reboot of the node.
+func (r *Result) RebootRequired() bool {
+	for _, gpu := range r.GPUs {
+		if gpu.RebootRequired {
+			return true
+		}
+	}
+	return false
+}
+
+// affectedGPUs returns the GPUs whose MIG mode or MIG devices were changed,
+// or that were reset.
+func (r *Result) affectedGPUs() []int {
+	var gpus []int
+	for _, gpu := range r.GPUs {
+		if gpu.MigModeChanged || gpu.Reset || gpu.ResetError != nil || gpu.MigDevicesChanged {
+			gpus = append(gpus, gpu.GPU)
+		}
+	}
+	return gpus
+}
+
+// gpu returns the result for the given GPU, adding it if not yet present. The
+// returned pointer is only valid until the next call.
+func (r *Result) gpu(i int, d types.DeviceID) *GPUResult {
+	for j := range r.GPUs {
+		if r.GPUs[j].GPU == i {
+			return &r.GPUs[j]
+		}
+	}
+	r.GPUs = append(r.GPUs, GPUResult{GPU: i, DeviceID: d})
+	return &r.GPUs[len(r.GPUs)-1]
+}
+
+func withTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, timeout)
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/assert"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type mockHooks struct {
+	called   []string
+	statuses map[string]*HookStatus
+	fail     string
+	empty    bool
+}
+
+func (h *mockHooks) run(name string, status *HookStatus) error {
+	h.called = append(h.called, name)
+	if h.statuses == nil {
+		h.statuses = make(map[string]*HookStatus)
+	}
+	h.statuses[name] = status
+	if name == h.fail {
+		return errors.New("hook failed")
+	}
+	return nil
+}
+
+func (h *mockHooks) reset() {
+	h.called = nil
+	h.statuses = nil
+}
+
+func (h *mockHooks) Empty() bool { return h.empty }
+func (h *mockHooks) ApplyStart(ctx context.Context, s *HookStatus) error {
+	return h.run("apply-start", s)
+}
+func (h *mockHooks) PreApplyMode(ctx context.Context, s *HookStatus) error {
+	return h.run("pre-apply-mode", s)
+}
+func (h *mockHooks) PostApplyMode(ctx context.Context, s *HookStatus) error {
+	return h.run("post-apply-mode", s)
+}
+func (h *mockHooks) PreApplyConfig(ctx context.Context, s *HookStatus) error {
+	return h.run("pre-apply-config", s)
+}
+func (h *mockHooks) PostApplyConfig(ctx context.Context, s *HookStatus) error {
+	return h.run("post-apply-config", s)
+}
+func (h *mockHooks) PreGPU(ctx context.Context, s *HookStatus) error  { return h.run("pre-gpu", s) }
+func (h *mockHooks) PostGPU(ctx context.Context, s *HookStatus) error { return h.run("post-gpu", s) }
+func (h *mockHooks) OnFailure(ctx context.Context, s *HookStatus) error {
+	return h.run("on-failure", s)
+}
+func (h *mockHooks) ApplyExit(ctx context.Context, s *HookStatus) error {
+	return h.run("apply-exit", s)
+}
+
+func newMockApplier(hooks Hooks, opts ...Option) (*Applier, *nvml.MockLunaServer) {
+	server := nvml.NewMockNVMLOnLunaServer().(*nvml.MockLunaServer)
+	opts = append([]Option{
+		WithModeManager(mode.NewNvmlMigModeManagerWith(server)),
+		WithConfigManager(config.NewNvmlMigConfigManagerWith(server)),
+		WithGPUEnumerator(enumerator.NewMockGPUs(len(server.Devices))),
+		WithHooks(hooks),
+		WithUUIDGetter(config.NewNvmlMigConfigManagerWith(server).(config.UUIDGetter)),
+	}, opts...)
+	return New(opts...), server
+}
+
+// gpuHooks returns the per-GPU hooks expected to run for count GPUs.
+func gpuHooks(count int) []string {
+	var hooks []string
+	for i := 0; i < count; i++ {
+		hooks = append(hooks, "pre-gpu", "post-gpu")
+	}
+	return hooks
+}
+
+func concat(lists ...[]string) []string {
+	var result []string
+	for _, list := range lists {
+		result = append(result, list...)
+	}
+	return result
+}
+
+// withoutResults returns a copy of status without its results and plan, for
+// comparing the rest of it.
+func withoutResults(status *HookStatus) *HookStatus {
+	s := *status
+	s.Results = nil
+	s.Plan = nil
+	return &s
+}
+
+func allGPUs(enabled bool, devices types.MigConfig) v1.MigConfigSpecSlice {
+	return v1.MigConfigSpecSlice{
+		{
+			Devices:    "all",
+			MigEnabled: enabled,
+			MigDevices: devices,
+		},
+	}
+}
+
+func TestApply(t *testing.T) {
+	hooks := &mockHooks{}
+	applier, _ := newMockApplier(hooks)
+	migConfig := allGPUs(true, types.MigConfig{"1g.5gb": 7})
+
+	result, err := applier.Apply(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from Apply")
+	require.Equal(t, concat(
+		[]string{"apply-start", "pre-apply-mode"}, gpuHooks(8), []string{"post-apply-mode"},
+		[]string{"pre-apply-config"}, gpuHooks(8), []string{"post-apply-config", "apply-exit"},
+	), hooks.called)
+	require.Len(t, result.GPUs, 8)
+
+	all := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	uuids := []string{"GPU-abcd-0", "GPU-abcd-1", "GPU-abcd-2", "GPU-abcd-3", "GPU-abcd-4", "GPU-abcd-5", "GPU-abcd-6", "GPU-abcd-7"}
+	require.Equal(t, &HookStatus{GPUs: all, UUIDs: uuids}, withoutResults(hooks.statuses["pre-apply-mode"]))
+	require.Equal(t, &HookStatus{Outcome: HookOutcomeSuccess, GPUs: all, UUIDs: uuids}, withoutResults(hooks.statuses["post-apply-config"]))
+	require.Equal(t, &HookStatus{Outcome: HookOutcomeSuccess, GPUs: []int{7}, UUIDs: []string{"GPU-abcd-7"}}, withoutResults(hooks.statuses["post-gpu"]))
+	require.Equal(t, &HookStatus{Outcome: HookOutcomeSuccess, GPUs: all, UUIDs: uuids}, withoutResults(hooks.statuses["apply-exit"]))
+	require.Len(t, hooks.statuses["post-gpu"].Results, 1)
+	require.Equal(t, 7, hooks.statuses["post-gpu"].Results[0].GPU)
+	require.Equal(t, result.GPUs, hooks.statuses["apply-exit"].Results)
+	for i, gpu := range result.GPUs {
+		require.Equal(t, i, gpu.GPU)
+		require.True(t, gpu.MigCapable)
+		require.True(t, gpu.MigModeChanged)
+		require.True(t, gpu.MigDevicesChanged)
+	}
+
+	_, err = applier.Asserter().AssertMigConfig(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from AssertMigConfig after Apply")
+
+	hooks.reset()
+	result, err = applier.Apply(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from second Apply")
+	require.Equal(t, []string{"apply-start", "apply-exit"}, hooks.called)
+	require.Len(t, result.GPUs, 0)
+}
+
+func TestApplyModeOnly(t *testing.T) {
+	applier, _ := newMockApplier(nil, WithModeOnly(true))
+	migConfig := allGPUs(true, types.MigConfig{"1g.5gb": 7})
+
+	_, err := applier.Apply(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from Apply")
+
+	_, err = applier.Asserter().AssertMigMode(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from AssertMigMode")
+
+	result, err := applier.Asserter().AssertMigConfig(context.Background(), migConfig)
+	require.True(t, errors.Is(err, assert.ErrNotApplied), "Unexpected error from AssertMigConfig: %v", err)
+	require.False(t, result.Matches())
+}
+
+func TestApplyMigConfigModeEnabled(t *testing.T) {
+	applier, _ := newMockApplier(nil)
+
+	_, err := applier.ApplyMigMode(context.Background(), allGPUs(true, nil))
+	require.Nil(t, err, "Unexpected failure from ApplyMigMode")
+
+	// A MIG mode mismatch does not call for a reboot
+	_, err = applier.ApplyMigConfig(context.Background(), allGPUs(false, nil))
+	require.True(t, errors.Is(err, types.ErrMigModeEnabled), "Unexpected error from ApplyMigConfig: %v", err)
+	require.False(t, errors.Is(err, types.ErrRebootRequired), "Unexpected error from ApplyMigConfig: %v", err)
+}
+
+func TestApplyHookFailure(t *testing.T) {
+	hooks := &mockHooks{fail: "pre-apply-config"}
+	applier, _ := newMockApplier(hooks)
+	migConfig := allGPUs(true, types.MigConfig{"1g.5gb": 7})
+
+	_, err := applier.Apply(context.Background(), migConfig)
+	require.NotNil(t, err, "Unexpected success from Apply")
+	require.Equal(t, concat(
+		[]string{"apply-start", "pre-apply-mode"}, gpuHooks(8), []string{"post-apply-mode"},
+		[]string{"pre-apply-config", "on-failure", "apply-exit"},
+	), hooks.called)
+	require.Equal(t, HookOutcomeFailure, hooks.statuses["on-failure"].Outcome)
+	require.Equal(t, err, hooks.statuses["apply-exit"].Err)
+	require.Len(t, hooks.statuses["apply-exit"].GPUs, 8)
+
+	_, err = applier.Asserter().AssertMigMode(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from AssertMigMode")
+}
+
+func TestApplyCanceled(t *testing.T) {
+	hooks := &mockHooks{}
+	applier, _ := newMockApplier(hooks)
+	migConfig := allGPUs(true, types.MigConfig{"1g.5gb": 7})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := applier.ApplyMigMode(ctx, migConfig)
+	require.True(t, errors.Is(err, types.ErrCanceled), "Unexpected error from ApplyMigMode: %v", err)
+	require.Len(t, result.GPUs, 0)
+}
+
+// stuckModeManager reports the MIG mode change of some GPUs as pending until
+// they are reset, and of the others as pending forever.
+type stuckModeManager struct {
+	mode.Manager
+	stuck map[int]bool
+	reset map[int]bool
+}
+
+func (m *stuckModeManager) IsMigModeChangePending(ctx context.Context, gpu int) (bool, error) {
+	return m.stuck[gpu] || !m.reset[gpu], nil
+}
+
+type mockResetter struct {
+	manager *stuckModeManager
+	fail    int
+}
+
+func (r *mockResetter) Reset(ctx context.Context, gpus []enumerator.GPU, pending map[int]bool) ([]ResetResult, error) {
+	var results []ResetResult
+	for _, gpu := range gpus {
+		if !pending[gpu.Index] {
+			continue
+		}
+		result := ResetResult{GPU: gpu.Index, Method: ResetMethodFlr}
+		if gpu.Index == r.fail {
+			result.Err = errors.New("reset failed")
+		} else {
+			r.manager.reset[gpu.Index] = true
+		}
+		results = append(results, result)
+	}
+	return results, resetError(results)
+}
+
+func TestApplyRebootRequired(t *testing.T) {
+	server := nvml.NewMockNVMLOnLunaServer().(*nvml.MockLunaServer)
+	manager := &stuckModeManager{
+		Manager: mode.NewNvmlMigModeManagerWith(server),
+		stuck:   map[int]bool{2: true},
+		reset:   make(map[int]bool),
+	}
+	applier := New(
+		WithModeManager(manager),
+		WithConfigManager(config.NewNvmlMigConfigManagerWith(server)),
+		WithGPUEnumerator(enumerator.NewMockGPUs(len(server.Devices))),
+		WithResetter(&mockResetter{manager: manager, fail: 5}),
+	)
+
+	result, err := applier.ApplyMigMode(context.Background(), allGPUs(true, types.MigConfig{}))
+	require.True(t, errors.Is(err, types.ErrRebootRequired), "Unexpected error from ApplyMigMode: %v", err)
+	require.True(t, result.RebootRequired())
+	require.Len(t, result.GPUs, 8)
+	for _, gpu := range result.GPUs {
+		switch gpu.GPU {
+		case 2:
+			require.True(t, gpu.Reset)
+			require.True(t, gpu.RebootRequired)
+			require.Contains(t, gpu.RebootReason, "still pending")
+		case 5:
+			require.False(t, gpu.Reset)
+			require.NotNil(t, gpu.ResetError)
+			require.True(t, gpu.RebootRequired)
+			require.Contains(t, gpu.RebootReason, "reset failed")
+		default:
+			require.True(t, gpu.Reset)
+			require.False(t, gpu.MigModeChangePending)
+			require.False(t, gpu.RebootRequired)
+		}
+	}
+
+	manager.stuck = nil
+	manager.reset = make(map[int]bool)
+	applier.resetter = &mockResetter{manager: manager, fail: -1}
+
+	result, err = applier.ApplyMigMode(context.Background(), allGPUs(false, types.MigConfig{}))
+	require.Nil(t, err, "Unexpected failure from ApplyMigMode")
+	require.False(t, result.RebootRequired())
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// Clear destroys all MIG devices on the GPUs of the Applier, leaving their MIG
+// mode unchanged. GPUs that are not MIG capable or have MIG mode disabled are
+// skipped. The MIG devices destroyed on each GPU are reported in the
+// ClearedMigDevices of its result.
+//
+// Hooks are run just as if a configuration without MIG devices was being
+// applied, except for those around MIG mode changes.
+func (a *Applier) Clear(ctx context.Context) (*Result, error) {
+	deadline, cancel := withTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	result := &Result{}
+	err := a.runHooks(deadline, result, func() error {
+		return a.clear(ctx, deadline, result)
+	})
+	return result, err
+}
+
+// Reset resets all GPUs of the Applier with its Resetter, regardless of
+// whether a MIG mode change is pending on them, and checks that any pending
+// MIG mode change took effect.
+//
+// Hooks are run just as if a MIG mode change was being applied to all GPUs,
+// except for the pre-gpu and post-gpu hooks, as GPUs connected through NVLink
+// can only be reset together.
+func (a *Applier) Reset(ctx context.Context) (*Result, error) {
+	deadline, cancel := withTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	result := &Result{}
+	err := a.runHooks(deadline, result, func() error {
+		return a.reset(ctx, deadline, result)
+	})
+	return result, err
+}
+
+func (a *Applier) clear(stop, deadline context.Context, result *Result) error {
+	gpus, err := a.gpus.GetGPUs()
+	if err != nil {
+		return fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+
+	ctx, cancel := withTimeout(deadline, a.configTimeout)
+	defer cancel()
+
+	var toClear []int
+	current := make(map[int]types.MigConfig)
+	deviceIDs := make(map[int]types.DeviceID)
+	for _, gpu := range gpus {
+		i := gpu.Index
+		if stop.Err() != nil {
+			return types.NewContextError(i, stop.Err())
+		}
+
+		d := types.NewDeviceID(gpu.Device, gpu.Vendor)
+		log.Debugf("Checking MIG devices of GPU %v", i)
+
+		capable, err := a.modeManager.IsMigCapable(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error checking MIG capable: %w", err)
+		}
+		result.gpu(i, d).MigCapable = capable
+		if !capable {
+			log.Debugf("    Skipping -- non MIG-capable GPU")
+			continue
+		}
+
+		m, err := a.modeManager.GetMigMode(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error getting MIG mode: %w", err)
+		}
+		if m != mode.Enabled {
+			log.Debugf("    Skipping -- MIG mode disabled")
+			continue
+		}
+
+		config, err := a.configManager.GetMigConfig(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error getting MIGConfig: %w", err)
+		}
+		if len(config.Flatten()) == 0 {
+			log.Debugf("    Skipping -- no MIG devices")
+			continue
+		}
+
+		toClear = append(toClear, i)
+		current[i] = config
+		deviceIDs[i] = d
+	}
+
+	if len(toClear) == 0 {
+		return nil
+	}
+
+	return a.reconfigureGPUs(ctx, stop, deadline, toClear, deviceIDs, result, func(i int) error {
+		log.Debugf("  GPU %v: Clearing MIG devices: %v", i, current[i])
+		_, err := a.configManager.ClearAndGetInstancesToCreate(ctx, i, nil)
+		if err != nil {
+			return fmt.Errorf("error clearing MIG devices on GPU %v: %w", i, err)
+		}
+		result.gpu(i, deviceIDs[i]).MigDevicesChanged = true
+		result.gpu(i, deviceIDs[i]).ClearedMigDevices = current[i]
+		return nil
+	})
+}
+
+func (a *Applier) reset(stop, deadline context.Context, result *Result) error {
+	gpus, err := a.gpus.GetGPUs()
+	if err != nil {
+		return fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+
+	ctx, cancel := withTimeout(deadline, a.modeTimeout)
+	defer cancel()
+
+	var selected []int
+	all := make(map[int]bool)
+	pending := make(map[int]bool)
+	for _, gpu := range gpus {
+		i := gpu.Index
+		if stop.Err() != nil {
+			return types.NewContextError(i, stop.Err())
+		}
+		all[i] = true
+		selected = append(selected, i)
+
+		capable, err := a.modeManager.IsMigCapable(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error checking MIG capable: %w", err)
+		}
+		gpuResult := result.gpu(i, types.NewDeviceID(gpu.Device, gpu.Vendor))
+		gpuResult.MigCapable = capable
+		if !capable {
+			continue
+		}
+
+		pending[i], err = a.modeManager.IsMigModeChangePending(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error checking pending MIG mode change: %w", err)
+		}
+		gpuResult.MigModeChangePending = pending[i]
+	}
+
+	if len(selected) == 0 {
+		return nil
+	}
+
+	err = a.runPreHook(deadline, "pre-apply-mode", a.hooks.PreApplyMode, result, selected)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Resetting GPUs...")
+	err = a.resetGPUs(deadline, gpus, all, pending, result)
+	return a.runPostHook(deadline, "post-apply-mode", a.hooks.PostApplyMode, result, selected, err)
+}
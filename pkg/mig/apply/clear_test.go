@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClear(t *testing.T) {
+	hooks := &mockHooks{}
+	applier, server := newMockApplier(hooks, WithGPUEnumerator(enumerator.NewMockGPUs(4)))
+
+	_, err := applier.Apply(context.Background(), allGPUs(true, types.MigConfig{"1g.5gb": 3, "3g.20gb": 1}))
+	require.Nil(t, err, "Unexpected failure from Apply")
+
+	hooks.reset()
+	result, err := applier.Clear(context.Background())
+	require.Nil(t, err, "Unexpected failure from Clear")
+	require.Equal(t, concat([]string{"apply-start", "pre-apply-config"}, gpuHooks(4), []string{"post-apply-config", "apply-exit"}), hooks.called)
+	require.Equal(t, []int{0, 1, 2, 3}, hooks.statuses["post-apply-config"].GPUs)
+	require.Len(t, result.GPUs, 4)
+	for i, gpu := range result.GPUs {
+		require.Equal(t, i, gpu.GPU)
+		require.True(t, gpu.MigDevicesChanged)
+		require.Equal(t, types.MigConfig{"1g.5gb": 3, "3g.20gb": 1}, gpu.ClearedMigDevices)
+	}
+
+	manager := config.NewNvmlMigConfigManagerWith(server)
+	for i := 0; i < 4; i++ {
+		current, err := manager.GetMigConfig(context.Background(), i)
+		require.Nil(t, err, "Unexpected failure from GetMigConfig")
+		require.Empty(t, current.Flatten(), "Unexpected MIG devices left on GPU %v", i)
+	}
+
+	hooks.reset()
+	result, err = applier.Clear(context.Background())
+	require.Nil(t, err, "Unexpected failure from second Clear")
+	require.Equal(t, []string{"apply-start", "apply-exit"}, hooks.called)
+	for _, gpu := range result.GPUs {
+		require.False(t, gpu.MigDevicesChanged)
+		require.Nil(t, gpu.ClearedMigDevices)
+	}
+}
+
+func TestReset(t *testing.T) {
+	hooks := &mockHooks{}
+	server := nvml.NewMockNVMLOnLunaServer().(*nvml.MockLunaServer)
+	manager := &stuckModeManager{
+		Manager: mode.NewNvmlMigModeManagerWith(server),
+		stuck:   map[int]bool{3: true},
+		reset:   make(map[int]bool),
+	}
+	applier := New(
+		WithModeManager(manager),
+		WithConfigManager(config.NewNvmlMigConfigManagerWith(server)),
+		WithGPUEnumerator(enumerator.NewMockGPUs(len(server.Devices))),
+		WithHooks(hooks),
+		WithResetter(&mockResetter{manager: manager, fail: -1}),
+	)
+
+	result, err := applier.Reset(context.Background())
+	require.True(t, errors.Is(err, types.ErrRebootRequired), "Unexpected error from Reset: %v", err)
+	require.Equal(t, []string{"apply-start", "pre-apply-mode", "post-apply-mode", "on-failure", "apply-exit"}, hooks.called)
+	require.Equal(t, HookOutcomeFailure, hooks.statuses["post-apply-mode"].Outcome)
+	require.Len(t, hooks.statuses["post-apply-mode"].GPUs, 8)
+	require.Len(t, result.GPUs, 8)
+	for _, gpu := range result.GPUs {
+		require.True(t, gpu.Reset)
+		require.Equal(t, gpu.GPU == 3, gpu.RebootRequired)
+	}
+
+	// GPUs are reset even without a pending MIG mode change
+	manager.stuck = nil
+	result, err = applier.Reset(context.Background())
+	require.Nil(t, err, "Unexpected failure from Reset")
+	require.Len(t, result.GPUs, 8)
+	for _, gpu := range result.GPUs {
+		require.False(t, gpu.MigModeChangePending)
+		require.True(t, gpu.Reset)
+		require.False(t, gpu.RebootRequired)
+	}
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/pkg/mig/assert"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+func (a *Applier) applyMigConfig(stop, deadline context.Context, migConfig v1.MigConfigSpecSlice, result *Result) error {
+	ctx, cancel := withTimeout(deadline, a.configTimeout)
+	defer cancel()
+
+	var gpus []int
+	desired := make(map[int]types.MigConfig)
+	deviceIDs := make(map[int]types.DeviceID)
+	err := assert.WalkSelectedMigConfigForEachGPU(stop, a.gpus, migConfig, func(mc *v1.MigConfigSpec, i int, d types.DeviceID) error {
+		capable, err := a.modeManager.IsMigCapable(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error checking MIG capable: %w", err)
+		}
+		log.Debugf("    MIG capable: %v\n", capable)
+		result.gpu(i, d).MigCapable = capable
+
+		if !capable && !mc.MigEnabled {
+			log.Debugf("    Skipping -- non MIG-capable GPU with MIG mode disabled")
+			return nil
+		}
+
+		if !capable && mc.MigEnabled {
+			return types.NewError(types.ErrorCategoryNotMigCapable, i, "cannot set MIG config on non MIG-capable GPU")
+		}
+
+		m, err := a.modeManager.GetMigMode(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error getting MIG mode: %w", err)
+		}
+
+		if mc.MigEnabled && m == mode.Disabled {
+			return types.NewError(types.ErrorCategoryMigModeDisabled, i, "unable to apply MIG config with MIG mode disabled")
+		}
+
+		if !mc.MigEnabled && m == mode.Enabled {
+			return types.NewError(types.ErrorCategoryMigModeEnabled, i, "MIG mode is currently enabled, but the configuration specifies it should be disabled")
+		}
+
+		if !mc.MigEnabled {
+			log.Debugf("    Skipping MIG config -- MIG disabled")
+			return nil
+		}
+
+		current, err := a.configManager.GetMigConfig(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error getting MIGConfig: %w", err)
+		}
+
+		if current.Equals(mc.MigDevices) {
+			log.Debugf("    Skipping -- already set to desired value")
+			return nil
+		}
+
+		gpus = append(gpus, i)
+		desired[i] = mc.MigDevices
+		deviceIDs[i] = d
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(gpus) == 0 {
+		return nil
+	}
+
+	return a.reconfigureGPUs(ctx, stop, deadline, gpus, deviceIDs, result, func(i int) error {
+		log.Debugf("  GPU %v: Updating MIG config: %v", i, desired[i])
+		err := a.configManager.SetMigConfig(ctx, i, desired[i])
+		if err != nil {
+			return fmt.Errorf("error setting MIGConfig on GPU %v: %w", i, err)
+		}
+		result.gpu(i, deviceIDs[i]).MigDevicesChanged = true
+		return nil
+	})
+}
+
+// reconfigureGPUs changes the MIG devices of gpus by calling f for each of
+// them, once no processes are running on them (see checkProcesses). The
+// pre-apply-config and post-apply-config hooks are run around all GPUs, and
+// the pre-gpu and post-gpu hooks around each GPU.
+func (a *Applier) reconfigureGPUs(ctx, stop, deadline context.Context, gpus []int, deviceIDs map[int]types.DeviceID, result *Result, f func(int) error) error {
+	err := a.runPreHook(deadline, "pre-apply-config", a.hooks.PreApplyConfig, result, gpus)
+	if err != nil {
+		return err
+	}
+
+	err = a.reconfigureEachGPU(ctx, stop, deadline, gpus, deviceIDs, result, f)
+	return a.runPostHook(deadline, "post-apply-config", a.hooks.PostApplyConfig, result, gpus, err)
+}
+
+func (a *Applier) reconfigureEachGPU(ctx, stop, deadline context.Context, gpus []int, deviceIDs map[int]types.DeviceID, result *Result, f func(int) error) error {
+	log.Debugf("Checking for processes running on GPUs to be reconfigured...")
+	inUse, err := a.checkProcesses(ctx, stop, gpus)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range gpus {
+		if stop.Err() != nil {
+			return types.NewContextError(i, stop.Err())
+		}
+		result.gpu(i, deviceIDs[i]).Processes = inUse[i]
+
+		err := a.runPreHook(deadline, "pre-gpu", a.hooks.PreGPU, result, []int{i})
+		if err != nil {
+			return err
+		}
+		err = a.runPostHook(deadline, "post-gpu", a.hooks.PostGPU, result, []int{i}, f(i))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkProcesses checks if any compute processes are running on the given
+// GPUs (or their MIG devices) before their MIG devices are torn down. If
+// processes are found, it either proceeds (force), waits for them to exit
+// (in-use timeout), or fails with the list of offending processes. Waiting is
+// abandoned early if ctx is done or stop is canceled. The processes found
+// running when proceeding are returned.
+func (a *Applier) checkProcesses(ctx, stop context.Context, gpus []int) (map[int][]config.Process, error) {
+	deadline := time.Now().Add(a.inUseTimeout)
+	for {
+		inUse, err := a.getProcesses(ctx, gpus)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(inUse) == 0 {
+			return nil, nil
+		}
+
+		if a.force {
+			log.Warnf("Forcing MIG reconfiguration with running processes: %v", formatProcesses(gpus, inUse))
+			return inUse, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, types.NewError(types.ErrorCategoryInUse, -1, "processes still running on GPUs to be reconfigured: %v", formatProcesses(gpus, inUse))
+		}
+
+		log.Debugf("  Waiting for processes to exit: %v", formatProcesses(gpus, inUse))
+		select {
+		case <-ctx.Done():
+			return nil, types.NewContextError(-1, ctx.Err())
+		case <-stop.Done():
+			return nil, types.NewContextError(-1, stop.Err())
+		case <-time.After(inUsePollInterval):
+		}
+	}
+}
+
+func (a *Applier) getProcesses(ctx context.Context, gpus []int) (map[int][]config.Process, error) {
+	inUse := make(map[int][]config.Process)
+	for _, i := range gpus {
+		processes, err := a.configManager.GetComputeProcesses(ctx, i)
+		if err != nil {
+			return nil, fmt.Errorf("error getting running processes on GPU %v: %w", i, err)
+		}
+		if len(processes) > 0 {
+			inUse[i] = processes
+		}
+	}
+	return inUse, nil
+}
+
+func formatProcesses(gpus []int, inUse map[int][]config.Process) string {
+	var gpuStrings []string
+	for _, i := range gpus {
+		if len(inUse[i]) == 0 {
+			continue
+		}
+		var processStrings []string
+		for _, p := range inUse[i] {
+			processStrings = append(processStrings, p.String())
+		}
+		gpuStrings = append(gpuStrings, fmt.Sprintf("GPU %v: [%v]", i, strings.Join(processStrings, ", ")))
+	}
+	return strings.Join(gpuStrings, ", ")
+}
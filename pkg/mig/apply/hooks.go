@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// HookOutcome is the outcome of the stage a hook reports on.
+type HookOutcome string
+
+// Outcomes reported to hooks. Hooks run before a stage have no outcome.
+const (
+	HookOutcomeNone    HookOutcome = ""
+	HookOutcomeSuccess HookOutcome = "success"
+	HookOutcomeFailure HookOutcome = "failure"
+)
+
+// HookStatus describes the stage a hook is run for: the GPUs it affects
+// and, for hooks run after it, its outcome and error. UUIDs is only set if
+// the UUIDs of all GPUs could be looked up, in the same order as GPUs.
+// Results holds what was done so far to those of the GPUs already visited,
+// and Plan the changes found to be needed before applying, if any.
+type HookStatus struct {
+	Outcome HookOutcome
+	Err     error
+	GPUs    []int
+	UUIDs   []string
+	Results []GPUResult
+	Plan    *Plan
+}
+
+// Hooks are run at well defined points while applying a MIG configuration.
+// Except for OnFailure and ApplyExit, the context passed to each hook is
+// bounded by the overall timeout of the Applier.
+//
+// PreGPU and PostGPU are run around the MIG mode change and around the MIG
+// device change of each GPU whose MIG mode or MIG devices are changed.
+// OnFailure is run before ApplyExit when applying fails. An error from a hook
+// run before a stage aborts it; an error from a hook run after a stage that
+// succeeded is returned in its place.
+//
+// Empty returns whether no hooks would run at all, in which case the Plan
+// passed to them is not computed.
+type Hooks interface {
+	Empty() bool
+	ApplyStart(ctx context.Context, status *HookStatus) error
+	PreApplyMode(ctx context.Context, status *HookStatus) error
+	PostApplyMode(ctx context.Context, status *HookStatus) error
+	PreApplyConfig(ctx context.Context, status *HookStatus) error
+	PostApplyConfig(ctx context.Context, status *HookStatus) error
+	PreGPU(ctx context.Context, status *HookStatus) error
+	PostGPU(ctx context.Context, status *HookStatus) error
+	OnFailure(ctx context.Context, status *HookStatus) error
+	ApplyExit(ctx context.Context, status *HookStatus) error
+}
+
+type hookFunc func(ctx context.Context, status *HookStatus) error
+
+type noopHooks struct{}
+
+func (noopHooks) Empty() bool                                                   { return true }
+func (noopHooks) ApplyStart(ctx context.Context, status *HookStatus) error      { return nil }
+func (noopHooks) PreApplyMode(ctx context.Context, status *HookStatus) error    { return nil }
+func (noopHooks) PostApplyMode(ctx context.Context, status *HookStatus) error   { return nil }
+func (noopHooks) PreApplyConfig(ctx context.Context, status *HookStatus) error  { return nil }
+func (noopHooks) PostApplyConfig(ctx context.Context, status *HookStatus) error { return nil }
+func (noopHooks) PreGPU(ctx context.Context, status *HookStatus) error          { return nil }
+func (noopHooks) PostGPU(ctx context.Context, status *HookStatus) error         { return nil }
+func (noopHooks) OnFailure(ctx context.Context, status *HookStatus) error       { return nil }
+func (noopHooks) ApplyExit(ctx context.Context, status *HookStatus) error       { return nil }
+
+// withoutHooks returns a copy of the Applier that runs no hooks.
+func (a *Applier) withoutHooks() *Applier {
+	b := *a
+	b.hooks = noopHooks{}
+	return &b
+}
+
+// runHooks runs f between the apply-start and apply-exit hooks, running the
+// on-failure hook as well if f fails.
+func (a *Applier) runHooks(deadline context.Context, result *Result, f func() error) (rerr error) {
+	gpus, err := a.gpus.GetGPUs()
+	if err != nil {
+		return fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+	var selected []int
+	for _, gpu := range gpus {
+		selected = append(selected, gpu.Index)
+	}
+
+	log.Debugf("Running apply-start hook")
+	err = a.hooks.ApplyStart(deadline, a.hookStatus(deadline, result, selected))
+	if err != nil {
+		return fmt.Errorf("error running apply-start hook: %w", err)
+	}
+
+	defer func() {
+		status := a.hookStatus(context.Background(), result, result.affectedGPUs()).done(rerr)
+		if rerr != nil {
+			log.Debugf("Running on-failure hook")
+			err := a.hooks.OnFailure(context.Background(), status)
+			if err != nil {
+				log.Errorf("Error running on-failure hook: %v", err)
+			}
+		}
+
+		log.Debugf("Running apply-exit hook")
+		err := a.hooks.ApplyExit(context.Background(), status)
+		if rerr == nil && err != nil {
+			rerr = fmt.Errorf("error running apply-exit hook: %w", err)
+			return
+		}
+		if err != nil {
+			log.Errorf("Error running apply-exit hook: %v", err)
+		}
+	}()
+
+	return f()
+}
+
+// runPreHook runs a hook before a stage affecting the given GPUs.
+func (a *Applier) runPreHook(ctx context.Context, name string, hook hookFunc, result *Result, gpus []int) error {
+	log.Debugf("Running %v hook", name)
+	err := hook(ctx, a.hookStatus(ctx, result, gpus))
+	if err != nil {
+		return fmt.Errorf("error running %v hook: %w", name, err)
+	}
+	return nil
+}
+
+// runPostHook runs a hook after a stage affecting the given GPUs ended with
+// err. It returns err, or the error of the hook if the stage succeeded.
+func (a *Applier) runPostHook(ctx context.Context, name string, hook hookFunc, result *Result, gpus []int, err error) error {
+	log.Debugf("Running %v hook", name)
+	hookErr := hook(ctx, a.hookStatus(ctx, result, gpus).done(err))
+	if hookErr == nil {
+		return err
+	}
+	if err != nil {
+		log.Errorf("Error running %v hook: %v", name, hookErr)
+		return err
+	}
+	return fmt.Errorf("error running %v hook: %w", name, hookErr)
+}
+
+// hookStatus returns the status to pass to a hook run before a stage
+// affecting the given GPUs. UUIDs looked up are remembered in result, as GPUs
+// may not be reachable through NVML later on, e.g. while being reset.
+func (a *Applier) hookStatus(ctx context.Context, result *Result, gpus []int) *HookStatus {
+	status := &HookStatus{GPUs: gpus, Plan: result.Plan}
+	for _, i := range gpus {
+		for _, gpu := range result.GPUs {
+			if gpu.GPU == i {
+				status.Results = append(status.Results, gpu)
+			}
+		}
+	}
+
+	if a.uuidGetter == nil {
+		return status
+	}
+
+	var uuids []string
+	for _, i := range gpus {
+		uuid, exists := result.uuids[i]
+		if !exists {
+			var err error
+			uuid, err = a.uuidGetter.GetGpuUUID(ctx, i)
+			if err != nil {
+				log.Debugf("Unable to get UUID of GPU %v for hooks: %v", i, err)
+				return status
+			}
+			if result.uuids == nil {
+				result.uuids = make(map[int]string)
+			}
+			result.uuids[i] = uuid
+		}
+		uuids = append(uuids, uuid)
+	}
+	status.UUIDs = uuids
+
+	return status
+}
+
+// done returns a copy of the status for a hook run after a stage that ended
+// with err.
+func (s *HookStatus) done(err error) *HookStatus {
+	status := *s
+	status.Err = err
+	status.Outcome = HookOutcomeSuccess
+	if err != nil {
+		status.Outcome = HookOutcomeFailure
+	}
+	return &status
+}
@@ -0,0 +1,283 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/assert"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// modeChange is the MIG mode to set on a GPU.
+type modeChange struct {
+	gpu      int
+	deviceID types.DeviceID
+	current  mode.MigMode
+	desired  mode.MigMode
+}
+
+func (a *Applier) applyMigMode(stop, deadline context.Context, migConfig v1.MigConfigSpecSlice, result *Result) error {
+	gpus, err := a.gpus.GetGPUs()
+	if err != nil {
+		return fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+
+	ctx, cancel := withTimeout(deadline, a.modeTimeout)
+	defer cancel()
+
+	var changes []modeChange
+	err = assert.WalkSelectedMigConfigForEachGPU(stop, a.gpus, migConfig, func(mc *v1.MigConfigSpec, i int, d types.DeviceID) error {
+		capable, err := a.modeManager.IsMigCapable(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error checking MIG capable: %w", err)
+		}
+		log.Debugf("    MIG capable: %v\n", capable)
+		result.gpu(i, d).MigCapable = capable
+
+		if !capable && !mc.MigEnabled {
+			log.Debugf("    Skipping -- non MIG-capable GPU with MIG mode disabled")
+			return nil
+		}
+
+		m, err := a.modeManager.GetMigMode(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error getting MIG mode: %w", err)
+		}
+		log.Debugf("    Current MIG mode: %v", m)
+
+		desired := mode.Disabled
+		if mc.MigEnabled {
+			desired = mode.Enabled
+		}
+
+		changes = append(changes, modeChange{i, d, m, desired})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var changing []int
+	for _, c := range changes {
+		if c.current != c.desired {
+			changing = append(changing, c.gpu)
+		}
+	}
+
+	err = a.runPreHook(deadline, "pre-apply-mode", a.hooks.PreApplyMode, result, changing)
+	if err != nil {
+		return err
+	}
+
+	err = a.setMigModes(ctx, stop, deadline, gpus, changes, result)
+
+	affected := make(map[int]bool)
+	for _, i := range changing {
+		affected[i] = true
+	}
+	for _, gpu := range result.GPUs {
+		if gpu.Reset || gpu.ResetError != nil {
+			affected[gpu.GPU] = true
+		}
+	}
+	var affectedGPUs []int
+	for _, gpu := range gpus {
+		if affected[gpu.Index] {
+			affectedGPUs = append(affectedGPUs, gpu.Index)
+		}
+	}
+
+	return a.runPostHook(deadline, "post-apply-mode", a.hooks.PostApplyMode, result, affectedGPUs, err)
+}
+
+// setMigModes sets the MIG mode of each GPU, running the pre-gpu and
+// post-gpu hooks around those whose MIG mode changes, and resets the GPUs
+// whose MIG mode change is pending.
+func (a *Applier) setMigModes(ctx, stop, deadline context.Context, gpus []enumerator.GPU, changes []modeChange, result *Result) error {
+	pending := make(map[int]bool)
+	for _, c := range changes {
+		if stop.Err() != nil {
+			return types.NewContextError(c.gpu, stop.Err())
+		}
+
+		var err error
+		pending[c.gpu], err = a.setMigMode(ctx, deadline, c, result)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.skipReset || !anyTrue(pending) {
+		return nil
+	}
+
+	log.Debugf("At least one mode change pending")
+	log.Debugf("Resetting GPUs...")
+
+	return a.resetGPUs(deadline, gpus, pending, pending, result)
+}
+
+// setMigMode sets the MIG mode of a single GPU and returns whether the change
+// is pending.
+func (a *Applier) setMigMode(ctx, deadline context.Context, c modeChange, result *Result) (bool, error) {
+	changed := (c.current != c.desired)
+	if changed {
+		err := a.runPreHook(deadline, "pre-gpu", a.hooks.PreGPU, result, []int{c.gpu})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	pending, err := a.setMigModeOnGPU(ctx, c, result)
+
+	if changed {
+		err = a.runPostHook(deadline, "post-gpu", a.hooks.PostGPU, result, []int{c.gpu}, err)
+	}
+	return pending, err
+}
+
+func (a *Applier) setMigModeOnGPU(ctx context.Context, c modeChange, result *Result) (bool, error) {
+	log.Debugf("  GPU %v: Updating MIG mode: %v", c.gpu, c.desired)
+	err := a.modeManager.SetMigMode(ctx, c.gpu, c.desired)
+	if err != nil {
+		return false, fmt.Errorf("error setting MIG mode: %w", err)
+	}
+	result.gpu(c.gpu, c.deviceID).MigModeChanged = (c.current != c.desired)
+
+	pending, err := a.modeManager.IsMigModeChangePending(ctx, c.gpu)
+	if err != nil {
+		return false, fmt.Errorf("error checking pending MIG mode change: %w", err)
+	}
+	log.Debugf("    Mode change pending: %v", pending)
+	result.gpu(c.gpu, c.deviceID).MigModeChangePending = pending
+
+	return pending, nil
+}
+
+// resetGPUs resets the GPUs set in reset, waits for them to boot and checks
+// whether the MIG mode change of the GPUs set in check took effect.
+func (a *Applier) resetGPUs(deadline context.Context, gpus []enumerator.GPU, reset, check map[int]bool, result *Result) error {
+	resetCtx, resetCancel := withTimeout(deadline, a.resetTimeout)
+	defer resetCancel()
+
+	deviceIDs := make(map[int]types.DeviceID)
+	for _, gpu := range gpus {
+		deviceIDs[gpu.Index] = types.NewDeviceID(gpu.Device, gpu.Vendor)
+	}
+
+	resets, resetErr := a.resetter.Reset(resetCtx, gpus, reset)
+	for _, r := range resets {
+		if r.GPU < 0 {
+			if r.Err != nil {
+				log.Errorf("Error resetting GPU %v using %v: %v", r.Address, r.Method, r.Err)
+			}
+			continue
+		}
+		gpuResult := result.gpu(r.GPU, deviceIDs[r.GPU])
+		gpuResult.Reset = (r.Err == nil)
+		gpuResult.ResetMethod = r.Method
+		gpuResult.ResetError = r.Err
+		if r.Err != nil {
+			log.Errorf("Error resetting GPU %v (%v) using %v: %v", r.GPU, r.Address, r.Method, r.Err)
+			continue
+		}
+		log.Debugf("  GPU %v (%v): reset using %v", r.GPU, r.Address, r.Method)
+	}
+	if errors.Is(resetErr, types.ErrCanceled) || errors.Is(resetErr, types.ErrTimeout) {
+		return resetErr
+	}
+
+	if waiter, ok := a.modeManager.(mode.BootWaiter); ok {
+		log.Debugf("Waiting for GPUs to finish booting...")
+		for _, r := range resets {
+			if r.GPU < 0 || r.Err != nil {
+				continue
+			}
+			err := waiter.WaitForBoot(resetCtx, r.GPU)
+			if err != nil {
+				return fmt.Errorf("error waiting for GPU %v to boot after reset: %w", r.GPU, err)
+			}
+		}
+	}
+
+	err := a.checkRebootRequired(deadline, gpus, check, result)
+	if err != nil {
+		return err
+	}
+
+	return resetErr
+}
+
+// checkRebootRequired checks whether the MIG mode change of the pending GPUs
+// took effect after they were reset. If not (e.g. with GPU passthrough, or
+// when a GPU could not be reset), the node has to be rebooted instead, and an
+// ErrRebootRequired error is returned, with the reason for each GPU recorded
+// in result.
+func (a *Applier) checkRebootRequired(ctx context.Context, gpus []enumerator.GPU, pending map[int]bool, result *Result) error {
+	var required []string
+	for _, gpu := range gpus {
+		if !pending[gpu.Index] {
+			continue
+		}
+
+		stillPending, err := a.modeManager.IsMigModeChangePending(ctx, gpu.Index)
+		if err != nil {
+			return fmt.Errorf("error checking pending MIG mode change after reset: %w", err)
+		}
+
+		gpuResult := result.gpu(gpu.Index, types.NewDeviceID(gpu.Device, gpu.Vendor))
+		gpuResult.MigModeChangePending = stillPending
+		if !stillPending {
+			continue
+		}
+
+		reason := "MIG mode change still pending after GPU reset"
+		if gpuResult.ResetError != nil {
+			reason = fmt.Sprintf("GPU reset failed: %v", gpuResult.ResetError)
+		} else if !gpuResult.Reset {
+			reason = "GPU was not reset"
+		}
+		gpuResult.RebootRequired = true
+		gpuResult.RebootReason = reason
+		log.Warnf("Reboot required for GPU %v: %v", gpu.Index, reason)
+
+		required = append(required, fmt.Sprintf("%v", gpu.Index))
+	}
+
+	if len(required) > 0 {
+		return types.NewError(types.ErrorCategoryRebootRequired, -1, "reboot required for MIG mode change to take effect on GPU(s) %v", strings.Join(required, ","))
+	}
+
+	return nil
+}
+
+func anyTrue(set map[int]bool) bool {
+	for _, s := range set {
+		if s {
+			return true
+		}
+	}
+	return false
+}
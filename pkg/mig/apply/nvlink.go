@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// resetTarget is a GPU to reset through the NVIDIA driver. GPU is its index
+// among the enumerated GPUs, or -1 if it was not enumerated. Err is set if it
+// cannot be reset at all.
+type resetTarget struct {
+	GPU     int
+	Address string
+	Info    nvml.PciInfo
+	Err     error
+}
+
+// getResetTargets returns the GPUs to reset through the NVIDIA driver so that
+// the pending GPUs among gpus are reset: the pending GPUs themselves, and any
+// other GPU connected to one of them through NVLink, directly or through
+// NVSwitches, as the driver can only reset these together. NVML must already
+// be initialized.
+func getResetTargets(nvmlLib nvml.Interface, gpus []enumerator.GPU, pending map[int]bool) ([]resetTarget, error) {
+	count, ret := nvmlLib.DeviceGetCount()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(-1, ret.Value(), "error getting device count: %v", ret)
+	}
+
+	links := make(disjointSet)
+	var addresses []string
+	infos := make(map[string]nvml.PciInfo)
+	for i := 0; i < count; i++ {
+		device, ret := nvmlLib.DeviceGetHandleByIndex(i)
+		if ret.Value() != nvml.SUCCESS {
+			return nil, types.NewNvmlError(i, ret.Value(), "error getting device handle: %v", ret)
+		}
+
+		info, ret := device.GetPciInfo()
+		if ret.Value() != nvml.SUCCESS {
+			return nil, types.NewNvmlError(i, ret.Value(), "error getting PCI info: %v", ret)
+		}
+
+		address := info.Address()
+		addresses = append(addresses, address)
+		infos[address] = info
+		links.add(address)
+
+		for link := 0; link < nvml.NVLINK_MAX_LINKS; link++ {
+			state, ret := device.GetNvLinkState(link)
+			if ret.Value() != nvml.SUCCESS || state != nvml.FEATURE_ENABLED {
+				continue
+			}
+			remote, ret := device.GetNvLinkRemotePciInfo(link)
+			if ret.Value() != nvml.SUCCESS {
+				return nil, types.NewNvmlError(i, ret.Value(), "error getting remote PCI info of NVLink %v: %v", link, ret)
+			}
+			// The remote end is either another GPU or an NVSwitch. Joining
+			// both into the same set groups all GPUs sharing NVSwitches.
+			links.union(address, remote.Address())
+		}
+	}
+
+	indices := make(map[string]int)
+	groups := make(map[string]bool)
+	var targets []resetTarget
+	for _, gpu := range gpus {
+		indices[gpu.Address] = gpu.Index
+		if !pending[gpu.Index] {
+			continue
+		}
+		if _, exists := infos[gpu.Address]; !exists {
+			targets = append(targets, resetTarget{
+				GPU:     gpu.Index,
+				Address: gpu.Address,
+				Err:     types.NewError(types.ErrorCategoryNvml, gpu.Index, "GPU %v not found by NVML", gpu.Address),
+			})
+			continue
+		}
+		groups[links.find(gpu.Address)] = true
+	}
+
+	for _, address := range addresses {
+		if !groups[links.find(address)] {
+			continue
+		}
+		index, exists := indices[address]
+		if !exists {
+			index = -1
+		}
+		if index < 0 || !pending[index] {
+			log.Warnf("Also resetting GPU %v, which shares NVLinks with a GPU whose MIG mode changed", address)
+		}
+		targets = append(targets, resetTarget{GPU: index, Address: address, Info: infos[address]})
+	}
+
+	return targets, nil
+}
+
+// disjointSet is a union-find structure over PCI addresses.
+type disjointSet map[string]string
+
+func (s disjointSet) add(x string) {
+	if _, exists := s[x]; !exists {
+		s[x] = x
+	}
+}
+
+func (s disjointSet) find(x string) string {
+	s.add(x)
+	for s[x] != x {
+		s[x] = s[s[x]]
+		x = s[x]
+	}
+	return x
+}
+
+func (s disjointSet) union(x, y string) {
+	rx, ry := s.find(x), s.find(y)
+	if rx != ry {
+		s[ry] = rx
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/pkg/mig/assert"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// GPUPlan holds the current and desired state of a single GPU selected by a
+// MIG configuration. CurrentMigDevices is only known if MIG mode is currently
+// enabled on the GPU and the Applier applies MIG devices.
+type GPUPlan struct {
+	GPU               int
+	DeviceID          types.DeviceID
+	MigCapable        bool
+	CurrentMigEnabled bool
+	MigEnabled        bool
+	CurrentMigDevices types.MigConfig
+	MigDevices        types.MigConfig
+	MigModeChange     bool
+	MigDevicesChange  bool
+}
+
+// Plan holds the changes to the GPUs selected by a MIG configuration, as
+// found before applying it.
+type Plan struct {
+	GPUs []GPUPlan
+}
+
+// Plan returns the changes applying migConfig would make to the GPUs of the
+// node, without making any of them.
+func (a *Applier) Plan(ctx context.Context, migConfig v1.MigConfigSpecSlice) (*Plan, error) {
+	plan := &Plan{}
+	err := assert.WalkSelectedMigConfigForEachGPU(ctx, a.gpus, migConfig, func(mc *v1.MigConfigSpec, i int, d types.DeviceID) error {
+		p := GPUPlan{
+			GPU:        i,
+			DeviceID:   d,
+			MigEnabled: mc.MigEnabled,
+		}
+		if mc.MigEnabled && !a.modeOnly {
+			p.MigDevices = mc.MigDevices
+		}
+
+		capable, err := a.modeManager.IsMigCapable(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error checking MIG capable: %w", err)
+		}
+		p.MigCapable = capable
+
+		if capable {
+			m, err := a.modeManager.GetMigMode(ctx, i)
+			if err != nil {
+				return fmt.Errorf("error getting MIG mode: %w", err)
+			}
+			p.CurrentMigEnabled = (m == mode.Enabled)
+		}
+		p.MigModeChange = (p.CurrentMigEnabled != p.MigEnabled)
+
+		if p.CurrentMigEnabled && !a.modeOnly {
+			current, err := a.configManager.GetMigConfig(ctx, i)
+			if err != nil {
+				return fmt.Errorf("error getting MIGConfig: %w", err)
+			}
+			p.CurrentMigDevices = current
+		}
+		if p.MigEnabled && !a.modeOnly {
+			p.MigDevicesChange = !p.CurrentMigDevices.Equals(p.MigDevices)
+		}
+
+		plan.GPUs = append(plan.GPUs, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// MigModeChanges returns the GPUs whose MIG mode is to be changed.
+func (p *Plan) MigModeChanges() []int {
+	var gpus []int
+	for _, gpu := range p.GPUs {
+		if gpu.MigModeChange {
+			gpus = append(gpus, gpu.GPU)
+		}
+	}
+	return gpus
+}
+
+// MigDevicesChanges returns the GPUs that are to get new MIG devices.
+func (p *Plan) MigDevicesChanges() []int {
+	var gpus []int
+	for _, gpu := range p.GPUs {
+		if gpu.MigDevicesChange {
+			gpus = append(gpus, gpu.GPU)
+		}
+	}
+	return gpus
+}
+
+// plan sets the plan of result to the changes applying migConfig would make,
+// if there are hooks to pass it to. Failing to find them is not an error, as
+// applying may still succeed, e.g. if the apply-start hook loads the NVIDIA
+// driver.
+func (a *Applier) plan(ctx context.Context, migConfig v1.MigConfigSpecSlice, result *Result) {
+	if a.hooks.Empty() {
+		return
+	}
+	plan, err := a.Plan(ctx, migConfig)
+	if err != nil {
+		log.Warnf("Unable to plan MIG config changes for hooks: %v", err)
+		return
+	}
+	result.Plan = plan
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	hooks := &mockHooks{}
+	applier, _ := newMockApplier(hooks)
+	migConfig := allGPUs(true, types.MigConfig{"1g.5gb": 7})
+	all := []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+	plan, err := applier.Plan(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from Plan")
+	require.Len(t, plan.GPUs, 8)
+	require.Equal(t, all, plan.MigModeChanges())
+	require.Equal(t, all, plan.MigDevicesChanges())
+	for i, gpu := range plan.GPUs {
+		require.Equal(t, i, gpu.GPU)
+		require.True(t, gpu.MigCapable)
+		require.False(t, gpu.CurrentMigEnabled)
+		require.True(t, gpu.MigEnabled)
+		require.Nil(t, gpu.CurrentMigDevices)
+		require.Equal(t, types.MigConfig{"1g.5gb": 7}, gpu.MigDevices)
+	}
+
+	result, err := applier.Apply(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from Apply")
+	require.Equal(t, plan, result.Plan)
+	require.Equal(t, plan, hooks.statuses["apply-start"].Plan)
+	require.Equal(t, plan, hooks.statuses["apply-exit"].Plan)
+
+	plan, err = applier.Plan(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from Plan after Apply")
+	require.Empty(t, plan.MigModeChanges())
+	require.Empty(t, plan.MigDevicesChanges())
+	for _, gpu := range plan.GPUs {
+		require.True(t, gpu.CurrentMigEnabled)
+		require.True(t, gpu.CurrentMigDevices.Equals(gpu.MigDevices))
+	}
+
+	plan, err = applier.Plan(context.Background(), allGPUs(false, nil))
+	require.Nil(t, err, "Unexpected failure from Plan")
+	require.Equal(t, all, plan.MigModeChanges())
+	require.Empty(t, plan.MigDevicesChanges())
+}
+
+func TestPlanSkippedWithoutHooks(t *testing.T) {
+	hooks := &mockHooks{empty: true}
+	applier, _ := newMockApplier(hooks)
+
+	result, err := applier.Apply(context.Background(), allGPUs(true, types.MigConfig{"1g.5gb": 7}))
+	require.Nil(t, err, "Unexpected failure from Apply")
+	require.Nil(t, result.Plan)
+	require.Nil(t, hooks.statuses["apply-start"].Plan)
+}
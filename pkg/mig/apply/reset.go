@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// ResetMethod selects how GPUs are reset after a change of their MIG mode.
+type ResetMethod string
+
+const (
+	// ResetMethodAuto selects ResetMethodNvidiaSmi if the NVIDIA kernel
+	// module is loaded, and ResetMethodFlr otherwise.
+	ResetMethodAuto ResetMethod = "auto"
+	// ResetMethodNvml detaches each GPU from the driver through NVML and
+	// rediscovers it. This is not guaranteed to reset it, so that it is
+	// never selected by ResetMethodAuto, and whether its MIG mode change is
+	// still pending must be checked afterwards.
+	ResetMethodNvml ResetMethod = "nvml"
+	// ResetMethodNvidiaSmi resets GPUs with 'nvidia-smi -r'.
+	ResetMethodNvidiaSmi ResetMethod = "nvidia-smi"
+	// ResetMethodFlr performs a PCIe function level reset of each GPU
+	// through sysfs.
+	ResetMethodFlr ResetMethod = "flr"
+	// ResetMethodSbr performs a PCIe secondary bus reset of each GPU through
+	// sysfs.
+	ResetMethodSbr ResetMethod = "sbr"
+)
+
+// ResetMethods lists all reset methods, in the order they are documented.
+var ResetMethods = []ResetMethod{
+	ResetMethodAuto,
+	ResetMethodNvml,
+	ResetMethodNvidiaSmi,
+	ResetMethodFlr,
+	ResetMethodSbr,
+}
+
+// ParseResetMethod parses the name of a reset method.
+func ParseResetMethod(s string) (ResetMethod, error) {
+	for _, m := range ResetMethods {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return "", types.NewError(types.ErrorCategoryInvalidConfig, -1, "unknown reset method %q (expected one of %v)", s, ResetMethods)
+}
+
+// ResetResult is the outcome of resetting a single GPU.
+type ResetResult struct {
+	GPU     int
+	Address string
+	Method  ResetMethod
+	Err     error
+}
+
+// Resetter resets GPUs after a change of their MIG mode, so that the change
+// takes effect. Only GPUs whose index is set in pending need to be reset,
+// though an implementation may reset more of the GPUs given. It returns the
+// result of each GPU it attempted to reset, and an error if any of them
+// failed.
+type Resetter interface {
+	Reset(ctx context.Context, gpus []enumerator.GPU, pending map[int]bool) ([]ResetResult, error)
+}
+
+// NewResetter returns a Resetter for the given method. Methods going through
+// the NVIDIA driver are only available if it is loaded.
+func NewResetter(method ResetMethod, driverLoaded bool) (Resetter, error) {
+	if method == ResetMethodAuto {
+		method = ResetMethodFlr
+		if driverLoaded {
+			method = ResetMethodNvidiaSmi
+		}
+	}
+
+	switch method {
+	case ResetMethodNvml, ResetMethodNvidiaSmi:
+		if !driverLoaded {
+			return nil, types.NewError(types.ErrorCategoryDriverNotLoaded, -1, "reset method %q requires the NVIDIA kernel module to be loaded", method)
+		}
+	}
+
+	switch method {
+	case ResetMethodNvml:
+		return NewNvmlResetter(), nil
+	case ResetMethodNvidiaSmi:
+		return NewNvidiaSmiResetter(), nil
+	case ResetMethodFlr:
+		return NewFlrResetter(), nil
+	case ResetMethodSbr:
+		return NewSbrResetter(), nil
+	}
+
+	return nil, types.NewError(types.ErrorCategoryInvalidConfig, -1, "unknown reset method %q", method)
+}
+
+type nvidiaSmiResetter struct {
+	nvml nvml.Interface
+}
+
+var _ Resetter = (*nvidiaSmiResetter)(nil)
+
+// NewNvidiaSmiResetter returns a Resetter that resets all pending GPUs (and
+// their NVLink peers) at once with nvidia-smi. It requires the NVIDIA kernel
+// module to be loaded.
+func NewNvidiaSmiResetter() Resetter {
+	return &nvidiaSmiResetter{nvml.New()}
+}
+
+func (r *nvidiaSmiResetter) Reset(ctx context.Context, gpus []enumerator.GPU, pending map[int]bool) ([]ResetResult, error) {
+	log.Debugf("  Using nvidia-smi to perform GPU reset")
+
+	ret := r.nvml.Init()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(-1, ret.Value(), "error initializing NVML: %v", ret)
+	}
+	targets, err := getResetTargets(r.nvml, gpus, pending)
+	r.nvml.Shutdown()
+	if err != nil {
+		return nil, err
+	}
+
+	var pci []string
+	var results []ResetResult
+	for _, target := range targets {
+		results = append(results, ResetResult{GPU: target.GPU, Address: target.Address, Method: ResetMethodNvidiaSmi, Err: target.Err})
+		if target.Err == nil {
+			pci = append(pci, target.Address)
+		}
+	}
+	if len(pci) == 0 {
+		return results, resetError(results)
+	}
+
+	output, err := NvidiaSmiReset(ctx, pci...)
+	if err != nil {
+		log.Errorf("%v", output)
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = err
+			}
+		}
+		return results, fmt.Errorf("error resetting GPUs: %w", err)
+	}
+	return results, resetError(results)
+}
+
+// NvidiaSmiReset resets the GPUs with the given PCI addresses with
+// 'nvidia-smi -r', returning its combined output.
+func NvidiaSmiReset(ctx context.Context, gpus ...string) (string, error) {
+	var cmd *exec.Cmd
+	if len(gpus) == 0 {
+		return "", fmt.Errorf("no gpus specified")
+	} else {
+		cmd = exec.CommandContext(ctx, "nvidia-smi", "-r", "-i", strings.Join(gpus, ","))
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil && ctx.Err() != nil {
+		return string(output), types.NewContextError(-1, ctx.Err())
+	}
+	return string(output), err
+}
+
+// resetError summarizes the failures among results into a single error, or
+// returns nil if there are none. The error of the first failed GPU is kept in
+// the error chain.
+func resetError(results []ResetResult) error {
+	var failed []string
+	var first error
+	for _, r := range results {
+		if r.Err == nil {
+			continue
+		}
+		if first == nil {
+			first = r.Err
+		}
+		failed = append(failed, fmt.Sprintf("%v", r.GPU))
+	}
+	if first == nil {
+		return nil
+	}
+	return fmt.Errorf("error resetting GPU(s) %v: %w", strings.Join(failed, ","), first)
+}
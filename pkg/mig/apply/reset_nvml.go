@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+type nvmlResetter struct {
+	nvml nvml.Interface
+}
+
+var _ Resetter = (*nvmlResetter)(nil)
+
+// NewNvmlResetter returns a Resetter that drains each pending GPU (and its
+// NVLink peers) and removes it from the NVIDIA driver through NVML, then has
+// the driver rediscover all GPUs. It requires the NVIDIA kernel module to be
+// loaded.
+//
+// This is a best-effort reset: NVML does not guarantee that removing and
+// rediscovering a GPU resets it. Callers must check whether the MIG mode
+// change of each GPU is still pending afterwards, as Applier does.
+func NewNvmlResetter() Resetter {
+	return NewNvmlResetterWith(nvml.New())
+}
+
+// NewNvmlResetterWith returns an NVML based Resetter using the given NVML
+// interface, e.g. a mock of it in tests.
+func NewNvmlResetterWith(nvmlLib nvml.Interface) Resetter {
+	return &nvmlResetter{nvmlLib}
+}
+
+func (r *nvmlResetter) Reset(ctx context.Context, gpus []enumerator.GPU, pending map[int]bool) ([]ResetResult, error) {
+	log.Debugf("  Using NVML to perform GPU reset")
+
+	ret := r.nvml.Init()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(-1, ret.Value(), "error initializing NVML: %v", ret)
+	}
+	defer r.nvml.Shutdown()
+
+	targets, err := getResetTargets(r.nvml, gpus, pending)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ResetResult
+	var removed []int
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		result := ResetResult{GPU: target.GPU, Address: target.Address, Method: ResetMethodNvml, Err: target.Err}
+		if result.Err == nil {
+			result.Err = r.remove(target.GPU, &target.Info)
+		}
+		if result.Err == nil {
+			removed = append(removed, len(results))
+		}
+		results = append(results, result)
+	}
+
+	// Removed GPUs must always be rediscovered, even if ctx was canceled
+	// in the meantime, so that they are not left detached from the driver.
+	// NVML rescans every bus for them, as it is passed no PCI info.
+	if len(removed) > 0 {
+		_, ret := r.nvml.DeviceDiscoverGpus()
+		if ret.Value() != nvml.SUCCESS {
+			for _, i := range removed {
+				results[i].Err = types.NewNvmlError(results[i].GPU, ret.Value(), "error rediscovering GPU: %v", ret)
+			}
+		}
+	}
+
+	for _, i := range removed {
+		if results[i].Err != nil {
+			continue
+		}
+		info := targets[i].Info
+		ret := r.nvml.DeviceModifyDrainState(&info, nvml.FEATURE_DISABLED)
+		if ret.Value() != nvml.SUCCESS {
+			log.Warnf("Unable to undrain GPU %v after reset: %v", results[i].GPU, ret)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return results, types.NewContextError(-1, ctx.Err())
+	}
+
+	return results, resetError(results)
+}
+
+// remove drains a GPU and removes it from the driver, undraining it again if
+// it cannot be removed.
+func (r *nvmlResetter) remove(gpu int, info *nvml.PciInfo) error {
+	ret := r.nvml.DeviceModifyDrainState(info, nvml.FEATURE_ENABLED)
+	if ret.Value() != nvml.SUCCESS {
+		return types.NewNvmlError(gpu, ret.Value(), "error draining GPU: %v", ret)
+	}
+
+	ret = r.nvml.DeviceRemoveGpu(info)
+	if ret.Value() != nvml.SUCCESS {
+		undrain := r.nvml.DeviceModifyDrainState(info, nvml.FEATURE_DISABLED)
+		if undrain.Value() != nvml.SUCCESS {
+			log.Warnf("Unable to undrain GPU %v: %v", gpu, undrain)
+		}
+		return types.NewNvmlError(gpu, ret.Value(), "error removing GPU: %v", ret)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+type sysfsResetter struct {
+	method ResetMethod
+	// sysfsMethod is the name of the method in the reset_method file of a
+	// PCI device.
+	sysfsMethod string
+}
+
+var _ Resetter = (*sysfsResetter)(nil)
+
+// NewFlrResetter returns a Resetter that performs a PCIe function level reset
+// of each pending GPU through sysfs. It must only be used when the NVIDIA
+// kernel module is not loaded.
+func NewFlrResetter() Resetter {
+	return &sysfsResetter{ResetMethodFlr, "flr"}
+}
+
+// NewSbrResetter returns a Resetter that performs a PCIe secondary bus reset
+// of each pending GPU through sysfs, resetting all functions behind the same
+// bridge. It requires the reset_method sysfs file (Linux 5.15 or later), and
+// must only be used when the NVIDIA kernel module is not loaded.
+func NewSbrResetter() Resetter {
+	return &sysfsResetter{ResetMethodSbr, "bus"}
+}
+
+func (r *sysfsResetter) Reset(ctx context.Context, gpus []enumerator.GPU, pending map[int]bool) ([]ResetResult, error) {
+	log.Debugf("  Using sysfs to perform %v GPU reset", r.method)
+	var results []ResetResult
+	for _, gpu := range gpus {
+		if !pending[gpu.Index] {
+			continue
+		}
+		if ctx.Err() != nil {
+			return results, types.NewContextError(gpu.Index, ctx.Err())
+		}
+		err := r.reset(gpu)
+		if err != nil {
+			err = types.NewError(types.ErrorCategoryPci, gpu.Index, "%v", err)
+		}
+		results = append(results, ResetResult{GPU: gpu.Index, Address: gpu.Address, Method: r.method, Err: err})
+	}
+	return results, resetError(results)
+}
+
+// reset selects the reset method of gpu through its reset_method file (if
+// the kernel provides one), resets it, then restores the previous selection.
+func (r *sysfsResetter) reset(gpu enumerator.GPU) error {
+	methodPath := filepath.Join(gpu.Path, "reset_method")
+	previous, err := ioutil.ReadFile(methodPath)
+	if os.IsNotExist(err) && r.method == ResetMethodFlr {
+		return gpu.Reset()
+	}
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%v reset requires %v (Linux 5.15 or later)", r.method, methodPath)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read reset_method file: %v", err)
+	}
+
+	err = ioutil.WriteFile(methodPath, []byte(r.sysfsMethod), 0)
+	if err != nil {
+		return fmt.Errorf("unable to select %v reset method: %v", r.sysfsMethod, err)
+	}
+	defer func() {
+		restore := strings.TrimSpace(string(previous))
+		if restore == "" {
+			restore = "default"
+		}
+		err := ioutil.WriteFile(methodPath, []byte(restore), 0)
+		if err != nil {
+			log.Warnf("Unable to restore reset_method of GPU %v: %v", gpu.Index, err)
+		}
+	}()
+
+	return gpu.Reset()
+}
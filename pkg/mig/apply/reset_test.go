@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apply
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewResetter(t *testing.T) {
+	testCases := []struct {
+		method       string
+		driverLoaded bool
+		expected     Resetter
+		err          error
+	}{
+		{"auto", true, &nvidiaSmiResetter{}, nil},
+		{"auto", false, &sysfsResetter{}, nil},
+		{"nvml", true, &nvmlResetter{}, nil},
+		{"nvml", false, nil, types.ErrDriverNotLoaded},
+		{"nvidia-smi", true, &nvidiaSmiResetter{}, nil},
+		{"nvidia-smi", false, nil, types.ErrDriverNotLoaded},
+		{"flr", false, &sysfsResetter{}, nil},
+		{"sbr", false, &sysfsResetter{}, nil},
+		{"bogus", false, nil, types.ErrInvalidConfig},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method, func(t *testing.T) {
+			method, err := ParseResetMethod(tc.method)
+			if err == nil {
+				var r Resetter
+				r, err = NewResetter(method, tc.driverLoaded)
+				if tc.expected != nil {
+					require.IsType(t, tc.expected, r)
+				}
+			}
+			if tc.err == nil {
+				require.Nil(t, err, "Unexpected failure")
+				return
+			}
+			require.True(t, errors.Is(err, tc.err), "Unexpected error: %v", err)
+		})
+	}
+}
+
+func TestSysfsResetter(t *testing.T) {
+	root, err := enumerator.NewMockSysfs(
+		enumerator.MockGPU{Address: "0000:3b:00.0", Device: 0x20b0},
+		enumerator.MockGPU{Address: "0000:5e:00.0", Device: 0x20b0, ResetMethod: "flr bus"},
+		enumerator.MockGPU{Address: "0000:86:00.0", Device: 0x20b0, ResetMethod: "flr bus"},
+	)
+	require.Nil(t, err, "Unexpected failure creating mock sysfs")
+	defer os.RemoveAll(root)
+
+	gpus, err := enumerator.NewSysfs(root).GetGPUs()
+	require.Nil(t, err, "Unexpected failure from GetGPUs")
+
+	readFile := func(address, name string) string {
+		contents, err := ioutil.ReadFile(filepath.Join(root, address, name))
+		require.Nil(t, err, "Unexpected failure reading %v", name)
+		return string(contents)
+	}
+
+	pending := map[int]bool{0: true, 1: true}
+	results, err := NewFlrResetter().Reset(context.Background(), gpus, pending)
+	require.Nil(t, err, "Unexpected failure from FLR Reset")
+	require.Len(t, results, 2)
+	for i, r := range results {
+		require.Equal(t, i, r.GPU)
+		require.Equal(t, ResetMethodFlr, r.Method)
+		require.Nil(t, r.Err)
+		require.Equal(t, "1", readFile(r.Address, "reset"))
+	}
+	require.Equal(t, "flr bus", readFile("0000:5e:00.0", "reset_method"))
+	require.Equal(t, "", readFile("0000:86:00.0", "reset"))
+
+	pending = map[int]bool{0: true, 2: true}
+	results, err = NewSbrResetter().Reset(context.Background(), gpus, pending)
+	require.True(t, errors.Is(err, types.ErrPci), "Unexpected error from SBR Reset: %v", err)
+	require.Len(t, results, 2)
+	require.Equal(t, 0, results[0].GPU)
+	require.NotNil(t, results[0].Err, "Unexpected success resetting GPU without reset_method")
+	require.Equal(t, 2, results[1].GPU)
+	require.Nil(t, results[1].Err)
+	require.Equal(t, "1", readFile("0000:86:00.0", "reset"))
+	require.Equal(t, "flr bus", readFile("0000:86:00.0", "reset_method"))
+}
+
+func resetGPUs(results []ResetResult) []int {
+	var indices []int
+	for _, r := range results {
+		indices = append(indices, r.GPU)
+	}
+	return indices
+}
+
+func TestNvmlResetter(t *testing.T) {
+	server := nvml.NewMockNVMLOnLunaServer().(*nvml.MockLunaServer)
+	gpus, err := enumerator.NewNvmlWith(server).GetGPUs()
+	require.Nil(t, err, "Unexpected failure from GetGPUs")
+
+	results, err := NewNvmlResetterWith(server).Reset(context.Background(), gpus, map[int]bool{0: true, 3: true})
+	require.Nil(t, err, "Unexpected failure from Reset")
+	require.Equal(t, []int{0, 3}, resetGPUs(results))
+	for _, r := range results {
+		require.Equal(t, ResetMethodNvml, r.Method)
+		require.Nil(t, r.Err)
+	}
+	for _, d := range server.Devices {
+		require.False(t, d.(*nvml.MockA100Device).Drained)
+		require.False(t, d.(*nvml.MockA100Device).Removed)
+	}
+
+	unknown := *gpus[0].NvidiaPCIDevice
+	unknown.Address = "0000:ff:00.0"
+	withUnknown := append(gpus[:8:8], enumerator.GPU{Index: 8, NvidiaPCIDevice: &unknown})
+
+	results, err = NewNvmlResetterWith(server).Reset(context.Background(), withUnknown, map[int]bool{2: true, 8: true})
+	require.True(t, errors.Is(err, types.ErrNvml), "Unexpected error from Reset: %v", err)
+	require.Equal(t, []int{8, 2}, resetGPUs(results))
+	require.NotNil(t, results[0].Err)
+	require.Nil(t, results[1].Err)
+}
+
+func TestNvmlResetterNvLinkPeers(t *testing.T) {
+	server := nvml.NewMockNVMLOnLunaServer().(*nvml.MockLunaServer)
+	device := func(i int) *nvml.MockA100Device {
+		return server.Devices[i].(*nvml.MockA100Device)
+	}
+
+	// GPUs 0 and 1 are directly connected, GPUs 4 to 7 share two NVSwitches
+	// and GPUs 2 and 3 have no NVLinks.
+	device(0).NvLinkPeers = []string{device(1).PciBusId, device(1).PciBusId}
+	device(1).NvLinkPeers = []string{device(0).PciBusId, device(0).PciBusId}
+	for i := 4; i < 8; i++ {
+		device(i).NvLinkPeers = []string{"00000000:C0:00.0", "00000000:C1:00.0"}
+	}
+
+	gpus, err := enumerator.NewNvmlWith(server).GetGPUs()
+	require.Nil(t, err, "Unexpected failure from GetGPUs")
+
+	testCases := []struct {
+		description string
+		gpus        []enumerator.GPU
+		pending     []int
+		expected    []int
+	}{
+		{"direct peer", gpus, []int{1}, []int{0, 1}},
+		{"no peers", gpus, []int{2}, []int{2}},
+		{"nvswitch", gpus, []int{5}, []int{4, 5, 6, 7}},
+		{"multiple groups", gpus, []int{0, 3, 7}, []int{0, 1, 3, 4, 5, 6, 7}},
+		{"peers not enumerated", gpus[:5], []int{4}, []int{4, -1, -1, -1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			pending := make(map[int]bool)
+			for _, i := range tc.pending {
+				pending[i] = true
+			}
+			results, err := NewNvmlResetterWith(server).Reset(context.Background(), tc.gpus, pending)
+			require.Nil(t, err, "Unexpected failure from Reset")
+			require.Equal(t, tc.expected, resetGPUs(results))
+		})
+	}
+}
@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package assert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrNotApplied is matched (via errors.Is) by the error returned when an
+// assertion completes but the selected configuration is not applied.
+var ErrNotApplied = errors.New("selected configuration not currently applied")
+
+type notAppliedError string
+
+func (e notAppliedError) Error() string {
+	return string(e)
+}
+
+func (e notAppliedError) Is(target error) bool {
+	return target == ErrNotApplied
+}
+
+// Asserter checks whether a MIG configuration is currently applied to the
+// GPUs of a node.
+type Asserter struct {
+	modeManager   mode.Manager
+	configManager config.Manager
+	gpus          enumerator.Interface
+}
+
+// Option configures an Asserter.
+type Option func(*Asserter)
+
+// GPUResult holds the state of a single GPU found while asserting a MIG
+// configuration.
+type GPUResult struct {
+	GPU               int
+	DeviceID          types.DeviceID
+	MigCapable        bool
+	MigEnabled        bool
+	CurrentMigMode    mode.MigMode
+	MigDevices        types.MigConfig
+	CurrentMigDevices types.MigConfig
+	Matches           bool
+}
+
+// Result holds the state of all GPUs visited while asserting a MIG
+// configuration, in the order they were visited.
+type Result struct {
+	GPUs []GPUResult
+}
+
+// WithModeManager sets the mode.Manager used to query the MIG mode of each
+// GPU. It defaults to a PCI based manager.
+func WithModeManager(m mode.Manager) Option {
+	return func(a *Asserter) {
+		a.modeManager = m
+	}
+}
+
+// WithConfigManager sets the config.Manager used to query the MIG devices of
+// each GPU. It defaults to an NVML based manager.
+func WithConfigManager(m config.Manager) Option {
+	return func(a *Asserter) {
+		a.configManager = m
+	}
+}
+
+// WithGPUEnumerator sets how the GPUs of the node are enumerated, and which
+// of them are asserted. It defaults to all GPUs on the PCI bus.
+func WithGPUEnumerator(gpus enumerator.Interface) Option {
+	return func(a *Asserter) {
+		a.gpus = gpus
+	}
+}
+
+// New creates an Asserter with the given options.
+func New(opts ...Option) *Asserter {
+	a := &Asserter{}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.modeManager == nil {
+		a.modeManager = mode.NewPciMigModeManager()
+	}
+	if a.configManager == nil {
+		a.configManager = config.NewNvmlMigConfigManager()
+	}
+	if a.gpus == nil {
+		a.gpus = enumerator.New()
+	}
+	return a
+}
+
+// Matches returns whether every GPU visited matched the configuration.
+func (r *Result) Matches() bool {
+	for _, gpu := range r.GPUs {
+		if !gpu.Matches {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertMigMode asserts that the MIG mode of every GPU selected by migConfig
+// is the one it specifies. A mismatch is reported through both the returned
+// Result and an error matching ErrNotApplied.
+func (a *Asserter) AssertMigMode(ctx context.Context, migConfig v1.MigConfigSpecSlice) (*Result, error) {
+	result := &Result{}
+	err := WalkSelectedMigConfigForEachGPU(ctx, a.gpus, migConfig, func(mc *v1.MigConfigSpec, i int, d types.DeviceID) error {
+		r := GPUResult{
+			GPU:        i,
+			DeviceID:   d,
+			MigEnabled: mc.MigEnabled,
+		}
+		defer func() { result.GPUs = append(result.GPUs, r) }()
+
+		if mc.MigEnabled {
+			log.Debugf("    Asserting MIG mode: %v", mode.Enabled)
+		} else {
+			log.Debugf("    Asserting MIG mode: %v", mode.Disabled)
+		}
+
+		capable, err := a.modeManager.IsMigCapable(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error checking MIG capable: %w", err)
+		}
+		log.Debugf("    MIG capable: %v\n", capable)
+		r.MigCapable = capable
+
+		if !capable && !mc.MigEnabled {
+			log.Debugf("    Skipping -- non MIG-capable GPU with MIG mode disabled")
+			r.Matches = true
+			return nil
+		}
+
+		m, err := a.modeManager.GetMigMode(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error getting MIG mode: %w", err)
+		}
+		log.Debugf("    Current MIG mode: %v", m)
+		r.CurrentMigMode = m
+
+		if mc.MigEnabled && m == mode.Disabled {
+			return notAppliedError("current mode different than mode being asserted")
+		}
+		if !mc.MigEnabled && m == mode.Enabled {
+			return notAppliedError("current mode different than mode being asserted")
+		}
+
+		r.Matches = true
+		return nil
+	})
+	return result, err
+}
+
+// AssertMigConfig asserts that the MIG devices of every GPU on the node are
+// the ones migConfig specifies for it. A mismatch is reported through both
+// the returned Result and an error matching ErrNotApplied.
+func (a *Asserter) AssertMigConfig(ctx context.Context, migConfig v1.MigConfigSpecSlice) (*Result, error) {
+	gpus, err := a.gpus.GetGPUs()
+	if err != nil {
+		return nil, fmt.Errorf("error enumerating GPUs: %w", err)
+	}
+
+	result := &Result{}
+	matched := make(map[int]bool)
+	err = WalkSelectedMigConfigForEachGPU(ctx, a.gpus, migConfig, func(mc *v1.MigConfigSpec, i int, d types.DeviceID) error {
+		r := GPUResult{
+			GPU:        i,
+			DeviceID:   d,
+			MigEnabled: mc.MigEnabled,
+			MigDevices: mc.MigDevices,
+		}
+		defer func() { result.GPUs = append(result.GPUs, r) }()
+
+		capable, err := a.modeManager.IsMigCapable(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error checking MIG capable: %w", err)
+		}
+		r.MigCapable = capable
+
+		if !capable && !mc.MigEnabled {
+			matched[i] = true
+			r.Matches = true
+			return nil
+		}
+
+		m, err := a.modeManager.GetMigMode(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error getting MIG mode: %w", err)
+		}
+		r.CurrentMigMode = m
+
+		if !mc.MigEnabled && m == mode.Disabled {
+			matched[i] = true
+			r.Matches = true
+			return nil
+		}
+
+		current, err := a.configManager.GetMigConfig(ctx, i)
+		if err != nil {
+			return fmt.Errorf("error getting MIGConfig: %w", err)
+		}
+		r.CurrentMigDevices = current
+
+		log.Debugf("    Asserting MIG config: %v", mc.MigDevices)
+
+		if current.Equals(mc.MigDevices) {
+			matched[i] = true
+			r.Matches = true
+			return nil
+		}
+
+		matched[i] = false
+		return nil
+	})
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, gpu := range gpus {
+		if !matched[gpu.Index] {
+			return result, notAppliedError("not all GPUs match the specified config")
+		}
+	}
+
+	return result, nil
+}
+
+// WalkSelectedMigConfigForEachGPU calls f for every GPU enumerated by gpus
+// that is selected by an entry of migConfig. The context is checked before
+// each GPU is visited, so that a canceled walk never stops part way through
+// a GPU.
+func WalkSelectedMigConfigForEachGPU(ctx context.Context, gpus enumerator.Interface, migConfig v1.MigConfigSpecSlice, f func(*v1.MigConfigSpec, int, types.DeviceID) error) error {
+	devices, err := gpus.GetGPUs()
+	if err != nil {
+		return fmt.Errorf("Error enumerating GPUs: %w", err)
+	}
+
+	for _, mc := range migConfig {
+		if mc.DeviceFilter == nil {
+			log.Debugf("Walking MigConfig for (devices=%v)", mc.Devices)
+		} else {
+			log.Debugf("Walking MigConfig for (device-filter=%v, devices=%v)", mc.DeviceFilter, mc.Devices)
+		}
+
+		for _, gpu := range devices {
+			i := gpu.Index
+			deviceID := types.NewDeviceID(gpu.Device, gpu.Vendor)
+
+			if !mc.MatchesDeviceFilter(deviceID) {
+				continue
+			}
+
+			if !mc.MatchesDevices(i) {
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return types.NewContextError(i, ctx.Err())
+			}
+
+			log.Debugf("  GPU %v: %v", i, deviceID)
+
+			err = f(&mc, i, deviceID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
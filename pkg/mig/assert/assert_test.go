@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package assert
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/NVIDIA/mig-parted/api/spec/v1"
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/mig/config"
+	"github.com/NVIDIA/mig-parted/pkg/mig/mode"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertMigMode(t *testing.T) {
+	server := nvml.NewMockNVMLOnLunaServer().(*nvml.MockLunaServer)
+	asserter := New(
+		WithModeManager(mode.NewNvmlMigModeManagerWith(server)),
+		WithConfigManager(config.NewNvmlMigConfigManagerWith(server)),
+		WithGPUEnumerator(enumerator.NewMockGPUs(len(server.Devices))),
+	)
+
+	migConfig := v1.MigConfigSpecSlice{
+		{Devices: []int{0, 3}, MigEnabled: true, MigDevices: types.MigConfig{}},
+		{Devices: []int{1, 2, 4, 5, 6, 7}, MigEnabled: false},
+	}
+
+	result, err := asserter.AssertMigMode(context.Background(), migConfig)
+	require.True(t, errors.Is(err, ErrNotApplied), "Unexpected error from AssertMigMode: %v", err)
+	require.False(t, result.Matches())
+	require.Len(t, result.GPUs, 1)
+	require.Equal(t, 0, result.GPUs[0].GPU)
+	require.Equal(t, mode.Disabled, result.GPUs[0].CurrentMigMode)
+
+	server.Devices[0].SetMigMode(nvml.DEVICE_MIG_ENABLE)
+	server.Devices[3].SetMigMode(nvml.DEVICE_MIG_ENABLE)
+
+	result, err = asserter.AssertMigMode(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from AssertMigMode")
+	require.True(t, result.Matches())
+	require.Len(t, result.GPUs, 8)
+
+	var visited []int
+	for _, gpu := range result.GPUs {
+		visited = append(visited, gpu.GPU)
+	}
+	require.Equal(t, []int{0, 3, 1, 2, 4, 5, 6, 7}, visited)
+
+	_, err = asserter.AssertMigConfig(context.Background(), migConfig)
+	require.Nil(t, err, "Unexpected failure from AssertMigConfig")
+}
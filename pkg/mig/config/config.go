@@ -17,19 +17,32 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 
+	placements "github.com/NVIDIA/mig-parted/api/placements/v1"
 	"github.com/NVIDIA/mig-parted/internal/nvml"
 	"github.com/NVIDIA/mig-parted/pkg/types"
 	log "github.com/sirupsen/logrus"
 )
 
+// Manager queries and changes the MIG devices configured on the GPUs of a
+// node. The context passed to each call is checked before any device is
+// touched. SetMigConfig additionally checks it between the orderings of MIG
+// devices it attempts, always leaving the GPU cleared if it gives up.
 type Manager interface {
-	GetMigConfig(gpu int) (types.MigConfig, error)
-	SetMigConfig(gpu int, config types.MigConfig) error
-	ClearAndGetInstancesToCreate(gpu int, desiredConfig []types.MigProfile) ([]types.MigProfile, error)
-	GetMigPlacements() (map[int]map[int]string, error)
+	GetMigConfig(ctx context.Context, gpu int) (types.MigConfig, error)
+	SetMigConfig(ctx context.Context, gpu int, config types.MigConfig) error
+	ClearAndGetInstancesToCreate(ctx context.Context, gpu int, desiredConfig []types.MigProfile) ([]types.MigProfile, error)
+	GetMigPlacements(ctx context.Context) (*placements.Spec, error)
+	GetComputeProcesses(ctx context.Context, gpu int) ([]Process, error)
+}
+
+// UUIDGetter is implemented by Managers able to look up the UUID of a GPU.
+type UUIDGetter interface {
+	GetGpuUUID(ctx context.Context, gpu int) (string, error)
 }
 
 type nvmlMigConfigManager struct {
@@ -37,6 +50,7 @@ type nvmlMigConfigManager struct {
 }
 
 var _ Manager = (*nvmlMigConfigManager)(nil)
+var _ UUIDGetter = (*nvmlMigConfigManager)(nil)
 
 func tryNvmlShutdown(nvmlLib nvml.Interface) {
 	ret := nvmlLib.Shutdown()
@@ -49,27 +63,45 @@ func NewNvmlMigConfigManager() Manager {
 	return &nvmlMigConfigManager{nvml.New()}
 }
 
-func (m *nvmlMigConfigManager) GetMigConfig(gpu int) (types.MigConfig, error) {
+// NewNvmlUUIDGetter returns a UUIDGetter looking up GPU UUIDs through NVML.
+func NewNvmlUUIDGetter() UUIDGetter {
+	return &nvmlMigConfigManager{nvml.New()}
+}
+
+// NewNvmlMigConfigManagerWith returns a Manager backed by the given NVML
+// interface, e.g. a mock of it in tests.
+func NewNvmlMigConfigManagerWith(nvmlLib nvml.Interface) Manager {
+	return &nvmlMigConfigManager{nvmlLib}
+}
+
+func (m *nvmlMigConfigManager) GetMigConfig(ctx context.Context, gpu int) (types.MigConfig, error) {
+	if ctx.Err() != nil {
+		return nil, types.NewContextError(gpu, ctx.Err())
+	}
+	return m.getMigConfig(gpu)
+}
+
+func (m *nvmlMigConfigManager) getMigConfig(gpu int) (types.MigConfig, error) {
 	ret := m.nvml.Init()
 	if ret.Value() != nvml.SUCCESS {
-		return nil, fmt.Errorf("error initializing NVML: %v", ret)
+		return nil, types.NewNvmlError(gpu, ret.Value(), "error initializing NVML: %v", ret)
 	}
 	defer tryNvmlShutdown(m.nvml)
 
 	device, ret := m.nvml.DeviceGetHandleByIndex(gpu)
 	if ret.Value() != nvml.SUCCESS {
-		return nil, fmt.Errorf("error getting device handle: %v", ret)
+		return nil, types.NewNvmlError(gpu, ret.Value(), "error getting device handle: %v", ret)
 	}
 
 	mode, _, ret := device.GetMigMode()
 	if ret.Value() == nvml.ERROR_NOT_SUPPORTED {
-		return nil, fmt.Errorf("MIG not supported")
+		return nil, types.NewError(types.ErrorCategoryNotMigCapable, gpu, "MIG not supported")
 	}
 	if ret.Value() != nvml.SUCCESS {
-		return nil, fmt.Errorf("error getting MIG mode: %v", ret)
+		return nil, types.NewNvmlError(gpu, ret.Value(), "error getting MIG mode: %v", ret)
 	}
 	if mode != nvml.DEVICE_MIG_ENABLE {
-		return nil, fmt.Errorf("MIG mode disabled")
+		return nil, types.NewError(types.ErrorCategoryMigModeDisabled, gpu, "MIG mode disabled")
 	}
 
 	migConfig := types.MigConfig{}
@@ -79,12 +111,12 @@ func (m *nvmlMigConfigManager) GetMigConfig(gpu int) (types.MigConfig, error) {
 			continue
 		}
 		if ret.Value() != nvml.SUCCESS {
-			return nil, fmt.Errorf("error getting GPU instance profile info for '%v': %v", i, ret)
+			return nil, types.NewNvmlError(gpu, ret.Value(), "error getting GPU instance profile info for '%v': %v", i, ret)
 		}
 
 		gis, ret := device.GetGpuInstances(&giProfileInfo)
 		if ret.Value() != nvml.SUCCESS {
-			return nil, fmt.Errorf("error getting GPU instances for profile '%v': %v", i, ret)
+			return nil, types.NewNvmlError(gpu, ret.Value(), "error getting GPU instances for profile '%v': %v", i, ret)
 		}
 
 		for _, gi := range gis {
@@ -95,17 +127,17 @@ func (m *nvmlMigConfigManager) GetMigConfig(gpu int) (types.MigConfig, error) {
 						continue
 					}
 					if ret.Value() != nvml.SUCCESS {
-						return nil, fmt.Errorf("error getting Compute instance profile info for '(%v, %v)': %v", j, k, ret)
+						return nil, types.NewNvmlError(gpu, ret.Value(), "error getting Compute instance profile info for '(%v, %v)': %v", j, k, ret)
 					}
 
 					cis, ret := gi.GetComputeInstances(&ciProfileInfo)
 					if ret.Value() != nvml.SUCCESS {
-						return nil, fmt.Errorf("error getting Compute instances for profile '(%v, %v)': %v", j, k, ret)
+						return nil, types.NewNvmlError(gpu, ret.Value(), "error getting Compute instances for profile '(%v, %v)': %v", j, k, ret)
 					}
 
 					for _, ci := range cis {
 						if ret.Value() != nvml.SUCCESS {
-							return nil, fmt.Errorf("error getting Compute instance info for '%v': %v", ci, ret)
+							return nil, types.NewNvmlError(gpu, ret.Value(), "error getting Compute instance info for '%v': %v", ci, ret)
 						}
 
 						mdt := types.NewMigProfile(ciProfileInfo.SliceCount, giProfileInfo.SliceCount, giProfileInfo.MemorySizeMB)
@@ -119,124 +151,174 @@ func (m *nvmlMigConfigManager) GetMigConfig(gpu int) (types.MigConfig, error) {
 	return migConfig, nil
 }
 
-func (m *nvmlMigConfigManager) SetMigConfig(gpu int, config types.MigConfig) error {
+func (m *nvmlMigConfigManager) SetMigConfig(ctx context.Context, gpu int, config types.MigConfig) error {
+	if ctx.Err() != nil {
+		return types.NewContextError(gpu, ctx.Err())
+	}
+
 	ret := m.nvml.Init()
 	if ret.Value() != nvml.SUCCESS {
-		return fmt.Errorf("error initializing NVML: %v", ret)
+		return types.NewNvmlError(gpu, ret.Value(), "error initializing NVML: %v", ret)
 	}
 	defer tryNvmlShutdown(m.nvml)
 
 	device, ret := m.nvml.DeviceGetHandleByIndex(gpu)
 	if ret.Value() != nvml.SUCCESS {
-		return fmt.Errorf("error getting device handle: %v", ret)
+		return types.NewNvmlError(gpu, ret.Value(), "error getting device handle: %v", ret)
 	}
 
 	mode, _, ret := device.GetMigMode()
 	if ret.Value() == nvml.ERROR_NOT_SUPPORTED {
-		return fmt.Errorf("MIG not supported")
+		return types.NewError(types.ErrorCategoryNotMigCapable, gpu, "MIG not supported")
 	}
 	if ret.Value() != nvml.SUCCESS {
-		return fmt.Errorf("error getting MIG mode: %v", ret)
+		return types.NewNvmlError(gpu, ret.Value(), "error getting MIG mode: %v", ret)
 	}
 	if mode != nvml.DEVICE_MIG_ENABLE {
-		return fmt.Errorf("MIG mode disabled")
+		return types.NewError(types.ErrorCategoryMigModeDisabled, gpu, "MIG mode disabled")
 	}
 
-	err := iteratePermutationsUntilSuccess(config, func(mps []types.MigProfile) error {
-		clearAttempts := 0
-		maxClearAttempts := 1
-		performedClearOperationSuccessfully := false
+	err := config.AssertValid()
+	if err != nil {
+		return types.NewError(types.ErrorCategoryInvalidConfig, gpu, "invalid MigConfig: %v", err)
+	}
 
-		for {
-			existingConfig, err := m.GetMigConfig(gpu)
-			if err != nil {
-				return fmt.Errorf("error getting existing MigConfig: %v", err)
-			}
+	for _, mdt := range config.Flatten() {
+		giProfileID, _, _, err := mdt.GetProfileIDs()
+		if err != nil {
+			return types.NewError(types.ErrorCategoryInvalidConfig, gpu, "error getting profile ids for '%v': %v", mdt, err)
+		}
 
-			if performedClearOperationSuccessfully || len(existingConfig.Flatten()) == 0 {
-				break
+		_, ret := device.GetGpuInstanceProfileInfo(giProfileID)
+		if ret.Value() == nvml.ERROR_NOT_SUPPORTED || ret.Value() == nvml.ERROR_INVALID_ARGUMENT {
+			return &types.Error{
+				Category: types.ErrorCategoryInvalidConfig,
+				GPU:      gpu,
+				Return:   ret.Value(),
+				Err:      fmt.Errorf("unsupported MIG profile '%v': %v", mdt, ret),
 			}
+		}
+	}
 
-			if clearAttempts == maxClearAttempts {
-				return fmt.Errorf("exceeded maximum attempts to clear MigConfig")
-			}
+	var lastErr error
+	err = iteratePermutationsUntilSuccess(ctx, config, func(mps []types.MigProfile) error {
+		lastErr = m.trySetMigConfigOrdering(device, gpu, mps)
+		return lastErr
+	})
+	if err != nil {
+		_, e := m.clearAndGetInstancesToCreate(gpu, []types.MigProfile{})
+		if e != nil {
+			log.Errorf("Error clearing MIG config on GPU %d, erroneous devices may persist", gpu)
+		}
+		if ctx.Err() != nil {
+			return types.NewContextError(gpu, ctx.Err())
+		}
+		// If the last ordering failed for a well-defined reason (e.g. a MIG
+		// device that could not be destroyed because it is in use), report
+		// that. Otherwise, no ordering of the requested profiles fits on
+		// the GPU, so the config itself is invalid.
+		var typed *types.Error
+		if errors.As(lastErr, &typed) && typed.Category != types.ErrorCategoryNvml {
+			return &types.Error{Category: typed.Category, GPU: gpu, Return: typed.Return, Err: fmt.Errorf("error attempting multiple config orderings: %v", err)}
+		}
+		return types.NewError(types.ErrorCategoryInvalidConfig, gpu, "error attempting multiple config orderings: %v", err)
+	}
 
-			mps, err = m.ClearAndGetInstancesToCreate(gpu, mps)
-			if err != nil {
-				return fmt.Errorf("error clearing MigConfig: %v", err)
-			} else {
-				performedClearOperationSuccessfully = true
-			}
+	return nil
+}
 
-			clearAttempts++
+func (m *nvmlMigConfigManager) trySetMigConfigOrdering(device nvml.Device, gpu int, mps []types.MigProfile) error {
+	clearAttempts := 0
+	maxClearAttempts := 1
+	performedClearOperationSuccessfully := false
+
+	for {
+		existingConfig, err := m.getMigConfig(gpu)
+		if err != nil {
+			return fmt.Errorf("error getting existing MigConfig: %w", err)
 		}
 
-		for _, mdt := range mps {
-			giProfileID, ciProfileID, ciEngProfileID, err := mdt.GetProfileIDs()
-			if err != nil {
-				return fmt.Errorf("error getting profile ids for '%v': %v", mdt, err)
-			}
+		if performedClearOperationSuccessfully || len(existingConfig.Flatten()) == 0 {
+			break
+		}
 
-			giProfileInfo, ret := device.GetGpuInstanceProfileInfo(giProfileID)
-			if ret.Value() != nvml.SUCCESS {
-				return fmt.Errorf("error getting GPU instance profile info for '%v': %v", mdt, ret)
-			}
+		if clearAttempts == maxClearAttempts {
+			return fmt.Errorf("exceeded maximum attempts to clear MigConfig")
+		}
 
-			gi, ret := device.CreateGpuInstance(&giProfileInfo)
-			if ret.Value() != nvml.SUCCESS {
-				return fmt.Errorf("error creating GPU instance for '%v': %v", mdt, ret)
-			}
+		mps, err = m.clearAndGetInstancesToCreate(gpu, mps)
+		if err != nil {
+			return fmt.Errorf("error clearing MigConfig: %w", err)
+		} else {
+			performedClearOperationSuccessfully = true
+		}
 
-			ciProfileInfo, ret := gi.GetComputeInstanceProfileInfo(ciProfileID, ciEngProfileID)
-			if ret.Value() != nvml.SUCCESS {
-				return fmt.Errorf("error getting Compute instance profile info for '%v': %v", mdt, ret)
-			}
+		clearAttempts++
+	}
 
-			_, ret = gi.CreateComputeInstance(&ciProfileInfo)
-			if ret.Value() != nvml.SUCCESS {
-				return fmt.Errorf("error creating Compute instance for '%v': %v", mdt, ret)
-			}
+	for _, mdt := range mps {
+		giProfileID, ciProfileID, ciEngProfileID, err := mdt.GetProfileIDs()
+		if err != nil {
+			return types.NewError(types.ErrorCategoryInvalidConfig, gpu, "error getting profile ids for '%v': %v", mdt, err)
+		}
 
-			valid := types.NewMigProfile(ciProfileInfo.SliceCount, giProfileInfo.SliceCount, giProfileInfo.MemorySizeMB)
-			if mdt != valid {
-				return fmt.Errorf("unsupported MIG Device specified %v, expected %v instead", mdt, valid)
-			}
+		giProfileInfo, ret := device.GetGpuInstanceProfileInfo(giProfileID)
+		if ret.Value() != nvml.SUCCESS {
+			return types.NewNvmlError(gpu, ret.Value(), "error getting GPU instance profile info for '%v': %v", mdt, ret)
 		}
 
-		return nil
-	})
-	if err != nil {
-		_, e := m.ClearAndGetInstancesToCreate(gpu, []types.MigProfile{})
-		if e != nil {
-			log.Errorf("Error clearing MIG config on GPU %d, erroneous devices may persist", gpu)
+		gi, ret := device.CreateGpuInstance(&giProfileInfo)
+		if ret.Value() != nvml.SUCCESS {
+			return types.NewNvmlError(gpu, ret.Value(), "error creating GPU instance for '%v': %v", mdt, ret)
+		}
+
+		ciProfileInfo, ret := gi.GetComputeInstanceProfileInfo(ciProfileID, ciEngProfileID)
+		if ret.Value() != nvml.SUCCESS {
+			return types.NewNvmlError(gpu, ret.Value(), "error getting Compute instance profile info for '%v': %v", mdt, ret)
+		}
+
+		_, ret = gi.CreateComputeInstance(&ciProfileInfo)
+		if ret.Value() != nvml.SUCCESS {
+			return types.NewNvmlError(gpu, ret.Value(), "error creating Compute instance for '%v': %v", mdt, ret)
+		}
+
+		valid := types.NewMigProfile(ciProfileInfo.SliceCount, giProfileInfo.SliceCount, giProfileInfo.MemorySizeMB)
+		if mdt != valid {
+			return types.NewError(types.ErrorCategoryInvalidConfig, gpu, "unsupported MIG Device specified %v, expected %v instead", mdt, valid)
 		}
-		return fmt.Errorf("error attempting multiple config orderings: %v", err)
 	}
 
 	return nil
 }
 
-func (m *nvmlMigConfigManager) ClearAndGetInstancesToCreate(gpu int, desiredConfig []types.MigProfile) ([]types.MigProfile, error) {
+func (m *nvmlMigConfigManager) ClearAndGetInstancesToCreate(ctx context.Context, gpu int, desiredConfig []types.MigProfile) ([]types.MigProfile, error) {
+	if ctx.Err() != nil {
+		return desiredConfig, types.NewContextError(gpu, ctx.Err())
+	}
+	return m.clearAndGetInstancesToCreate(gpu, desiredConfig)
+}
+
+func (m *nvmlMigConfigManager) clearAndGetInstancesToCreate(gpu int, desiredConfig []types.MigProfile) ([]types.MigProfile, error) {
 	ret := m.nvml.Init()
 	if ret.Value() != nvml.SUCCESS {
-		return desiredConfig, fmt.Errorf("error initializing NVML: %v", ret)
+		return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error initializing NVML: %v", ret)
 	}
 	defer tryNvmlShutdown(m.nvml)
 
 	device, ret := m.nvml.DeviceGetHandleByIndex(gpu)
 	if ret.Value() != nvml.SUCCESS {
-		return desiredConfig, fmt.Errorf("error getting device handle: %v", ret)
+		return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error getting device handle: %v", ret)
 	}
 
 	mode, _, ret := device.GetMigMode()
 	if ret.Value() == nvml.ERROR_NOT_SUPPORTED {
-		return desiredConfig, fmt.Errorf("MIG not supported")
+		return desiredConfig, types.NewError(types.ErrorCategoryNotMigCapable, gpu, "MIG not supported")
 	}
 	if ret.Value() != nvml.SUCCESS {
-		return desiredConfig, fmt.Errorf("error getting MIG mode: %v", ret)
+		return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error getting MIG mode: %v", ret)
 	}
 	if mode != nvml.DEVICE_MIG_ENABLE {
-		return desiredConfig, fmt.Errorf("MIG mode disabled")
+		return desiredConfig, types.NewError(types.ErrorCategoryMigModeDisabled, gpu, "MIG mode disabled")
 	}
 
 	instancesToNotCreate := map[int]bool{}
@@ -246,12 +328,12 @@ func (m *nvmlMigConfigManager) ClearAndGetInstancesToCreate(gpu int, desiredConf
 			continue
 		}
 		if ret.Value() != nvml.SUCCESS {
-			return desiredConfig, fmt.Errorf("error getting GPU instance profile info for '%v': %v", i, ret)
+			return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error getting GPU instance profile info for '%v': %v", i, ret)
 		}
 
 		gis, ret := device.GetGpuInstances(&giProfileInfo)
 		if ret.Value() != nvml.SUCCESS {
-			return desiredConfig, fmt.Errorf("error getting GPU instances for profile '%v': %v", i, ret)
+			return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error getting GPU instances for profile '%v': %v", i, ret)
 		}
 
 		for _, gi := range gis {
@@ -263,12 +345,12 @@ func (m *nvmlMigConfigManager) ClearAndGetInstancesToCreate(gpu int, desiredConf
 						continue
 					}
 					if ret.Value() != nvml.SUCCESS {
-						return desiredConfig, fmt.Errorf("error getting Compute instance profile info for '(%v, %v)': %v", j, k, ret)
+						return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error getting Compute instance profile info for '(%v, %v)': %v", j, k, ret)
 					}
 
 					cis, ret := gi.GetComputeInstances(&ciProfileInfo)
 					if ret.Value() != nvml.SUCCESS {
-						return desiredConfig, fmt.Errorf("error getting Compute instances for profile '(%v, %v)': %v", j, k, ret)
+						return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error getting Compute instances for profile '(%v, %v)': %v", j, k, ret)
 					}
 
 					for _, ci := range cis {
@@ -277,7 +359,7 @@ func (m *nvmlMigConfigManager) ClearAndGetInstancesToCreate(gpu int, desiredConf
 							if ret.Value() == nvml.ERROR_IN_USE && len(desiredConfig) > 0 && destroyGi {
 								gpuInfo, ret := gi.GetInfo()
 								if ret.Value() != nvml.SUCCESS {
-									return desiredConfig, fmt.Errorf("error destroying Compute instance for profile '(%v, %v)': %v", j, k, ret)
+									return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error destroying Compute instance for profile '(%v, %v)': %v", j, k, ret)
 								}
 								index := getMigProfileInConfigByPosition(desiredConfig, device, gpuInfo.ProfileId, instancesToNotCreate)
 								if index != -1 {
@@ -285,7 +367,7 @@ func (m *nvmlMigConfigManager) ClearAndGetInstancesToCreate(gpu int, desiredConf
 									destroyGi = false
 								}
 							} else {
-								return desiredConfig, fmt.Errorf("error destroying Compute instance for profile '(%v, %v)': %v", j, k, ret)
+								return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error destroying Compute instance for profile '(%v, %v)': %v", j, k, ret)
 							}
 						}
 					}
@@ -295,7 +377,7 @@ func (m *nvmlMigConfigManager) ClearAndGetInstancesToCreate(gpu int, desiredConf
 			if destroyGi {
 				ret := gi.Destroy()
 				if ret.Value() != nvml.SUCCESS {
-					return desiredConfig, fmt.Errorf("error destroying GPU instance for profile '%v': %v", i, ret)
+					return desiredConfig, types.NewNvmlError(gpu, ret.Value(), "error destroying GPU instance for profile '%v': %v", i, ret)
 				}
 			}
 		}
@@ -329,7 +411,7 @@ func getMigProfileInConfigByPosition(config []types.MigProfile, device nvml.Devi
 	return -1
 }
 
-func iteratePermutationsUntilSuccess(config types.MigConfig, f func([]types.MigProfile) error) error {
+func iteratePermutationsUntilSuccess(ctx context.Context, config types.MigConfig, f func([]types.MigProfile) error) error {
 	shouldSwap := func(mps []types.MigProfile, start, curr int) bool {
 		for i := start; i < curr; i++ {
 			if mps[i] == mps[curr] {
@@ -342,6 +424,9 @@ func iteratePermutationsUntilSuccess(config types.MigConfig, f func([]types.MigP
 	var iterate func(mps []types.MigProfile, f func([]types.MigProfile) error, index int) error
 	iterate = func(mps []types.MigProfile, f func([]types.MigProfile) error, i int) error {
 		if i >= len(mps) {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			err := f(mps)
 			if err != nil {
 				e := err.Error()
@@ -358,6 +443,9 @@ func iteratePermutationsUntilSuccess(config types.MigConfig, f func([]types.MigP
 				if err == nil {
 					return nil
 				}
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
 
 				mps[i], mps[j] = mps[j], mps[i]
 			}
@@ -368,3 +456,27 @@ func iteratePermutationsUntilSuccess(config types.MigConfig, f func([]types.MigP
 
 	return iterate(config.Flatten(), f, 0)
 }
+
+func (m *nvmlMigConfigManager) GetGpuUUID(ctx context.Context, gpu int) (string, error) {
+	if ctx.Err() != nil {
+		return "", types.NewContextError(gpu, ctx.Err())
+	}
+
+	ret := m.nvml.Init()
+	if ret.Value() != nvml.SUCCESS {
+		return "", types.NewNvmlError(gpu, ret.Value(), "error initializing NVML: %v", ret)
+	}
+	defer tryNvmlShutdown(m.nvml)
+
+	device, ret := m.nvml.DeviceGetHandleByIndex(gpu)
+	if ret.Value() != nvml.SUCCESS {
+		return "", types.NewNvmlError(gpu, ret.Value(), "error getting device handle: %v", ret)
+	}
+
+	uuid, ret := device.GetUUID()
+	if ret.Value() != nvml.SUCCESS {
+		return "", types.NewNvmlError(gpu, ret.Value(), "error getting GPU UUID: %v", ret)
+	}
+
+	return uuid, nil
+}
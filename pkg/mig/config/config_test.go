@@ -17,6 +17,8 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -71,10 +73,10 @@ func TestGetSetMigConfig(t *testing.T) {
 				require.Equal(t, nvml.SUCCESS, r1.Value())
 				require.Equal(t, nvml.SUCCESS, r2.Value())
 
-				err := manager.SetMigConfig(i, tc.config)
+				err := manager.SetMigConfig(context.Background(), i, tc.config)
 				require.Nil(t, err, "Unexpected failure from SetMigConfig")
 
-				config, err := manager.GetMigConfig(i)
+				config, err := manager.GetMigConfig(context.Background(), i)
 				require.Nil(t, err, "Unexpected failure from GetMigConfig")
 				require.Equal(t, tc.config.Flatten(), config.Flatten(), "Retrieved MigConfig different than what was set")
 			}
@@ -109,13 +111,13 @@ func TestClearMigConfig(t *testing.T) {
 			require.Equal(t, nvml.SUCCESS, r1.Value())
 			require.Equal(t, nvml.SUCCESS, r2.Value())
 
-			err := manager.SetMigConfig(0, tc.config)
+			err := manager.SetMigConfig(context.Background(), 0, tc.config)
 			require.Nil(t, err, "Unexpected failure from SetMigConfig")
 
-			err, _ = manager.ClearMigConfig(0, []types.MigProfile{})
-			require.Nil(t, err, "Unexpected failure from ClearMigConfig")
+			_, err = manager.ClearAndGetInstancesToCreate(context.Background(), 0, []types.MigProfile{})
+			require.Nil(t, err, "Unexpected failure from ClearAndGetInstancesToCreate")
 
-			config, err := manager.GetMigConfig(0)
+			config, err := manager.GetMigConfig(context.Background(), 0)
 			require.Nil(t, err, "Unexpected failure from GetMigConfig")
 			require.Equal(t, 0, len(config.Flatten()), "Unexpected number of configured MIG profiles")
 		})
@@ -172,7 +174,7 @@ func TestIteratePermutationsUntilSuccess(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
 			iteration := 0
-			err := iteratePermutationsUntilSuccess(tc.config, func(perm []types.MigProfile) error {
+			err := iteratePermutationsUntilSuccess(context.Background(), tc.config, func(perm []types.MigProfile) error {
 				iteration++
 				if iteration == tc.successAfter {
 					return nil
@@ -188,3 +190,83 @@ func TestIteratePermutationsUntilSuccess(t *testing.T) {
 		})
 	}
 }
+
+func TestGetComputeProcesses(t *testing.T) {
+	manager := NewMockLunaServerMigConfigManager()
+	server := manager.(*nvmlMigConfigManager).nvml.(*nvml.MockLunaServer)
+
+	processes, err := manager.GetComputeProcesses(context.Background(), 0)
+	require.Nil(t, err, "Unexpected failure from GetComputeProcesses")
+	require.Empty(t, processes)
+
+	device := server.Devices[0].(*nvml.MockA100Device)
+	device.ComputeProcesses = []nvml.ProcessInfo{
+		{Pid: 1234, UsedGpuMemory: 1024, GpuInstanceId: NoInstanceID, ComputeInstanceId: NoInstanceID},
+	}
+
+	processes, err = manager.GetComputeProcesses(context.Background(), 0)
+	require.Nil(t, err, "Unexpected failure from GetComputeProcesses")
+	require.Len(t, processes, 1)
+	require.Equal(t, uint32(1234), processes[0].Pid)
+	require.Equal(t, "", processes[0].MigUUID)
+
+	r1, r2 := EnableMigMode(manager, 0)
+	require.Equal(t, nvml.SUCCESS, r1.Value())
+	require.Equal(t, nvml.SUCCESS, r2.Value())
+
+	err = manager.SetMigConfig(context.Background(), 0, types.MigConfig{"1g.5gb": 1})
+	require.Nil(t, err, "Unexpected failure from SetMigConfig")
+
+	device.ComputeProcesses = []nvml.ProcessInfo{
+		{Pid: 1234, UsedGpuMemory: 1024, GpuInstanceId: 0, ComputeInstanceId: 0},
+	}
+
+	processes, err = manager.GetComputeProcesses(context.Background(), 0)
+	require.Nil(t, err, "Unexpected failure from GetComputeProcesses")
+	require.Len(t, processes, 1)
+	require.Equal(t, uint32(1234), processes[0].Pid)
+	require.NotEqual(t, "", processes[0].MigUUID)
+}
+
+func TestSetMigConfigErrors(t *testing.T) {
+	manager := NewMockLunaServerMigConfigManager()
+
+	err := manager.SetMigConfig(context.Background(), 0, types.MigConfig{"1g.5gb": 7})
+	require.True(t, errors.Is(err, types.ErrMigModeDisabled), "Unexpected error from SetMigConfig: %v", err)
+
+	r1, r2 := EnableMigMode(manager, 0)
+	require.Equal(t, nvml.SUCCESS, r1.Value())
+	require.Equal(t, nvml.SUCCESS, r2.Value())
+
+	err = manager.SetMigConfig(context.Background(), 0, types.MigConfig{"1g.5gbk": 1})
+	require.True(t, errors.Is(err, types.ErrInvalidConfig), "Unexpected error from SetMigConfig: %v", err)
+
+	err = manager.SetMigConfig(context.Background(), 0, types.MigConfig{"8g.40gb": 1})
+	require.True(t, errors.Is(err, types.ErrInvalidConfig), "Unexpected error from SetMigConfig: %v", err)
+
+	var typed *types.Error
+	require.True(t, errors.As(err, &typed))
+	require.Equal(t, 0, typed.GPU)
+	require.Equal(t, nvml.ERROR_NOT_SUPPORTED, typed.Return)
+}
+
+func TestSetMigConfigCanceled(t *testing.T) {
+	manager := NewMockLunaServerMigConfigManager()
+
+	r1, r2 := EnableMigMode(manager, 0)
+	require.Equal(t, nvml.SUCCESS, r1.Value())
+	require.Equal(t, nvml.SUCCESS, r2.Value())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := manager.SetMigConfig(ctx, 0, types.MigConfig{"1g.5gb": 7})
+	require.True(t, errors.Is(err, types.ErrCanceled), "Unexpected error from SetMigConfig: %v", err)
+
+	config, err := manager.GetMigConfig(context.Background(), 0)
+	require.Nil(t, err, "Unexpected failure from GetMigConfig")
+	require.Equal(t, 0, len(config.Flatten()), "Unexpected MIG devices created after cancellation")
+
+	_, err = manager.GetMigConfig(ctx, 0)
+	require.True(t, errors.Is(err, types.ErrCanceled), "Unexpected error from GetMigConfig: %v", err)
+}
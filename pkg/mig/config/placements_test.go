@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"context"
+	"testing"
+
+	placements "github.com/NVIDIA/mig-parted/api/placements/v1"
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// requireConsistentPlacements checks that the MIG devices of gpu match the
+// MIG devices of the mock device, and that their placements do not overlap.
+func requireConsistentPlacements(t *testing.T, device nvml.Device, gpu placements.GPUSpec) {
+	used := make(map[int]bool)
+	uuids := make(map[string]bool)
+	for _, d := range gpu.MigDevices {
+		for s := d.Placement.Start; s < d.Placement.Start+d.Placement.Size; s++ {
+			require.False(t, used[s], "Overlapping placement of MIG device %v", d.UUID)
+			used[s] = true
+		}
+
+		require.NotEmpty(t, d.UUID)
+		require.False(t, uuids[d.UUID], "Duplicate UUID of MIG device %v", d.UUID)
+		uuids[d.UUID] = true
+
+		gi, ret := device.GetGpuInstanceById(d.GpuInstanceID)
+		require.Equal(t, nvml.SUCCESS, ret.Value())
+		info, ret := gi.GetInfo()
+		require.Equal(t, nvml.SUCCESS, ret.Value())
+		require.Equal(t, d.Placement.Start, int(info.Placement.Start))
+		require.Equal(t, d.Placement.Size, int(info.Placement.Size))
+	}
+
+	count := 0
+	for i := 0; ; i++ {
+		migDevice, ret := device.GetMigDeviceHandleByIndex(i)
+		if ret.Value() != nvml.SUCCESS {
+			break
+		}
+		uuid, _ := migDevice.GetUUID()
+		require.True(t, uuids[uuid], "MIG device %v missing from placements", uuid)
+		count++
+	}
+	require.Equal(t, len(gpu.MigDevices), count)
+}
+
+func TestGetMigPlacements(t *testing.T) {
+	manager := NewMockLunaServerMigConfigManager()
+	server := manager.(*nvmlMigConfigManager).nvml.(*nvml.MockLunaServer)
+
+	configs := map[int]types.MigConfig{
+		0: {"3g.20gb": 1, "2g.10gb": 1, "1g.5gb": 2},
+		1: {"7g.40gb": 1},
+		2: {"1g.5gb": 7},
+		3: {},
+	}
+	for gpu, config := range configs {
+		r1, r2 := EnableMigMode(manager, gpu)
+		require.Equal(t, nvml.SUCCESS, r1.Value())
+		require.Equal(t, nvml.SUCCESS, r2.Value())
+		err := manager.SetMigConfig(context.Background(), gpu, config)
+		require.Nil(t, err, "Unexpected failure from SetMigConfig on GPU %v", gpu)
+	}
+
+	spec, err := manager.GetMigPlacements(context.Background())
+	require.Nil(t, err, "Unexpected failure from GetMigPlacements")
+	require.Equal(t, placements.Version, spec.Version)
+	require.Len(t, spec.GPUs, len(server.Devices))
+
+	for i, gpu := range spec.GPUs {
+		require.Equal(t, i, gpu.Index)
+		uuid, _ := server.Devices[i].GetUUID()
+		require.Equal(t, uuid, gpu.UUID)
+		require.Equal(t, "A100-SXM4-40GB", gpu.Name)
+		pciInfo, _ := server.Devices[i].GetPciInfo()
+		require.Equal(t, pciInfo.Address(), gpu.PCIAddress)
+
+		config, exists := configs[i]
+		require.Equal(t, exists, gpu.MigEnabled)
+
+		profiles := types.MigConfig{}
+		for _, d := range gpu.MigDevices {
+			profiles[d.Profile]++
+		}
+		require.True(t, profiles.Equals(config), "Unexpected MIG devices on GPU %v: %v", i, profiles)
+
+		requireConsistentPlacements(t, server.Devices[i], gpu)
+	}
+
+	require.Equal(t, []placements.MigDeviceSpec{
+		{
+			UUID:              spec.GPUs[1].MigDevices[0].UUID,
+			Profile:           "7g.40gb",
+			Placement:         placements.Placement{Start: 0, Size: 8},
+			GpuInstanceID:     0,
+			ComputeInstanceID: 0,
+			MemoryMB:          40960,
+		},
+	}, spec.GPUs[1].MigDevices)
+
+	for j, d := range spec.GPUs[2].MigDevices {
+		require.Equal(t, placements.Placement{Start: j, Size: 1}, d.Placement)
+	}
+
+	require.Empty(t, spec.GPUs[3].MigDevices)
+	require.Empty(t, spec.GPUs[4].MigDevices)
+
+	legacy := spec.UUIDsByPlacement()
+	require.Len(t, legacy, len(configs))
+	require.Equal(t, map[int]string{0: spec.GPUs[1].MigDevices[0].UUID}, legacy[1])
+}
+
+func TestGetMigPlacementsCreateDestroy(t *testing.T) {
+	manager := NewMockLunaServerMigConfigManager()
+	server := manager.(*nvmlMigConfigManager).nvml.(*nvml.MockLunaServer)
+	device := server.Devices[0].(*nvml.MockA100Device)
+
+	r1, r2 := EnableMigMode(manager, 0)
+	require.Equal(t, nvml.SUCCESS, r1.Value())
+	require.Equal(t, nvml.SUCCESS, r2.Value())
+
+	getPlacements := func() placements.GPUSpec {
+		spec, err := manager.GetMigPlacements(context.Background())
+		require.Nil(t, err, "Unexpected failure from GetMigPlacements")
+		requireConsistentPlacements(t, device, spec.GPUs[0])
+		return spec.GPUs[0]
+	}
+
+	err := manager.SetMigConfig(context.Background(), 0, types.MigConfig{"1g.5gb": 7})
+	require.Nil(t, err, "Unexpected failure from SetMigConfig")
+	before := getPlacements()
+	require.Len(t, before.MigDevices, 7)
+
+	// Destroy the MIG device placed at slice 3
+	destroyed := before.MigDevices[3]
+	require.Equal(t, 3, destroyed.Placement.Start)
+	gi, ret := device.GetGpuInstanceById(destroyed.GpuInstanceID)
+	require.Equal(t, nvml.SUCCESS, ret.Value())
+	for ci := range gi.(*nvml.MockA100GpuInstance).ComputeInstances {
+		require.Equal(t, nvml.SUCCESS, ci.Destroy().Value())
+	}
+	require.Equal(t, nvml.SUCCESS, gi.Destroy().Value())
+
+	_, ret = device.GetGpuInstanceById(destroyed.GpuInstanceID)
+	require.Equal(t, nvml.ERROR_NOT_FOUND, ret.Value())
+
+	after := getPlacements()
+	require.Len(t, after.MigDevices, 6)
+	require.Equal(t, append(append([]placements.MigDeviceSpec{}, before.MigDevices[:3]...), before.MigDevices[4:]...), after.MigDevices)
+
+	// A new MIG device fills the freed slice with a new identity
+	giProfileInfo, ret := device.GetGpuInstanceProfileInfo(nvml.GPU_INSTANCE_PROFILE_1_SLICE)
+	require.Equal(t, nvml.SUCCESS, ret.Value())
+	gi, ret = device.CreateGpuInstance(&giProfileInfo)
+	require.Equal(t, nvml.SUCCESS, ret.Value())
+	ciProfileInfo, ret := gi.GetComputeInstanceProfileInfo(nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE, nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_SHARED)
+	require.Equal(t, nvml.SUCCESS, ret.Value())
+	_, ret = gi.CreateComputeInstance(&ciProfileInfo)
+	require.Equal(t, nvml.SUCCESS, ret.Value())
+
+	refilled := getPlacements()
+	require.Len(t, refilled.MigDevices, 7)
+	require.Equal(t, 3, refilled.MigDevices[3].Placement.Start)
+	require.NotEqual(t, destroyed.UUID, refilled.MigDevices[3].UUID)
+	require.NotEqual(t, destroyed.GpuInstanceID, refilled.MigDevices[3].GpuInstanceID)
+
+	// No slice is left for another one
+	_, ret = device.CreateGpuInstance(&giProfileInfo)
+	require.Equal(t, nvml.ERROR_INSUFFICIENT_RESOURCES, ret.Value())
+
+	err = manager.SetMigConfig(context.Background(), 0, types.MigConfig{"3g.20gb": 2})
+	require.Nil(t, err, "Unexpected failure from SetMigConfig")
+	reconfigured := getPlacements()
+	require.Len(t, reconfigured.MigDevices, 2)
+	require.Equal(t, placements.Placement{Start: 0, Size: 4}, reconfigured.MigDevices[0].Placement)
+	require.Equal(t, placements.Placement{Start: 4, Size: 4}, reconfigured.MigDevices[1].Placement)
+
+	_, err = manager.ClearAndGetInstancesToCreate(context.Background(), 0, nil)
+	require.Nil(t, err, "Unexpected failure from ClearAndGetInstancesToCreate")
+	require.Empty(t, getPlacements().MigDevices)
+	_, ret = device.GetMigDeviceHandleByIndex(0)
+	require.Equal(t, nvml.ERROR_NOT_FOUND, ret.Value())
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/types"
+)
+
+// NoInstanceID is the value NVML reports for the GPU and compute instance
+// IDs of a process that is not running on a MIG device.
+const NoInstanceID = ^uint32(0)
+
+// Process represents a compute process running on a GPU or on one of its MIG
+// devices. MigUUID is empty if the process is not running on a MIG device.
+type Process struct {
+	Pid               uint32
+	UsedGpuMemory     uint64
+	GpuInstanceID     uint32
+	ComputeInstanceID uint32
+	MigUUID           string
+}
+
+func (p Process) String() string {
+	if p.MigUUID == "" {
+		return fmt.Sprintf("%v", p.Pid)
+	}
+	return fmt.Sprintf("%v (%v)", p.Pid, p.MigUUID)
+}
+
+func (m *nvmlMigConfigManager) GetComputeProcesses(ctx context.Context, gpu int) ([]Process, error) {
+	if ctx.Err() != nil {
+		return nil, types.NewContextError(gpu, ctx.Err())
+	}
+
+	ret := m.nvml.Init()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(gpu, ret.Value(), "error initializing NVML: %v", ret)
+	}
+	defer tryNvmlShutdown(m.nvml)
+
+	device, ret := m.nvml.DeviceGetHandleByIndex(gpu)
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(gpu, ret.Value(), "error getting device handle: %v", ret)
+	}
+
+	migEnabled := false
+	mode, _, ret := device.GetMigMode()
+	if ret.Value() != nvml.SUCCESS && ret.Value() != nvml.ERROR_NOT_SUPPORTED {
+		return nil, types.NewNvmlError(gpu, ret.Value(), "error getting MIG mode: %v", ret)
+	}
+	if ret.Value() == nvml.SUCCESS && mode == nvml.DEVICE_MIG_ENABLE {
+		migEnabled = true
+	}
+
+	infos, ret := device.GetComputeRunningProcesses()
+	if ret.Value() == nvml.ERROR_NO_PERMISSION && migEnabled {
+		// Aggregate process information on a GPU with MIG mode enabled is
+		// only available to privileged callers. Fall back to querying each
+		// MIG device individually in that case.
+		return getComputeProcessesPerMigDevice(gpu, device)
+	}
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(gpu, ret.Value(), "error getting running compute processes: %v", ret)
+	}
+
+	if !migEnabled {
+		var processes []Process
+		for _, info := range infos {
+			processes = append(processes, Process{
+				Pid:               info.Pid,
+				UsedGpuMemory:     info.UsedGpuMemory,
+				GpuInstanceID:     NoInstanceID,
+				ComputeInstanceID: NoInstanceID,
+			})
+		}
+		return processes, nil
+	}
+
+	uuids, err := getMigDeviceUUIDsByInstanceIDs(gpu, device)
+	if err != nil {
+		return nil, err
+	}
+
+	var processes []Process
+	for _, info := range infos {
+		processes = append(processes, Process{
+			Pid:               info.Pid,
+			UsedGpuMemory:     info.UsedGpuMemory,
+			GpuInstanceID:     info.GpuInstanceId,
+			ComputeInstanceID: info.ComputeInstanceId,
+			MigUUID:           uuids[[2]uint32{info.GpuInstanceId, info.ComputeInstanceId}],
+		})
+	}
+	return processes, nil
+}
+
+func getMigDeviceUUIDsByInstanceIDs(gpu int, device nvml.Device) (map[[2]uint32]string, error) {
+	uuids := make(map[[2]uint32]string)
+	err := walkMigDevices(gpu, device, func(migDevice nvml.Device, giID, ciID uint32, uuid string) error {
+		uuids[[2]uint32{giID, ciID}] = uuid
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return uuids, nil
+}
+
+func getComputeProcessesPerMigDevice(gpu int, device nvml.Device) ([]Process, error) {
+	var processes []Process
+	err := walkMigDevices(gpu, device, func(migDevice nvml.Device, giID, ciID uint32, uuid string) error {
+		infos, ret := migDevice.GetComputeRunningProcesses()
+		if ret.Value() != nvml.SUCCESS {
+			return types.NewNvmlError(gpu, ret.Value(), "error getting running compute processes for MIG device '%v': %v", uuid, ret)
+		}
+		for _, info := range infos {
+			processes = append(processes, Process{
+				Pid:               info.Pid,
+				UsedGpuMemory:     info.UsedGpuMemory,
+				GpuInstanceID:     giID,
+				ComputeInstanceID: ciID,
+				MigUUID:           uuid,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return processes, nil
+}
+
+func walkMigDevices(gpu int, device nvml.Device, f func(nvml.Device, uint32, uint32, string) error) error {
+	maxMigDevices, ret := device.GetMaxMigDeviceCount()
+	if ret.Value() != nvml.SUCCESS {
+		return types.NewNvmlError(gpu, ret.Value(), "error getting max MIG device count: %v", ret)
+	}
+
+	for i := 0; i < maxMigDevices; i++ {
+		migDevice, ret := device.GetMigDeviceHandleByIndex(i)
+		if ret.Value() == nvml.ERROR_NOT_FOUND || ret.Value() == nvml.ERROR_INVALID_ARGUMENT {
+			continue
+		}
+		if ret.Value() != nvml.SUCCESS {
+			return types.NewNvmlError(gpu, ret.Value(), "error getting MIG device handle at index '%v': %v", i, ret)
+		}
+
+		uuid, ret := migDevice.GetUUID()
+		if ret.Value() != nvml.SUCCESS {
+			return types.NewNvmlError(gpu, ret.Value(), "error getting MIG device UUID at index '%v': %v", i, ret)
+		}
+
+		giID, ret := migDevice.GetGpuInstanceId()
+		if ret.Value() != nvml.SUCCESS {
+			return types.NewNvmlError(gpu, ret.Value(), "error getting GPU instance ID for MIG device '%v': %v", uuid, ret)
+		}
+
+		ciID, ret := migDevice.GetComputeInstanceId()
+		if ret.Value() != nvml.SUCCESS {
+			return types.NewNvmlError(gpu, ret.Value(), "error getting Compute instance ID for MIG device '%v': %v", uuid, ret)
+		}
+
+		err := f(migDevice, uint32(giID), uint32(ciID), uuid)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
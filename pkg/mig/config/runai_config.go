@@ -1,63 +1,190 @@
 package config
 
 import (
-	"fmt"
+	"context"
+	"sort"
 
+	placements "github.com/NVIDIA/mig-parted/api/placements/v1"
 	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/types"
 )
 
-func (m *nvmlMigConfigManager) GetMigPlacements() (map[int]map[int]string, error) {
+// migDeviceKey identifies a MIG device by the IDs of its GPU and compute
+// instances.
+type migDeviceKey struct {
+	gi int
+	ci int
+}
+
+// GetMigPlacements returns the MIG devices of all GPUs of the node, along
+// with where they are placed on their GPU and the instances backing them.
+func (m *nvmlMigConfigManager) GetMigPlacements(ctx context.Context) (*placements.Spec, error) {
+	if ctx.Err() != nil {
+		return nil, types.NewContextError(-1, ctx.Err())
+	}
+
 	ret := m.nvml.Init()
 	if ret.Value() != nvml.SUCCESS {
-		return nil, fmt.Errorf("error initializing NVML: %v", ret)
+		return nil, types.NewNvmlError(-1, ret.Value(), "error initializing NVML: %v", ret)
 	}
 	defer tryNvmlShutdown(m.nvml)
 
 	deviceCount, ret := m.nvml.DeviceGetCount()
 	if ret.Value() != nvml.SUCCESS {
-		return nil, fmt.Errorf("Failed to read device count: %s", ret.String())
+		return nil, types.NewNvmlError(-1, ret.Value(), "Failed to read device count: %s", ret.String())
 	}
-	migPlacements := make(map[int]map[int]string)
 
+	spec := &placements.Spec{
+		Version: placements.Version,
+		GPUs:    []placements.GPUSpec{},
+	}
 	for gpuIndex := 0; gpuIndex < deviceCount; gpuIndex++ {
 		gpuDevice, ret := m.nvml.DeviceGetHandleByIndex(gpuIndex)
 		if ret.Value() != nvml.SUCCESS {
-			return nil, fmt.Errorf("Failed to get device index %d: %s", gpuIndex, ret.String())
+			return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to get device index %d: %s", gpuIndex, ret.String())
+		}
+		gpu, err := getGPUPlacements(gpuIndex, gpuDevice)
+		if err != nil {
+			return nil, err
 		}
-		enabled, _, ret := gpuDevice.GetMigMode()
-		if ret.Value() != nvml.SUCCESS || enabled != nvml.DEVICE_MIG_ENABLE {
+		spec.GPUs = append(spec.GPUs, *gpu)
+	}
+	return spec, nil
+}
+
+func getGPUPlacements(gpuIndex int, gpuDevice nvml.Device) (*placements.GPUSpec, error) {
+	uuid, ret := gpuDevice.GetUUID()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to read device UUID: gpu: %d: %s", gpuIndex, ret.String())
+	}
+	name, ret := gpuDevice.GetName()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to read device name: gpu: %d: %s", gpuIndex, ret.String())
+	}
+	pciInfo, ret := gpuDevice.GetPciInfo()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to read device PCI info: gpu: %d: %s", gpuIndex, ret.String())
+	}
+
+	gpu := &placements.GPUSpec{
+		Index:      gpuIndex,
+		UUID:       uuid,
+		Name:       name,
+		PCIAddress: pciInfo.Address(),
+		MigDevices: []placements.MigDeviceSpec{},
+	}
+
+	enabled, _, ret := gpuDevice.GetMigMode()
+	if ret.Value() != nvml.SUCCESS || enabled != nvml.DEVICE_MIG_ENABLE {
+		return gpu, nil
+	}
+	gpu.MigEnabled = true
+
+	uuids, err := getMigDeviceUUIDs(gpuIndex, gpuDevice)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < nvml.GPU_INSTANCE_PROFILE_COUNT; i++ {
+		giProfileInfo, ret := gpuDevice.GetGpuInstanceProfileInfo(i)
+		if ret.Value() == nvml.ERROR_NOT_SUPPORTED {
 			continue
 		}
-		maxMigDevices, ret := gpuDevice.GetMaxMigDeviceCount()
 		if ret.Value() != nvml.SUCCESS {
-			return nil, fmt.Errorf("Failed to read max mig devices: %s", ret.String())
+			return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to get gpu instance profile info for '%v': %s", i, ret.String())
 		}
 
-		migPlacements[gpuIndex] = make(map[int]string)
+		gis, ret := gpuDevice.GetGpuInstances(&giProfileInfo)
+		if ret.Value() != nvml.SUCCESS {
+			return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to get gpu instances for profile '%v': %s", i, ret.String())
+		}
 
-		for migIndex := 0; migIndex < maxMigDevices; migIndex++ {
-			migDevice, ret := gpuDevice.GetMigDeviceHandleByIndex(migIndex)
+		for _, gi := range gis {
+			giInfo, ret := gi.GetInfo()
 			if ret.Value() != nvml.SUCCESS {
-				break
+				return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to get gpu instance info: gpu: %d: %s", gpuIndex, ret.String())
 			}
-			uuid, ret := migDevice.GetUUID()
-			if ret.Value() != nvml.SUCCESS {
-				return nil, fmt.Errorf("Failed to read mig device UUID: gpu: %d, mig index: %d: %s", gpuIndex, migIndex, ret.String())
-			}
-			gpuInstanceId, ret := migDevice.GetGpuInstanceId()
-			if ret.Value() != nvml.SUCCESS {
-				return nil, fmt.Errorf("Failed to read mig device gpu instance id: gpu: %d, mig index: %d: %s", gpuIndex, migIndex, ret.String())
-			}
-			gpuInstance, ret := gpuDevice.GetGpuInstanceById(gpuInstanceId)
-			if ret.Value() != nvml.SUCCESS {
-				return nil, fmt.Errorf("Failed to get gpu instance with id %d for mig device %d on gpu %d: %s", gpuInstanceId, migIndex, gpuIndex, ret.String())
-			}
-			info, ret := gpuInstance.GetInfo()
-			if ret.Value() != nvml.SUCCESS {
-				return nil, fmt.Errorf("Failed to get gpu instance info: gpu instance id: %d, mig device %d on gpu index: %d: %s", gpuInstanceId, migIndex, gpuIndex, ret.String())
+
+			for j := 0; j < nvml.COMPUTE_INSTANCE_PROFILE_COUNT; j++ {
+				for k := 0; k < nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_COUNT; k++ {
+					ciProfileInfo, ret := gi.GetComputeInstanceProfileInfo(j, k)
+					if ret.Value() == nvml.ERROR_NOT_SUPPORTED {
+						continue
+					}
+					if ret.Value() != nvml.SUCCESS {
+						return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to get compute instance profile info for '(%v, %v)': %s", j, k, ret.String())
+					}
+
+					cis, ret := gi.GetComputeInstances(&ciProfileInfo)
+					if ret.Value() != nvml.SUCCESS {
+						return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to get compute instances for profile '(%v, %v)': %s", j, k, ret.String())
+					}
+
+					for _, ci := range cis {
+						ciInfo, ret := ci.GetInfo()
+						if ret.Value() != nvml.SUCCESS {
+							return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to get compute instance info: gpu: %d, gpu instance id: %d: %s", gpuIndex, giInfo.Id, ret.String())
+						}
+
+						key := migDeviceKey{int(giInfo.Id), int(ciInfo.Id)}
+						gpu.MigDevices = append(gpu.MigDevices, placements.MigDeviceSpec{
+							UUID:    uuids[key],
+							Profile: types.NewMigProfile(ciProfileInfo.SliceCount, giProfileInfo.SliceCount, giProfileInfo.MemorySizeMB),
+							Placement: placements.Placement{
+								Start: int(giInfo.Placement.Start),
+								Size:  int(giInfo.Placement.Size),
+							},
+							GpuInstanceID:     key.gi,
+							ComputeInstanceID: key.ci,
+							MemoryMB:          giProfileInfo.MemorySizeMB,
+						})
+					}
+				}
 			}
-			migPlacements[gpuIndex][int(info.Placement.Start)] = uuid
 		}
 	}
-	return migPlacements, nil
+
+	sort.SliceStable(gpu.MigDevices, func(i, j int) bool {
+		a, b := gpu.MigDevices[i], gpu.MigDevices[j]
+		if a.Placement.Start != b.Placement.Start {
+			return a.Placement.Start < b.Placement.Start
+		}
+		if a.GpuInstanceID != b.GpuInstanceID {
+			return a.GpuInstanceID < b.GpuInstanceID
+		}
+		return a.ComputeInstanceID < b.ComputeInstanceID
+	})
+
+	return gpu, nil
+}
+
+// getMigDeviceUUIDs returns the UUIDs of the MIG devices of a GPU, keyed by
+// the IDs of their GPU and compute instances.
+func getMigDeviceUUIDs(gpuIndex int, gpuDevice nvml.Device) (map[migDeviceKey]string, error) {
+	maxMigDevices, ret := gpuDevice.GetMaxMigDeviceCount()
+	if ret.Value() != nvml.SUCCESS {
+		return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to read max mig devices: %s", ret.String())
+	}
+
+	uuids := make(map[migDeviceKey]string)
+	for migIndex := 0; migIndex < maxMigDevices; migIndex++ {
+		migDevice, ret := gpuDevice.GetMigDeviceHandleByIndex(migIndex)
+		if ret.Value() != nvml.SUCCESS {
+			break
+		}
+		uuid, ret := migDevice.GetUUID()
+		if ret.Value() != nvml.SUCCESS {
+			return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to read mig device UUID: gpu: %d, mig index: %d: %s", gpuIndex, migIndex, ret.String())
+		}
+		gpuInstanceId, ret := migDevice.GetGpuInstanceId()
+		if ret.Value() != nvml.SUCCESS {
+			return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to read mig device gpu instance id: gpu: %d, mig index: %d: %s", gpuIndex, migIndex, ret.String())
+		}
+		computeInstanceId, ret := migDevice.GetComputeInstanceId()
+		if ret.Value() != nvml.SUCCESS {
+			return nil, types.NewNvmlError(gpuIndex, ret.Value(), "Failed to read mig device compute instance id: gpu: %d, mig index: %d: %s", gpuIndex, migIndex, ret.String())
+		}
+		uuids[migDeviceKey{gpuInstanceId, computeInstanceId}] = uuid
+	}
+	return uuids, nil
 }
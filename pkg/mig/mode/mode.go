@@ -16,6 +16,10 @@
 
 package mode
 
+import (
+	"context"
+)
+
 type MigMode int
 
 const (
@@ -33,9 +37,12 @@ func (m MigMode) String() string {
 	return "Unknown"
 }
 
+// Manager queries and changes the MIG mode of the GPUs on a node. The
+// context passed to each call is checked before any device is touched, so
+// an in-flight NVML call or register access is never interrupted.
 type Manager interface {
-	IsMigCapable(gpu int) (bool, error)
-	GetMigMode(gpu int) (MigMode, error)
-	SetMigMode(gpu int, mode MigMode) error
-	IsMigModeChangePending(gpu int) (bool, error)
+	IsMigCapable(ctx context.Context, gpu int) (bool, error)
+	GetMigMode(ctx context.Context, gpu int) (MigMode, error)
+	SetMigMode(ctx context.Context, gpu int, mode MigMode) error
+	IsMigModeChangePending(ctx context.Context, gpu int) (bool, error)
 }
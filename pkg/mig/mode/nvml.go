@@ -17,9 +17,10 @@
 package mode
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/NVIDIA/mig-parted/internal/nvml"
+	"github.com/NVIDIA/mig-parted/pkg/types"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -40,16 +41,26 @@ func NewNvmlMigModeManager() Manager {
 	return &nvmlMigModeManager{nvml.New()}
 }
 
-func (m *nvmlMigModeManager) IsMigCapable(gpu int) (bool, error) {
+// NewNvmlMigModeManagerWith returns a Manager backed by the given NVML
+// interface, e.g. a mock of it in tests.
+func NewNvmlMigModeManagerWith(nvmlLib nvml.Interface) Manager {
+	return &nvmlMigModeManager{nvmlLib}
+}
+
+func (m *nvmlMigModeManager) IsMigCapable(ctx context.Context, gpu int) (bool, error) {
+	if ctx.Err() != nil {
+		return false, types.NewContextError(gpu, ctx.Err())
+	}
+
 	ret := m.nvml.Init()
 	if ret.Value() != nvml.SUCCESS {
-		return false, fmt.Errorf("error initializing NVML: %v", ret)
+		return false, types.NewNvmlError(gpu, ret.Value(), "error initializing NVML: %v", ret)
 	}
 	defer tryNvmlShutdown(m.nvml)
 
 	device, ret := m.nvml.DeviceGetHandleByIndex(gpu)
 	if ret.Value() != nvml.SUCCESS {
-		return false, fmt.Errorf("error getting device handle: %v", ret)
+		return false, types.NewNvmlError(gpu, ret.Value(), "error getting device handle: %v", ret)
 	}
 
 	_, _, ret = device.GetMigMode()
@@ -57,27 +68,31 @@ func (m *nvmlMigModeManager) IsMigCapable(gpu int) (bool, error) {
 		return false, nil
 	}
 	if ret.Value() != nvml.SUCCESS {
-		return false, fmt.Errorf("error getting Mig mode: %v", ret)
+		return false, types.NewNvmlError(gpu, ret.Value(), "error getting Mig mode: %v", ret)
 	}
 
 	return true, nil
 }
 
-func (m *nvmlMigModeManager) GetMigMode(gpu int) (MigMode, error) {
+func (m *nvmlMigModeManager) GetMigMode(ctx context.Context, gpu int) (MigMode, error) {
+	if ctx.Err() != nil {
+		return -1, types.NewContextError(gpu, ctx.Err())
+	}
+
 	ret := m.nvml.Init()
 	if ret.Value() != nvml.SUCCESS {
-		return -1, fmt.Errorf("error initializing NVML: %v", ret)
+		return -1, types.NewNvmlError(gpu, ret.Value(), "error initializing NVML: %v", ret)
 	}
 	defer tryNvmlShutdown(m.nvml)
 
 	device, ret := m.nvml.DeviceGetHandleByIndex(gpu)
 	if ret.Value() != nvml.SUCCESS {
-		return -1, fmt.Errorf("error getting device handle: %v", ret)
+		return -1, types.NewNvmlError(gpu, ret.Value(), "error getting device handle: %v", ret)
 	}
 
 	current, _, ret := device.GetMigMode()
 	if ret.Value() != nvml.SUCCESS {
-		return -1, fmt.Errorf("error getting Mig mode settings: %v", ret)
+		return -1, types.NewNvmlError(gpu, ret.Value(), "error getting Mig mode settings: %v", ret)
 	}
 
 	switch current {
@@ -87,19 +102,23 @@ func (m *nvmlMigModeManager) GetMigMode(gpu int) (MigMode, error) {
 		return Disabled, nil
 	}
 
-	return -1, fmt.Errorf("unknown Mig mode returned by NVML: %v", current)
+	return -1, types.NewError(types.ErrorCategoryNvml, gpu, "unknown Mig mode returned by NVML: %v", current)
 }
 
-func (m *nvmlMigModeManager) SetMigMode(gpu int, mode MigMode) error {
+func (m *nvmlMigModeManager) SetMigMode(ctx context.Context, gpu int, mode MigMode) error {
+	if ctx.Err() != nil {
+		return types.NewContextError(gpu, ctx.Err())
+	}
+
 	ret := m.nvml.Init()
 	if ret.Value() != nvml.SUCCESS {
-		return fmt.Errorf("error initializing NVML: %v", ret)
+		return types.NewNvmlError(gpu, ret.Value(), "error initializing NVML: %v", ret)
 	}
 	defer tryNvmlShutdown(m.nvml)
 
 	device, ret := m.nvml.DeviceGetHandleByIndex(gpu)
 	if ret.Value() != nvml.SUCCESS {
-		return fmt.Errorf("error getting device handle: %v", ret)
+		return types.NewNvmlError(gpu, ret.Value(), "error getting device handle: %v", ret)
 	}
 
 	switch mode {
@@ -108,30 +127,34 @@ func (m *nvmlMigModeManager) SetMigMode(gpu int, mode MigMode) error {
 	case Enabled:
 		_, ret = device.SetMigMode(nvml.DEVICE_MIG_ENABLE)
 	default:
-		return fmt.Errorf("unknown Mig mode selected: %v", mode)
+		return types.NewError(types.ErrorCategoryInvalidConfig, gpu, "unknown Mig mode selected: %v", mode)
 	}
 	if ret.Value() != nvml.SUCCESS {
-		return fmt.Errorf("error setting Mig mode: %v", ret)
+		return types.NewNvmlError(gpu, ret.Value(), "error setting Mig mode: %v", ret)
 	}
 
 	return nil
 }
 
-func (m *nvmlMigModeManager) IsMigModeChangePending(gpu int) (bool, error) {
+func (m *nvmlMigModeManager) IsMigModeChangePending(ctx context.Context, gpu int) (bool, error) {
+	if ctx.Err() != nil {
+		return false, types.NewContextError(gpu, ctx.Err())
+	}
+
 	ret := m.nvml.Init()
 	if ret.Value() != nvml.SUCCESS {
-		return false, fmt.Errorf("error initializing NVML: %v", ret)
+		return false, types.NewNvmlError(gpu, ret.Value(), "error initializing NVML: %v", ret)
 	}
 	defer tryNvmlShutdown(m.nvml)
 
 	device, ret := m.nvml.DeviceGetHandleByIndex(gpu)
 	if ret.Value() != nvml.SUCCESS {
-		return false, fmt.Errorf("error getting device handle: %v", ret)
+		return false, types.NewNvmlError(gpu, ret.Value(), "error getting device handle: %v", ret)
 	}
 
 	current, pending, ret := device.GetMigMode()
 	if ret.Value() != nvml.SUCCESS {
-		return false, fmt.Errorf("error getting Mig mode settings: %v", ret)
+		return false, types.NewNvmlError(gpu, ret.Value(), "error getting Mig mode settings: %v", ret)
 	}
 
 	if current == pending {
@@ -17,6 +17,7 @@
 package mode
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -78,7 +79,7 @@ func TestNvmlIsMigCapable(t *testing.T) {
 
 	for i := 0; i < numGPUs; i++ {
 		t.Run(fmt.Sprintf("GPU %v", i), func(t *testing.T) {
-			capable, err := manager.IsMigCapable(i)
+			capable, err := manager.IsMigCapable(context.Background(), i)
 			require.Nil(t, err, "Unexpected failure from IsMigCapable")
 			require.True(t, capable)
 
@@ -86,7 +87,7 @@ func TestNvmlIsMigCapable(t *testing.T) {
 			device := server.Devices[i].(*mockNvmlA100Device)
 			device.migCapable = false
 
-			capable, err = manager.IsMigCapable(i)
+			capable, err = manager.IsMigCapable(context.Background(), i)
 			require.Nil(t, err, "Unexpected failure from IsMigCapable")
 			require.False(t, capable)
 		})
@@ -102,17 +103,17 @@ func TestNvmlEnableDisableMig(t *testing.T) {
 
 	for i := 0; i < numGPUs; i++ {
 		t.Run(fmt.Sprintf("GPU %v", i), func(t *testing.T) {
-			err := manager.SetMigMode(i, Enabled)
+			err := manager.SetMigMode(context.Background(), i, Enabled)
 			require.Nil(t, err, "Unexpected failure from SetMigMode")
 
-			mode, err := manager.GetMigMode(i)
+			mode, err := manager.GetMigMode(context.Background(), i)
 			require.Nil(t, err, "Unexpected failure from GetMigMode")
 			require.Equal(t, Enabled, mode)
 
-			err = manager.SetMigMode(i, Disabled)
+			err = manager.SetMigMode(context.Background(), i, Disabled)
 			require.Nil(t, err, "Unexpected failure from SetMigMode")
 
-			mode, err = manager.GetMigMode(i)
+			mode, err = manager.GetMigMode(context.Background(), i)
 			require.Nil(t, err, "Unexpected failure from GetMigMode")
 			require.Equal(t, Disabled, mode)
 
@@ -120,14 +121,14 @@ func TestNvmlEnableDisableMig(t *testing.T) {
 			device := server.Devices[i].(*mockNvmlA100Device)
 			device.driverBusy = true
 
-			err = manager.SetMigMode(i, Enabled)
+			err = manager.SetMigMode(context.Background(), i, Enabled)
 			require.Nil(t, err, "Unexpected failure from SetMigMode")
 
-			mode, err = manager.GetMigMode(i)
+			mode, err = manager.GetMigMode(context.Background(), i)
 			require.Nil(t, err, "Unexpected failure from GetMigMode")
 			require.Equal(t, Disabled, mode)
 
-			pending, err := manager.IsMigModeChangePending(i)
+			pending, err := manager.IsMigModeChangePending(context.Background(), i)
 			require.Nil(t, err, "Unexpected failure from IsMigModeChangePending")
 			require.True(t, pending)
 		})
@@ -17,18 +17,26 @@
 package mode
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/types"
 	log "github.com/sirupsen/logrus"
 
-	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci/mmio"
 )
 
+// Registers of the GA100 architecture. Other architectures are described by
+// the pciArchitectures table.
 const (
 	PmcIDReg = 0
 
+	// PmcIDArchMask selects the architecture and implementation fields of
+	// PMC_BOOT_0 (bits 20:28), ignoring the revision of the chip.
+	PmcIDArchMask = uint32(0x1FF00000)
+
 	BootCompleteReg   = 0x118234
 	BootCompleteValue = uint32(0x03FF)
 
@@ -40,65 +48,126 @@ const (
 	MigModeSetEnabled  = uint32(0xC000) // Bits 14:15 11
 	MigModeSetDisabled = uint32(0x8000) // Bits 14:15 10
 
-	WaitForBootTimeout       = 5 * time.Second
-	WaitForBootSleepInterval = 100 * time.Millisecond
+	WaitForBootTimeout          = 5 * time.Second
+	WaitForBootSleepInterval    = 100 * time.Millisecond
+	WaitForBootMaxSleepInterval = 1 * time.Second
 )
 
-var migCapablePmcIDs = []uint32{
-	0x170000a1, // GA100 Chip Set
+// BootWaiter is implemented by Managers that can wait for a GPU to finish
+// booting, e.g. after it has been reset.
+type BootWaiter interface {
+	WaitForBoot(ctx context.Context, gpu int) error
 }
 
 type pciMigModeManager struct {
-	nvpci nvpci.Interface
+	gpus                enumerator.Interface
+	bootTimeout         time.Duration
+	bootPollInterval    time.Duration
+	bootMaxPollInterval time.Duration
 }
 
 var _ Manager = (*pciMigModeManager)(nil)
+var _ BootWaiter = (*pciMigModeManager)(nil)
+
+// PciOption is a functional option for the PCI MIG mode manager.
+type PciOption func(m *pciMigModeManager)
 
-func NewPciMigModeManager() Manager {
-	return &pciMigModeManager{nvpci.New()}
+// WithBootTimeout sets how long to wait for a GPU to finish booting before
+// giving up with an ErrNotBooted error.
+func WithBootTimeout(timeout time.Duration) PciOption {
+	return func(m *pciMigModeManager) {
+		m.bootTimeout = timeout
+	}
 }
 
-func (m *pciMigModeManager) openBar0(gpu int) (mmio.Mmio, error) {
-	gpus, err := m.nvpci.GetGPUs()
+// WithBootPollInterval sets the initial interval between two checks of
+// whether a GPU has finished booting. The interval doubles after each check.
+func WithBootPollInterval(interval time.Duration) PciOption {
+	return func(m *pciMigModeManager) {
+		m.bootPollInterval = interval
+	}
+}
+
+// WithBootMaxPollInterval sets the interval between two checks of whether a
+// GPU has finished booting beyond which it stops doubling.
+func WithBootMaxPollInterval(interval time.Duration) PciOption {
+	return func(m *pciMigModeManager) {
+		m.bootMaxPollInterval = interval
+	}
+}
+
+func NewPciMigModeManager(opts ...PciOption) Manager {
+	return NewPciMigModeManagerWith(enumerator.New(), opts...)
+}
+
+// NewPciMigModeManagerWith returns a Manager operating on the GPUs of the
+// given enumerator, which must not be filtered and must return devices with
+// their MMIO resources.
+func NewPciMigModeManagerWith(gpus enumerator.Interface, opts ...PciOption) Manager {
+	m := &pciMigModeManager{
+		gpus:                gpus,
+		bootTimeout:         WaitForBootTimeout,
+		bootPollInterval:    WaitForBootSleepInterval,
+		bootMaxPollInterval: WaitForBootMaxSleepInterval,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.bootPollInterval <= 0 {
+		m.bootPollInterval = WaitForBootSleepInterval
+	}
+	if m.bootMaxPollInterval < m.bootPollInterval {
+		m.bootMaxPollInterval = m.bootPollInterval
+	}
+	return m
+}
+
+func (m *pciMigModeManager) getDevice(gpu int) (enumerator.GPU, error) {
+	gpus, err := m.gpus.GetGPUs()
 	if err != nil {
-		return nil, fmt.Errorf("error getting list of GPUs: %v", err)
+		return enumerator.GPU{}, types.NewError(types.ErrorCategoryPci, gpu, "error getting list of GPUs: %v", err)
 	}
 
-	if gpu >= len(gpus) {
-		return nil, fmt.Errorf("GPU index out of range: %v", gpu)
+	for _, device := range gpus {
+		if device.Index == gpu {
+			return device, nil
+		}
+	}
+
+	return enumerator.GPU{}, types.NewError(types.ErrorCategoryPci, gpu, "GPU index out of range: %v", gpu)
+}
+
+func (m *pciMigModeManager) openBar0(gpu int) (mmio.Mmio, error) {
+	device, err := m.getDevice(gpu)
+	if err != nil {
+		return nil, err
 	}
 
-	device := gpus[gpu]
 	if len(device.Resources) < 1 {
-		return nil, fmt.Errorf("missing bar0 MMIO resource")
+		return nil, types.NewError(types.ErrorCategoryPci, gpu, "missing bar0 MMIO resource")
 	}
 
 	bar0, err := device.Resources[0].Open()
 	if err != nil {
-		return nil, fmt.Errorf("error opening bar0 MMIO resource: %v", err)
+		return nil, types.NewError(types.ErrorCategoryPci, gpu, "error opening bar0 MMIO resource: %v", err)
 	}
 
 	return bar0, nil
 }
 
 func (m *pciMigModeManager) openBar0ReadOnly(gpu int) (mmio.Mmio, error) {
-	gpus, err := m.nvpci.GetGPUs()
+	device, err := m.getDevice(gpu)
 	if err != nil {
-		return nil, fmt.Errorf("error getting list of GPUs: %v", err)
-	}
-
-	if gpu >= len(gpus) {
-		return nil, fmt.Errorf("GPU index out of range: %v", gpu)
+		return nil, err
 	}
 
-	device := gpus[gpu]
 	if len(device.Resources) < 1 {
-		return nil, fmt.Errorf("missing bar0 MMIO resource")
+		return nil, types.NewError(types.ErrorCategoryPci, gpu, "missing bar0 MMIO resource")
 	}
 
 	bar0, err := device.Resources[0].OpenReadOnly()
 	if err != nil {
-		return nil, fmt.Errorf("error opening bar0 MMIO resource: %v", err)
+		return nil, types.NewError(types.ErrorCategoryPci, gpu, "error opening bar0 MMIO resource: %v", err)
 	}
 
 	return bar0, nil
@@ -111,24 +180,37 @@ func (m *pciMigModeManager) tryCloseBar0(bar0 mmio.Mmio) {
 	}
 }
 
-func (m *pciMigModeManager) waitForBoot(bar0 mmio.Mmio) error {
-	const iterations = int(WaitForBootTimeout / WaitForBootSleepInterval)
-	attempts := 0
+// waitForBoot polls bar0 with exponential backoff until the GPU reports that
+// it has finished booting, or the boot timeout expires.
+func (m *pciMigModeManager) waitForBoot(ctx context.Context, gpu int, bar0 mmio.Mmio) error {
+	arch := lookupPciArchitecture(bar0)
+	if arch == nil {
+		arch = &pciArchitectures[0]
+	}
+
+	timeout := time.NewTimer(m.bootTimeout)
+	defer timeout.Stop()
+
+	interval := m.bootPollInterval
 	for {
-		reg := bar0.Read32(BootCompleteReg)
-		if reg == BootCompleteValue {
+		if arch.isBootComplete(bar0) {
 			return nil
 		}
-		attempts++
-		if attempts == iterations {
-			break
+		select {
+		case <-ctx.Done():
+			return types.NewContextError(gpu, ctx.Err())
+		case <-timeout.C:
+			return types.NewError(types.ErrorCategoryNotBooted, gpu, "GPU did not finish booting after %v", m.bootTimeout)
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > m.bootMaxPollInterval {
+			interval = m.bootMaxPollInterval
 		}
-		time.Sleep(WaitForBootSleepInterval)
 	}
-	return fmt.Errorf("timeout after %v seconds", WaitForBootTimeout)
 }
 
-func (m *pciMigModeManager) openBar0AndWaitForBoot(gpu int) (_ mmio.Mmio, rerr error) {
+func (m *pciMigModeManager) openBar0AndWaitForBoot(ctx context.Context, gpu int) (_ mmio.Mmio, rerr error) {
 	bar0, err := m.openBar0(gpu)
 	if err != nil {
 		return nil, err
@@ -139,15 +221,15 @@ func (m *pciMigModeManager) openBar0AndWaitForBoot(gpu int) (_ mmio.Mmio, rerr e
 		}
 	}()
 
-	err = m.waitForBoot(bar0)
+	err = m.waitForBoot(ctx, gpu, bar0)
 	if err != nil {
-		return nil, fmt.Errorf("error waiting for GPU to boot: %v", err)
+		return nil, err
 	}
 
 	return bar0, nil
 }
 
-func (m *pciMigModeManager) openBar0ReadOnlyAndWaitForBoot(gpu int) (_ mmio.Mmio, rerr error) {
+func (m *pciMigModeManager) openBar0ReadOnlyAndWaitForBoot(ctx context.Context, gpu int) (_ mmio.Mmio, rerr error) {
 	bar0, err := m.openBar0ReadOnly(gpu)
 	if err != nil {
 		return nil, err
@@ -158,141 +240,105 @@ func (m *pciMigModeManager) openBar0ReadOnlyAndWaitForBoot(gpu int) (_ mmio.Mmio
 		}
 	}()
 
-	err = m.waitForBoot(bar0)
+	err = m.waitForBoot(ctx, gpu, bar0)
 	if err != nil {
-		return nil, fmt.Errorf("error waiting for GPU to boot: %v", err)
+		return nil, err
 	}
 
 	return bar0, nil
 }
 
-func (m *pciMigModeManager) checkBitsInRegWithMask(bar0 mmio.Mmio, reg int, mask, bits uint32) bool {
-	return (bar0.Read32(reg) & mask) == bits
-}
-
-func (m *pciMigModeManager) writeBitsInRegWithMask(bar0 mmio.Mmio, reg int, mask, bits uint32) {
-	current := bar0.Read32(reg)
-	masked := current & ^mask
-	updated := masked | (bits & mask)
-	bar0.Write32(reg, updated)
-}
-
-func (m *pciMigModeManager) checkBitsInReg(bar0 mmio.Mmio, reg int, bits uint32) bool {
-	return m.checkBitsInRegWithMask(bar0, reg, bits, bits)
-}
-
-func (m *pciMigModeManager) setBitsInReg(bar0 mmio.Mmio, reg int, bits uint32) {
-	m.writeBitsInRegWithMask(bar0, reg, bits, bits)
-}
-
-func (m *pciMigModeManager) clearBitsInReg(bar0 mmio.Mmio, reg int, bits uint32) {
-	m.writeBitsInRegWithMask(bar0, reg, bits, ^bits)
-}
-
-func (m *pciMigModeManager) isMigCapable(bar0 mmio.Mmio) bool {
-	pmcID := bar0.Read32(PmcIDReg)
-	for _, id := range migCapablePmcIDs {
-		if pmcID == id {
-			return true
-		}
+// WaitForBoot waits for a GPU to finish booting, returning an ErrNotBooted
+// error if it does not within the boot timeout.
+func (m *pciMigModeManager) WaitForBoot(ctx context.Context, gpu int) error {
+	bar0, err := m.openBar0ReadOnlyAndWaitForBoot(ctx, gpu)
+	if err != nil {
+		return err
 	}
-	return false
-}
-
-func (m *pciMigModeManager) isMigModeEnabled(bar0 mmio.Mmio) bool {
-	return m.checkBitsInReg(bar0, MigModeCheckReg, MigModeCheckEnabled)
-}
-
-func (m *pciMigModeManager) setMigModeEnabled(bar0 mmio.Mmio) {
-	m.writeBitsInRegWithMask(bar0, MigModeSetReg, MigModeSetMask, MigModeSetEnabled)
-}
-
-func (m *pciMigModeManager) setMigModeDisabled(bar0 mmio.Mmio) {
-	m.writeBitsInRegWithMask(bar0, MigModeSetReg, MigModeSetMask, MigModeSetDisabled)
+	m.tryCloseBar0(bar0)
+	return nil
 }
 
-func (m *pciMigModeManager) isMigModeChangePending(bar0 mmio.Mmio) bool {
-	enabled := m.isMigModeEnabled(bar0)
-	pendingEnable := m.checkBitsInRegWithMask(bar0, MigModeSetReg, MigModeSetMask, MigModeSetEnabled)
-	pendingDisable := m.checkBitsInRegWithMask(bar0, MigModeSetReg, MigModeSetMask, MigModeSetDisabled)
-	if enabled && pendingDisable {
-		return true
-	}
-	if !enabled && pendingEnable {
-		return true
+func (m *pciMigModeManager) IsMigCapable(ctx context.Context, gpu int) (bool, error) {
+	if ctx.Err() != nil {
+		return false, types.NewContextError(gpu, ctx.Err())
 	}
-	return false
-}
 
-func (m *pciMigModeManager) IsMigCapable(gpu int) (bool, error) {
 	bar0, err := m.openBar0ReadOnly(gpu)
 	if err != nil {
 		return false, err
 	}
 	defer m.tryCloseBar0(bar0)
-	return m.isMigCapable(bar0), nil
+	return lookupPciArchitecture(bar0) != nil, nil
 }
 
-func (m *pciMigModeManager) GetMigMode(gpu int) (MigMode, error) {
-	bar0, err := m.openBar0ReadOnlyAndWaitForBoot(gpu)
+func (m *pciMigModeManager) GetMigMode(ctx context.Context, gpu int) (MigMode, error) {
+	bar0, err := m.openBar0ReadOnlyAndWaitForBoot(ctx, gpu)
 	if err != nil {
 		return -1, err
 	}
 	defer m.tryCloseBar0(bar0)
 
-	if !m.isMigCapable(bar0) {
-		return -1, fmt.Errorf("non Mig-capable GPU")
+	arch := lookupPciArchitecture(bar0)
+	if arch == nil {
+		return -1, types.NewError(types.ErrorCategoryNotMigCapable, gpu, "non Mig-capable GPU")
 	}
 
-	if m.isMigModeEnabled(bar0) {
+	if arch.isMigModeEnabled(bar0) {
 		return Enabled, nil
 	}
 	return Disabled, nil
 }
 
-func (m *pciMigModeManager) SetMigMode(gpu int, mode MigMode) error {
-	capable, err := m.IsMigCapable(gpu)
+func (m *pciMigModeManager) SetMigMode(ctx context.Context, gpu int, mode MigMode) error {
+	capable, err := m.IsMigCapable(ctx, gpu)
 	if err != nil {
-		return fmt.Errorf("error checking if GPU is MIG capable: %v", err)
+		return fmt.Errorf("error checking if GPU is MIG capable: %w", err)
 	}
 
 	if !capable {
-		return fmt.Errorf("non Mig-capable GPU")
+		return types.NewError(types.ErrorCategoryNotMigCapable, gpu, "non Mig-capable GPU")
 	}
 
-	bar0, err := m.openBar0AndWaitForBoot(gpu)
+	bar0, err := m.openBar0AndWaitForBoot(ctx, gpu)
 	if err != nil {
 		return err
 	}
 	defer m.tryCloseBar0(bar0)
 
+	arch := lookupPciArchitecture(bar0)
+	if arch == nil {
+		return types.NewError(types.ErrorCategoryNotMigCapable, gpu, "non Mig-capable GPU")
+	}
+
 	switch mode {
 	case Disabled:
-		m.setMigModeDisabled(bar0)
+		arch.setMigModeDisabled(bar0)
 	case Enabled:
-		m.setMigModeEnabled(bar0)
+		arch.setMigModeEnabled(bar0)
 	default:
-		return fmt.Errorf("unknown Mig mode selected: %v", mode)
+		return types.NewError(types.ErrorCategoryInvalidConfig, gpu, "unknown Mig mode selected: %v", mode)
 	}
 
 	err = bar0.Sync()
 	if err != nil {
-		return fmt.Errorf("error syncing writes to bar0: %v", err)
+		return types.NewError(types.ErrorCategoryPci, gpu, "error syncing writes to bar0: %v", err)
 	}
 
 	return nil
 }
 
-func (m *pciMigModeManager) IsMigModeChangePending(gpu int) (bool, error) {
-	bar0, err := m.openBar0ReadOnlyAndWaitForBoot(gpu)
+func (m *pciMigModeManager) IsMigModeChangePending(ctx context.Context, gpu int) (bool, error) {
+	bar0, err := m.openBar0ReadOnlyAndWaitForBoot(ctx, gpu)
 	if err != nil {
 		return false, err
 	}
 	defer m.tryCloseBar0(bar0)
 
-	if !m.isMigCapable(bar0) {
-		return false, fmt.Errorf("non Mig-capable GPU")
+	arch := lookupPciArchitecture(bar0)
+	if arch == nil {
+		return false, types.NewError(types.ErrorCategoryNotMigCapable, gpu, "non Mig-capable GPU")
 	}
 
-	return m.isMigModeChangePending(bar0), nil
+	return arch.isMigModeChangePending(bar0), nil
 }
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mode
+
+import (
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci/mmio"
+)
+
+// pciArchitecture describes how to query and change the MIG mode of the GPUs
+// of one architecture through their bar0 MMIO resource.
+type pciArchitecture struct {
+	name  string
+	pmcID uint32 // PMC_BOOT_0 & PmcIDArchMask
+
+	bootCompleteReg   int
+	bootCompleteValue uint32
+
+	migModeCheckReg     int
+	migModeCheckEnabled uint32
+
+	migModeSetReg      int
+	migModeSetMask     uint32
+	migModeSetEnabled  uint32
+	migModeSetDisabled uint32
+}
+
+// pciArchitectures lists the MIG capable architectures, matched at runtime
+// against the PMC_BOOT_0 register of each GPU. The first entry is also used
+// to wait for GPUs of unknown architectures to boot.
+//
+// Only architectures whose registers have been verified are listed, as they
+// are written to directly. GH100 is not listed until its registers are: the
+// MIG mode of GPUs of other architectures can only be changed through NVML,
+// with the NVIDIA driver loaded.
+var pciArchitectures = []pciArchitecture{
+	{
+		name:                "GA100",
+		pmcID:               0x17000000,
+		bootCompleteReg:     BootCompleteReg,
+		bootCompleteValue:   BootCompleteValue,
+		migModeCheckReg:     MigModeCheckReg,
+		migModeCheckEnabled: MigModeCheckEnabled,
+		migModeSetReg:       MigModeSetReg,
+		migModeSetMask:      MigModeSetMask,
+		migModeSetEnabled:   MigModeSetEnabled,
+		migModeSetDisabled:  MigModeSetDisabled,
+	},
+}
+
+// lookupPciArchitecture returns the architecture of the GPU behind bar0, or
+// nil if it is not MIG capable.
+func lookupPciArchitecture(bar0 mmio.Mmio) *pciArchitecture {
+	pmcID := bar0.Read32(PmcIDReg) & PmcIDArchMask
+	for i := range pciArchitectures {
+		if pciArchitectures[i].pmcID == pmcID {
+			return &pciArchitectures[i]
+		}
+	}
+	return nil
+}
+
+func (a *pciArchitecture) isBootComplete(bar0 mmio.Mmio) bool {
+	return bar0.Read32(a.bootCompleteReg) == a.bootCompleteValue
+}
+
+func (a *pciArchitecture) isMigModeEnabled(bar0 mmio.Mmio) bool {
+	return checkBitsInReg(bar0, a.migModeCheckReg, a.migModeCheckEnabled)
+}
+
+func (a *pciArchitecture) setMigModeEnabled(bar0 mmio.Mmio) {
+	writeBitsInRegWithMask(bar0, a.migModeSetReg, a.migModeSetMask, a.migModeSetEnabled)
+}
+
+func (a *pciArchitecture) setMigModeDisabled(bar0 mmio.Mmio) {
+	writeBitsInRegWithMask(bar0, a.migModeSetReg, a.migModeSetMask, a.migModeSetDisabled)
+}
+
+func (a *pciArchitecture) isMigModeChangePending(bar0 mmio.Mmio) bool {
+	enabled := a.isMigModeEnabled(bar0)
+	pendingEnable := checkBitsInRegWithMask(bar0, a.migModeSetReg, a.migModeSetMask, a.migModeSetEnabled)
+	pendingDisable := checkBitsInRegWithMask(bar0, a.migModeSetReg, a.migModeSetMask, a.migModeSetDisabled)
+	if enabled && pendingDisable {
+		return true
+	}
+	if !enabled && pendingEnable {
+		return true
+	}
+	return false
+}
+
+func checkBitsInRegWithMask(bar0 mmio.Mmio, reg int, mask, bits uint32) bool {
+	return (bar0.Read32(reg) & mask) == bits
+}
+
+func writeBitsInRegWithMask(bar0 mmio.Mmio, reg int, mask, bits uint32) {
+	current := bar0.Read32(reg)
+	masked := current & ^mask
+	updated := masked | (bits & mask)
+	bar0.Write32(reg, updated)
+}
+
+func checkBitsInReg(bar0 mmio.Mmio, reg int, bits uint32) bool {
+	return checkBitsInRegWithMask(bar0, reg, bits, bits)
+}
+
+func setBitsInReg(bar0 mmio.Mmio, reg int, bits uint32) {
+	writeBitsInRegWithMask(bar0, reg, bits, bits)
+}
+
+func clearBitsInReg(bar0 mmio.Mmio, reg int, bits uint32) {
+	writeBitsInRegWithMask(bar0, reg, bits, ^bits)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mode
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci/mmio"
+)
+
+func newMockBar0(t *testing.T, pmcID uint32) mmio.Mmio {
+	data := make([]byte, MigModeSetReg+4)
+	bar0, err := mmio.MockOpenRW(&data, 0, len(data))
+	require.Nil(t, err, "Unexpected failure opening mock bar0")
+	bar0 = bar0.LittleEndian()
+	bar0.Write32(PmcIDReg, pmcID)
+	return bar0
+}
+
+func TestLookupPciArchitecture(t *testing.T) {
+	testCases := []struct {
+		pmcID    uint32
+		expected string
+	}{
+		{0x170000a1, "GA100"},
+		{0x170000a2, "GA100"},
+		{0x170000b1, "GA100"},
+		{0x180000a1, ""}, // GH100, registers not verified
+		{0x172000a1, ""}, // GA102
+		{0x164000a1, ""}, // TU104
+		{0x00000000, ""},
+		{0xdeadbeef, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("0x%08x", tc.pmcID), func(t *testing.T) {
+			arch := lookupPciArchitecture(newMockBar0(t, tc.pmcID))
+			if tc.expected == "" {
+				require.Nil(t, arch, "Unexpected architecture found")
+				return
+			}
+			require.NotNil(t, arch, "Expected architecture not found")
+			require.Equal(t, tc.expected, arch.name)
+		})
+	}
+}
+
+func TestPciArchitectureMigMode(t *testing.T) {
+	for _, pmcID := range []uint32{0x170000a1, 0x170000b1} {
+		t.Run(fmt.Sprintf("0x%08x", pmcID), func(t *testing.T) {
+			bar0 := newMockBar0(t, pmcID)
+			arch := lookupPciArchitecture(bar0)
+			require.NotNil(t, arch)
+
+			require.False(t, arch.isBootComplete(bar0))
+			bar0.Write32(arch.bootCompleteReg, arch.bootCompleteValue)
+			require.True(t, arch.isBootComplete(bar0))
+
+			require.False(t, arch.isMigModeEnabled(bar0))
+			require.False(t, arch.isMigModeChangePending(bar0))
+
+			arch.setMigModeEnabled(bar0)
+			require.False(t, arch.isMigModeEnabled(bar0))
+			require.True(t, arch.isMigModeChangePending(bar0))
+
+			setBitsInReg(bar0, arch.migModeCheckReg, arch.migModeCheckEnabled)
+			require.True(t, arch.isMigModeEnabled(bar0))
+			require.False(t, arch.isMigModeChangePending(bar0))
+
+			arch.setMigModeDisabled(bar0)
+			require.True(t, arch.isMigModeChangePending(bar0))
+			require.Equal(t, arch.migModeSetDisabled, bar0.Read32(arch.migModeSetReg)&arch.migModeSetMask)
+		})
+	}
+}
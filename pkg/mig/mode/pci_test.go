@@ -17,9 +17,14 @@
 package mode
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/NVIDIA/mig-parted/pkg/enumerator"
+	"github.com/NVIDIA/mig-parted/pkg/types"
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvpci"
@@ -27,17 +32,19 @@ import (
 
 type mockPciMigModeManager struct {
 	*pciMigModeManager
+	nvpci      *nvpci.MockA100
 	driverBusy bool
 }
 
-func NewMockPciA100Device() (*mockPciMigModeManager, error) {
+func NewMockPciA100Device(opts ...PciOption) (*mockPciMigModeManager, error) {
 	nvpci, err := nvpci.NewMockA100()
 	if err != nil {
 		return nil, fmt.Errorf("error creating Mock A100 PCI device: %v", err)
 	}
 
 	mock := &mockPciMigModeManager{
-		&pciMigModeManager{nvpci},
+		NewPciMigModeManagerWith(enumerator.NewNvpci(nvpci), opts...).(*pciMigModeManager),
+		nvpci,
 		false,
 	}
 
@@ -45,7 +52,7 @@ func NewMockPciA100Device() (*mockPciMigModeManager, error) {
 }
 
 func (m *mockPciMigModeManager) Cleanup() {
-	m.nvpci.(*nvpci.MockA100).Cleanup()
+	m.nvpci.Cleanup()
 }
 
 func (m *mockPciMigModeManager) SetBooted(gpu int, booted bool) error {
@@ -69,15 +76,15 @@ func (m *mockPciMigModeManager) SetMigCapable(gpu int, capable bool) error {
 	}
 	defer bar0.Close()
 	if capable {
-		bar0.Write32(PmcIDReg, migCapablePmcIDs[0])
+		bar0.Write32(PmcIDReg, 0x170000a1)
 	} else {
 		bar0.Write32(PmcIDReg, 0xdeadbeef)
 	}
 	return nil
 }
 
-func (m *mockPciMigModeManager) SetMigMode(gpu int, mode MigMode) error {
-	err := m.pciMigModeManager.SetMigMode(gpu, mode)
+func (m *mockPciMigModeManager) SetMigMode(ctx context.Context, gpu int, mode MigMode) error {
+	err := m.pciMigModeManager.SetMigMode(ctx, gpu, mode)
 	if err != nil {
 		return err
 	}
@@ -90,9 +97,9 @@ func (m *mockPciMigModeManager) SetMigMode(gpu int, mode MigMode) error {
 
 	if !m.driverBusy {
 		if mode == Enabled {
-			m.setBitsInReg(bar0, MigModeCheckReg, MigModeCheckEnabled)
+			setBitsInReg(bar0, MigModeCheckReg, MigModeCheckEnabled)
 		} else {
-			m.clearBitsInReg(bar0, MigModeCheckReg, MigModeCheckEnabled)
+			clearBitsInReg(bar0, MigModeCheckReg, MigModeCheckEnabled)
 		}
 	}
 
@@ -107,14 +114,14 @@ func TestPciIsMigCapable(t *testing.T) {
 	err = manager.SetBooted(0, true)
 	require.Nil(t, err, "Unexpected failure from SetBooted")
 
-	capable, err := manager.IsMigCapable(0)
+	capable, err := manager.IsMigCapable(context.Background(), 0)
 	require.Nil(t, err, "Unexpected failure from IsMigCapable")
 	require.True(t, capable)
 
 	err = manager.SetMigCapable(0, false)
 	require.Nil(t, err, "Unexpected failure from SetMigCapable")
 
-	capable, err = manager.IsMigCapable(0)
+	capable, err = manager.IsMigCapable(context.Background(), 0)
 	require.Nil(t, err, "Unexpected failure from IsMigCapable")
 	require.False(t, capable)
 }
@@ -127,30 +134,61 @@ func TestPciEnableDisableMig(t *testing.T) {
 	err = manager.SetBooted(0, true)
 	require.Nil(t, err, "Unexpected failure from SetBooted")
 
-	err = manager.SetMigMode(0, Enabled)
+	err = manager.SetMigMode(context.Background(), 0, Enabled)
 	require.Nil(t, err, "Unexpected failure from SetMigMode")
 
-	mode, err := manager.GetMigMode(0)
+	mode, err := manager.GetMigMode(context.Background(), 0)
 	require.Nil(t, err, "Unexpected failure from GetMigMode")
 	require.Equal(t, Enabled, mode)
 
-	err = manager.SetMigMode(0, Disabled)
+	err = manager.SetMigMode(context.Background(), 0, Disabled)
 	require.Nil(t, err, "Unexpected failure from SetMigMode")
 
-	mode, err = manager.GetMigMode(0)
+	mode, err = manager.GetMigMode(context.Background(), 0)
 	require.Nil(t, err, "Unexpected failure from GetMigMode")
 	require.Equal(t, Disabled, mode)
 
 	manager.driverBusy = true
 
-	err = manager.SetMigMode(0, Enabled)
+	err = manager.SetMigMode(context.Background(), 0, Enabled)
 	require.Nil(t, err, "Unexpected failure from SetMigMode")
 
-	mode, err = manager.GetMigMode(0)
+	mode, err = manager.GetMigMode(context.Background(), 0)
 	require.Nil(t, err, "Unexpected failure from GetMigMode")
 	require.Equal(t, Disabled, mode)
 
-	pending, err := manager.IsMigModeChangePending(0)
+	pending, err := manager.IsMigModeChangePending(context.Background(), 0)
 	require.Nil(t, err, "Unexpected failure from IsMigModeChangePending")
 	require.True(t, pending)
 }
+
+func TestPciWaitForBoot(t *testing.T) {
+	manager, err := NewMockPciA100Device(
+		WithBootTimeout(200*time.Millisecond),
+		WithBootPollInterval(time.Millisecond),
+		WithBootMaxPollInterval(10*time.Millisecond))
+	require.Nil(t, err, "Error creating MockPciA100Device")
+	defer manager.Cleanup()
+
+	err = manager.SetBooted(0, false)
+	require.Nil(t, err, "Unexpected failure from SetBooted")
+
+	err = manager.WaitForBoot(context.Background(), 0)
+	require.True(t, errors.Is(err, types.ErrNotBooted), "Unexpected error: %v", err)
+
+	_, err = manager.GetMigMode(context.Background(), 0)
+	require.True(t, errors.Is(err, types.ErrNotBooted), "Unexpected error: %v", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = manager.WaitForBoot(ctx, 0)
+	require.True(t, errors.Is(err, types.ErrCanceled), "Unexpected error: %v", err)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		manager.SetBooted(0, true)
+	}()
+
+	err = manager.WaitForBoot(context.Background(), 0)
+	require.Nil(t, err, "Unexpected failure from WaitForBoot")
+}
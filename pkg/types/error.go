@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2021, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// ErrorCategory classifies the errors returned while querying or changing the
+// MIG state of a GPU, so that callers can react to them programmatically.
+type ErrorCategory int
+
+const (
+	ErrorCategoryUnknown ErrorCategory = iota
+	ErrorCategoryNvml
+	ErrorCategoryPci
+	ErrorCategoryDriverNotLoaded
+	ErrorCategoryPermission
+	ErrorCategoryNotMigCapable
+	ErrorCategoryMigModeDisabled
+	ErrorCategoryInvalidConfig
+	ErrorCategoryInUse
+	ErrorCategoryRebootRequired
+	ErrorCategoryTimeout
+	ErrorCategoryCanceled
+	ErrorCategoryNotBooted
+	ErrorCategoryMigModeEnabled
+	ErrorCategoryResetRequired
+)
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case ErrorCategoryNvml:
+		return "nvml"
+	case ErrorCategoryPci:
+		return "pci"
+	case ErrorCategoryDriverNotLoaded:
+		return "driver-not-loaded"
+	case ErrorCategoryPermission:
+		return "permission"
+	case ErrorCategoryNotMigCapable:
+		return "not-mig-capable"
+	case ErrorCategoryMigModeDisabled:
+		return "mig-mode-disabled"
+	case ErrorCategoryInvalidConfig:
+		return "invalid-config"
+	case ErrorCategoryInUse:
+		return "in-use"
+	case ErrorCategoryRebootRequired:
+		return "reboot-required"
+	case ErrorCategoryTimeout:
+		return "timeout"
+	case ErrorCategoryCanceled:
+		return "canceled"
+	case ErrorCategoryNotBooted:
+		return "not-booted"
+	case ErrorCategoryMigModeEnabled:
+		return "mig-mode-enabled"
+	case ErrorCategoryResetRequired:
+		return "reset-required"
+	}
+	return "unknown"
+}
+
+// Sentinel errors for use with errors.Is(). An *Error matches one of these if
+// their categories are the same, regardless of GPU index or return code.
+var (
+	ErrNvml            = &Error{Category: ErrorCategoryNvml, GPU: -1}
+	ErrPci             = &Error{Category: ErrorCategoryPci, GPU: -1}
+	ErrDriverNotLoaded = &Error{Category: ErrorCategoryDriverNotLoaded, GPU: -1}
+	ErrPermission      = &Error{Category: ErrorCategoryPermission, GPU: -1}
+	ErrNotMigCapable   = &Error{Category: ErrorCategoryNotMigCapable, GPU: -1}
+	ErrMigModeDisabled = &Error{Category: ErrorCategoryMigModeDisabled, GPU: -1}
+	ErrInvalidConfig   = &Error{Category: ErrorCategoryInvalidConfig, GPU: -1}
+	ErrInUse           = &Error{Category: ErrorCategoryInUse, GPU: -1}
+	ErrRebootRequired  = &Error{Category: ErrorCategoryRebootRequired, GPU: -1}
+	ErrTimeout         = &Error{Category: ErrorCategoryTimeout, GPU: -1}
+	ErrCanceled        = &Error{Category: ErrorCategoryCanceled, GPU: -1}
+	ErrNotBooted       = &Error{Category: ErrorCategoryNotBooted, GPU: -1}
+	ErrMigModeEnabled  = &Error{Category: ErrorCategoryMigModeEnabled, GPU: -1}
+	ErrResetRequired   = &Error{Category: ErrorCategoryResetRequired, GPU: -1}
+)
+
+// Error is the error type returned by the MIG mode and config managers. It
+// carries the index of the GPU the error applies to (or -1), the NVML return
+// code that caused it (or nvml.SUCCESS if NVML was not involved), and its
+// category.
+type Error struct {
+	Category ErrorCategory
+	GPU      int
+	Return   nvml.Return
+	Err      error
+}
+
+// NewError constructs a new *Error of the given category for a GPU.
+func NewError(category ErrorCategory, gpu int, format string, a ...interface{}) error {
+	return &Error{
+		Category: category,
+		GPU:      gpu,
+		Return:   nvml.SUCCESS,
+		Err:      fmt.Errorf(format, a...),
+	}
+}
+
+// NewNvmlError constructs a new *Error for a GPU from a failed NVML call,
+// deriving its category from the NVML return code.
+func NewNvmlError(gpu int, ret nvml.Return, format string, a ...interface{}) error {
+	return &Error{
+		Category: NvmlReturnCategory(ret),
+		GPU:      gpu,
+		Return:   ret,
+		Err:      fmt.Errorf(format, a...),
+	}
+}
+
+// NewContextError constructs a new *Error for a GPU from the error of a
+// context that expired (ErrorCategoryTimeout) or was cancelled
+// (ErrorCategoryCanceled). The context error remains in the error chain.
+func NewContextError(gpu int, err error) error {
+	category := ErrorCategoryCanceled
+	if errors.Is(err, context.DeadlineExceeded) {
+		category = ErrorCategoryTimeout
+	}
+	return &Error{
+		Category: category,
+		GPU:      gpu,
+		Return:   nvml.SUCCESS,
+		Err:      fmt.Errorf("operation aborted: %w", err),
+	}
+}
+
+// NvmlReturnCategory maps an NVML return code to an ErrorCategory.
+func NvmlReturnCategory(ret nvml.Return) ErrorCategory {
+	switch ret {
+	case nvml.ERROR_IN_USE:
+		return ErrorCategoryInUse
+	case nvml.ERROR_RESET_REQUIRED:
+		return ErrorCategoryResetRequired
+	case nvml.ERROR_NO_PERMISSION:
+		return ErrorCategoryPermission
+	case nvml.ERROR_DRIVER_NOT_LOADED, nvml.ERROR_LIBRARY_NOT_FOUND:
+		return ErrorCategoryDriverNotLoaded
+	case nvml.ERROR_TIMEOUT:
+		return ErrorCategoryTimeout
+	}
+	return ErrorCategoryNvml
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Category.String()
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error of the same category.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	return e.Category == t.Category
+}
@@ -17,8 +17,11 @@
 package types
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
 	"github.com/stretchr/testify/require"
 )
 
@@ -91,3 +94,59 @@ func TestMigProfileAssertValid(t *testing.T) {
 		})
 	}
 }
+
+func TestErrorIsAs(t *testing.T) {
+	testCases := []struct {
+		description string
+		err         error
+		is          error
+		isNot       error
+		gpu         int
+		ret         nvml.Return
+	}{
+		{
+			"Plain category error",
+			NewError(ErrorCategoryMigModeDisabled, 3, "MIG mode disabled"),
+			ErrMigModeDisabled,
+			ErrInUse,
+			3,
+			nvml.SUCCESS,
+		},
+		{
+			"NVML in use error",
+			NewNvmlError(1, nvml.ERROR_IN_USE, "error destroying GPU instance"),
+			ErrInUse,
+			ErrNvml,
+			1,
+			nvml.ERROR_IN_USE,
+		},
+		{
+			"Generic NVML error",
+			NewNvmlError(0, nvml.ERROR_UNKNOWN, "error getting device handle"),
+			ErrNvml,
+			ErrInvalidConfig,
+			0,
+			nvml.ERROR_UNKNOWN,
+		},
+		{
+			"Wrapped error",
+			fmt.Errorf("error setting MIG mode: %w", NewNvmlError(2, nvml.ERROR_RESET_REQUIRED, "reset required")),
+			ErrResetRequired,
+			ErrRebootRequired,
+			2,
+			nvml.ERROR_RESET_REQUIRED,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			require.True(t, errors.Is(tc.err, tc.is))
+			require.False(t, errors.Is(tc.err, tc.isNot))
+
+			var typed *Error
+			require.True(t, errors.As(tc.err, &typed))
+			require.Equal(t, tc.gpu, typed.GPU)
+			require.Equal(t, tc.ret, typed.Return)
+		})
+	}
+}